@@ -0,0 +1,293 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gookit/rux"
+	"github.com/r35krag0th/win-loss-rux/version"
+	"github.com/sirupsen/logrus"
+)
+
+// adminPrefix is the route the admin area is served below.
+const adminPrefix = "/admin"
+
+// csrfCookie holds the token every form in the admin area has to send back as csrfField.
+const (
+	csrfCookie = "wl_csrf"
+	csrfField  = "csrf_token"
+)
+
+// Columns the admin table can be sorted by.
+var adminSortColumns = map[string]bool{
+	"name":    true,
+	"wins":    true,
+	"losses":  true,
+	"draws":   true,
+	"updated": true,
+}
+
+// AdminCounterRow is one counter in the admin table.
+type AdminCounterRow struct {
+	Name       string
+	PrettyName string
+	Wins       int
+	Losses     int
+	Draws      int
+	Theme      string
+	UpdatedAt  *time.Time
+}
+
+// AdminTemplateData is the data used to render the admin area.
+type AdminTemplateData struct {
+	Title     string
+	Theme     *Theme
+	Themes    []*Theme
+	CSRFToken string
+	Notice    string
+	Error     string
+	Sort      string
+	Order     string
+	Counters  []AdminCounterRow
+}
+
+// SortURL returns the link for a column header: ascending, or descending if the table is already
+// sorted ascending by that column.
+func (a AdminTemplateData) SortURL(column string) string {
+	order := "asc"
+	if a.Sort == column && a.Order == "asc" {
+		order = "desc"
+	}
+	return adminPrefix + "?" + url.Values{"sort": {column}, "order": {order}}.Encode()
+}
+
+// SortIndicator returns an arrow for the column the table is sorted by.
+func (a AdminTemplateData) SortIndicator(column string) string {
+	if a.Sort != column {
+		return ""
+	}
+	if a.Order == "desc" {
+		return "▼"
+	}
+	return "▲"
+}
+
+// SortCounters orders the rows by a.Sort and a.Order. Ties are broken by name.
+func (a *AdminTemplateData) SortCounters() {
+	less := func(x, y AdminCounterRow) bool {
+		switch a.Sort {
+		case "wins":
+			return x.Wins < y.Wins
+		case "losses":
+			return x.Losses < y.Losses
+		case "draws":
+			return x.Draws < y.Draws
+		case "updated":
+			if x.UpdatedAt == nil || y.UpdatedAt == nil {
+				return x.UpdatedAt == nil && y.UpdatedAt != nil
+			}
+			return x.UpdatedAt.Before(*y.UpdatedAt)
+		}
+		return false
+	}
+
+	sort.SliceStable(a.Counters, func(i, j int) bool {
+		x, y := a.Counters[i], a.Counters[j]
+		if a.Order == "desc" {
+			x, y = y, x
+		}
+		if less(x, y) {
+			return true
+		}
+		if less(y, x) {
+			return false
+		}
+		return x.Name < y.Name
+	})
+}
+
+// adminCredentials returns the user name and password of the admin area from ADMIN_USERNAME
+// (default "admin") and ADMIN_PASSWORD. Without a password the admin area is disabled.
+func adminCredentials() (string, string) {
+	return getenv("ADMIN_USERNAME", "admin"), os.Getenv("ADMIN_PASSWORD")
+}
+
+// adminAuthMiddleware protects the admin area with HTTP basic authentication.
+func adminAuthMiddleware(c *rux.Context) {
+	if _, password := adminCredentials(); password == "" {
+		c.AbortWithStatus(404, "The admin area is disabled; set ADMIN_PASSWORD to enable it")
+		return
+	}
+	if !adminAuthorized(c) {
+		return
+	}
+	c.Next()
+}
+
+// backupAuthMiddleware puts the export and import of every counter behind the admin credentials
+// when ADMIN_PASSWORD is set. Without a password they stay open, like the rest of the API.
+func backupAuthMiddleware(c *rux.Context) {
+	if _, password := adminCredentials(); password == "" {
+		c.Next()
+		return
+	}
+	if !adminAuthorized(c) {
+		return
+	}
+	// Browsers send cached basic auth credentials along with cross-site requests too
+	jsonBodyMiddleware(c)
+}
+
+// apiWriteCredentials returns the user name and password needed to change counters through the
+// API, from API_WRITE_USERNAME (default "api") and API_WRITE_PASSWORD. Without a password changes
+// need no credentials, so existing integrations keep working.
+func apiWriteCredentials() (string, string) {
+	return getenv("API_WRITE_USERNAME", "api"), os.Getenv("API_WRITE_PASSWORD")
+}
+
+// apiWriteAuthMiddleware puts the API routes that change counters behind the API write
+// credentials when API_WRITE_PASSWORD is set. Reading counters never needs credentials, so
+// overlays and widgets keep working.
+func apiWriteAuthMiddleware(c *rux.Context) {
+	username, password := apiWriteCredentials()
+	if password == "" || isReadRequest(c.Req) {
+		c.Next()
+		return
+	}
+	if !basicAuthorized(c, username, password, "win-loss api") {
+		return
+	}
+	jsonBodyMiddleware(c)
+}
+
+// isReadRequest reports whether a request can't change anything.
+func isReadRequest(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// adminAuthorized checks the basic auth credentials of the request against the admin credentials,
+// responding with 401 if they are missing or wrong.
+func adminAuthorized(c *rux.Context) bool {
+	username, password := adminCredentials()
+	return basicAuthorized(c, username, password, "win-loss admin")
+}
+
+// basicAuthorized checks the basic auth credentials of the request, responding with 401 if they
+// are missing or wrong.
+func basicAuthorized(c *rux.Context, username, password, realm string) bool {
+	logger := logrus.WithFields(logrus.Fields{
+		"func":    "basicAuthorized",
+		"realm":   realm,
+		"version": version.Version,
+	})
+
+	user, pass, ok := c.Req.BasicAuth()
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(username)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(pass), []byte(password)) == 1
+	if !ok || !userOK || !passOK {
+		if ok {
+			logger.WithField("user", user).Warn("Rejected login")
+		}
+		c.SetHeader("WWW-Authenticate", fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, realm))
+		c.AbortWithStatus(401, "Unauthorized")
+		return false
+	}
+	return true
+}
+
+// csrfMiddleware rejects any POST to the admin area whose csrf_token form field doesn't match the
+// token cookie handed out with the page the form came from.
+func csrfMiddleware(c *rux.Context) {
+	if c.Req.Method != http.MethodPost {
+		c.Next()
+		return
+	}
+
+	cookie := c.Cookie(csrfCookie)
+	token, _ := c.PostParam(csrfField)
+	if cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(token)) != 1 {
+		logrus.WithFields(logrus.Fields{
+			"func":    "csrfMiddleware",
+			"path":    c.Req.URL.Path,
+			"version": version.Version,
+		}).Warn("Rejected admin request with a missing or invalid CSRF token")
+		c.AbortWithStatus(403, "Invalid CSRF token; reload the page and try again")
+		return
+	}
+	c.Next()
+}
+
+// jsonBodyMiddleware only lets requests through that a browser can't send cross-site without a
+// preflight: those without a body and content type, and those declared as JSON (or NDJSON for
+// imports). Cross-site requests browsers label with Sec-Fetch-Site are rejected outright. So basic
+// auth credentials a browser cached can't be abused by other sites.
+func jsonBodyMiddleware(c *rux.Context) {
+	if c.Req.Header.Get("Sec-Fetch-Site") == "cross-site" {
+		c.AbortWithStatus(403, "Cross-site requests are not allowed")
+		return
+	}
+	contentType := c.Req.Header.Get("Content-Type")
+	if c.Req.ContentLength == 0 && contentType == "" {
+		c.Next()
+		return
+	}
+	if !strings.HasPrefix(contentType, "application/json") && !strings.HasPrefix(contentType, "application/x-ndjson") {
+		c.AbortWithStatus(415, "Expected Content-Type: application/json")
+		return
+	}
+	c.Next()
+}
+
+// csrfToken returns the CSRF token of the browser, handing out a new one if it has none yet.
+func csrfToken(c *rux.Context) (string, error) {
+	if token := c.Cookie(csrfCookie); token != "" {
+		return token, nil
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	http.SetCookie(c.Resp, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     adminPrefix,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(publicBaseURL(c.Req), "https://"),
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token, nil
+}
+
+// adminRedirect sends the browser back to the admin table with a notice or error message.
+func adminRedirect(c *rux.Context, key, message string) {
+	c.Redirect(adminPrefix+"?"+url.Values{key: {message}}.Encode(), http.StatusSeeOther)
+}
+
+// adminCounter loads the counter named in the route, redirecting back with an error if it doesn't exist.
+func adminCounter(c *rux.Context) (*WinLossCounter, bool) {
+	counter := handleCounter(c.Req.Context(), c.Param("name"))
+	exists, err := counter.Exists()
+	if err != nil {
+		c.AbortWithStatus(500, "Something bad happened")
+		return nil, false
+	}
+	if !exists {
+		adminRedirect(c, "error", fmt.Sprintf("Unknown counter: %s", counter.Name))
+		return nil, false
+	}
+	return counter, true
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gookit/rux"
+	"github.com/sirupsen/logrus"
+)
+
+// apiTestRouter returns a router backed by a fake Consul, with ADMIN_PASSWORD set to password and
+// no API write credentials.
+func apiTestRouter(t *testing.T, password string) (*rux.Router, *fakeConsul) {
+	t.Helper()
+	consul := useFakeConsul(t)
+	t.Setenv("ADMIN_USERNAME", "admin")
+	t.Setenv("ADMIN_PASSWORD", password)
+	t.Setenv("API_WRITE_USERNAME", "writer")
+	t.Setenv("API_WRITE_PASSWORD", "")
+	return newRouter(logrus.NewEntry(logrus.StandardLogger()), nil), consul
+}
+
+type apiRequest struct {
+	method      string
+	path        string
+	body        string
+	contentType string
+	auth        bool
+	writeAuth   bool
+	crossSite   bool
+}
+
+func (a apiRequest) serve(r *rux.Router) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(a.method, a.path, strings.NewReader(a.body))
+	if a.contentType != "" {
+		req.Header.Set("Content-Type", a.contentType)
+	}
+	if a.auth {
+		req.SetBasicAuth("admin", "s3cret")
+	}
+	if a.writeAuth {
+		req.SetBasicAuth("writer", "w1te")
+	}
+	if a.crossSite {
+		req.Header.Set("Sec-Fetch-Site", "cross-site")
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAPIAuthWithAdminPassword(t *testing.T) {
+	r, consul := apiTestRouter(t, "s3cret")
+	consul.Put(consulKeyPrefix+"/open", `{"schema_version":1,"name":"open","wins":1,"losses":0,"draws":0}`)
+	export := `{"format_version":1,"counters":[{"name":"imported","wins":2}]}`
+
+	tests := []struct {
+		name    string
+		request apiRequest
+		want    int
+	}{
+		{"read a counter", apiRequest{method: "GET", path: "/api/v1/counters/open"}, 200},
+		{"increment without credentials", apiRequest{method: "PUT", path: "/api/v1/counters/open/win"}, 200},
+		{"decrement without credentials", apiRequest{method: "DELETE", path: "/api/v1/counters/open/win"}, 200},
+		{"undo without credentials", apiRequest{method: "POST", path: "/api/v1/counters/open/undo"}, 200},
+		{"export without credentials", apiRequest{method: "GET", path: "/api/v1/export"}, 401},
+		{"export with the API write credentials", apiRequest{method: "GET", path: "/api/v1/export", writeAuth: true}, 401},
+		{"export", apiRequest{method: "GET", path: "/api/v1/export", auth: true}, 200},
+		{"import without credentials", apiRequest{method: "POST", path: "/api/v1/import", body: export, contentType: "application/json"}, 401},
+		{"import", apiRequest{method: "POST", path: "/api/v1/import?dry_run=true", body: export, contentType: "application/json", auth: true}, 200},
+		{"import as NDJSON", apiRequest{method: "POST", path: "/api/v1/import?dry_run=true", body: export, contentType: "application/x-ndjson", auth: true}, 200},
+		{"import posted by a form", apiRequest{method: "POST", path: "/api/v1/import", body: export, contentType: "application/x-www-form-urlencoded", auth: true}, 415},
+		{"webhooks without credentials", apiRequest{method: "GET", path: "/api/v1/webhooks"}, 401},
+		{"webhooks", apiRequest{method: "GET", path: "/api/v1/webhooks", auth: true}, 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.request.serve(r).Code; got != tt.want {
+				t.Errorf("%s %s = %d, want %d", tt.request.method, tt.request.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIAuthWithWritePassword(t *testing.T) {
+	r, consul := apiTestRouter(t, "s3cret")
+	t.Setenv("API_WRITE_PASSWORD", "w1te")
+	consul.Put(consulKeyPrefix+"/guarded", `{"schema_version":1,"name":"guarded","wins":1,"losses":0,"draws":0}`)
+
+	tests := []struct {
+		name    string
+		request apiRequest
+		want    int
+	}{
+		{"read a counter", apiRequest{method: "GET", path: "/api/v1/counters/guarded"}, 200},
+		{"read numerics", apiRequest{method: "GET", path: "/api/v1/counters/guarded/numerics/winrate"}, 200},
+		{"increment without credentials", apiRequest{method: "PUT", path: "/api/v1/counters/guarded/win"}, 401},
+		{"increment with the admin credentials", apiRequest{method: "PUT", path: "/api/v1/counters/guarded/win", auth: true}, 401},
+		{"increment", apiRequest{method: "PUT", path: "/api/v1/counters/guarded/win", writeAuth: true}, 200},
+		{"increment from the control page", apiRequest{method: "PUT", path: "/api/v1/counters/guarded/win", contentType: "application/json", writeAuth: true}, 200},
+		{"decrement without credentials", apiRequest{method: "DELETE", path: "/api/v1/counters/guarded/win"}, 401},
+		{"undo without credentials", apiRequest{method: "POST", path: "/api/v1/counters/guarded/undo"}, 401},
+		{"delete without credentials", apiRequest{method: "DELETE", path: "/api/v1/counters/guarded"}, 401},
+		{"empty form post", apiRequest{method: "POST", path: "/api/v1/counters/guarded/undo", contentType: "text/plain", writeAuth: true}, 415},
+		{"cross-site request", apiRequest{method: "POST", path: "/api/v1/counters/guarded/reset", writeAuth: true, crossSite: true}, 403},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.request.serve(r).Code; got != tt.want {
+				t.Errorf("%s %s = %d, want %d", tt.request.method, tt.request.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIAuthWithoutPassword(t *testing.T) {
+	r, _ := apiTestRouter(t, "")
+
+	if got := (apiRequest{method: "PUT", path: "/api/v1/counters/open/win"}).serve(r).Code; got != 200 {
+		t.Errorf("increment without ADMIN_PASSWORD = %d, want 200", got)
+	}
+	if got := (apiRequest{method: "GET", path: "/api/v1/export"}).serve(r).Code; got != 200 {
+		t.Errorf("export without ADMIN_PASSWORD = %d, want 200", got)
+	}
+	if got := (apiRequest{method: "GET", path: "/api/v1/webhooks"}).serve(r).Code; got != 404 {
+		t.Errorf("webhooks without ADMIN_PASSWORD = %d, want 404", got)
+	}
+}
+
+func TestAdminAuth(t *testing.T) {
+	r, _ := apiTestRouter(t, "s3cret")
+
+	w := apiRequest{method: "GET", path: "/admin"}.serve(r)
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("admin without credentials = %d, want 401 with a basic auth challenge", w.Code)
+	}
+	if got := (apiRequest{method: "POST", path: "/admin/counters/x/reset", auth: true}).serve(r).Code; got != 403 {
+		t.Errorf("admin post without CSRF token = %d, want 403", got)
+	}
+}
+
+// renameTestCounter stores a counter with history and returns it loaded.
+func renameTestCounter(t *testing.T) (*fakeConsul, *WinLossCounter) {
+	t.Helper()
+	consul, client := newFakeConsul(t)
+	counter := NewWinLossCounter("before")
+	counter.SetConsulClient(client)
+	counter.AddWin()
+	counter.AddLoss()
+	counter.Load()
+	return consul, counter
+}
+
+func TestRenameMovesCounterAndHistory(t *testing.T) {
+	consul, counter := renameTestCounter(t)
+
+	if err := counter.Rename("after"); err != nil {
+		t.Fatal(err)
+	}
+	if counter.Name != "after" {
+		t.Errorf("Name = %q after renaming", counter.Name)
+	}
+	if _, ok := consul.Get(consulKeyPrefix + "/before"); ok {
+		t.Error("the old counter still exists")
+	}
+	if _, ok := consul.Get(historyKeyPrefix + "/before"); ok {
+		t.Error("the old history still exists")
+	}
+
+	renamed := NewWinLossCounter("after")
+	renamed.SetConsulClient(counter.consulClient)
+	renamed.Load()
+	if renamed.Wins != 1 || renamed.Losses != 1 {
+		t.Errorf("renamed counter = %d/%d, want 1/1", renamed.Wins, renamed.Losses)
+	}
+	if history := renamed.History(); len(history) != 2 {
+		t.Errorf("renamed history has %d entries, want 2", len(history))
+	}
+}
+
+func TestRenameFailuresLeaveEverythingInPlace(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(*fakeConsul)
+		want    error
+	}{
+		{
+			name: "new name taken",
+			prepare: func(consul *fakeConsul) {
+				consul.Put(consulKeyPrefix+"/after", `{"schema_version":1,"name":"after","wins":9,"losses":9,"draws":9}`)
+			},
+			want: ErrCounterExists,
+		},
+		{
+			name: "counter changed since it was loaded",
+			prepare: func(consul *fakeConsul) {
+				consul.Put(consulKeyPrefix+"/before", `{"schema_version":1,"name":"before","wins":5,"losses":1,"draws":0}`)
+			},
+			want: ErrCounterChanged,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			consul, counter := renameTestCounter(t)
+			tt.prepare(consul)
+			before := map[string]string{}
+			for _, key := range consul.Keys("") {
+				before[key], _ = consul.Get(key)
+			}
+
+			if err := counter.Rename("after"); !errors.Is(err, tt.want) {
+				t.Fatalf("Rename = %v, want %v", err, tt.want)
+			}
+			if counter.Name != "before" {
+				t.Errorf("Name = %q after a failed rename", counter.Name)
+			}
+			after := consul.Keys("")
+			if len(after) != len(before) {
+				t.Errorf("keys after a failed rename = %v", after)
+			}
+			for _, key := range after {
+				if value, _ := consul.Get(key); value != before[key] {
+					t.Errorf("%s changed by a failed rename: %s", key, value)
+				}
+			}
+		})
+	}
+}
+
+func TestRenameWithConsulDown(t *testing.T) {
+	consul, counter := renameTestCounter(t)
+	consul.SetFailing(true)
+	if err := counter.Rename("after"); err == nil {
+		t.Fatal("Rename succeeded without Consul")
+	}
+	consul.SetFailing(false)
+	if _, ok := consul.Get(consulKeyPrefix + "/before"); !ok {
+		t.Error("the old counter is gone after a failed rename")
+	}
+	if _, ok := consul.Get(consulKeyPrefix + "/after"); ok {
+		t.Error("the new counter exists after a failed rename")
+	}
+}
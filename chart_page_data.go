@@ -0,0 +1,35 @@
+package main
+
+import (
+	"html/template"
+	"net/url"
+	"strconv"
+)
+
+// ChartPageData is the data structure handed off to the chart page.
+type ChartPageData struct {
+	Title   string
+	Name    string
+	Label   string
+	Theme   *Theme
+	Window  string
+	Windows []string
+	Rolling int
+	Refresh int
+	// Controls shows the window links below the chart; overlays usually hide them.
+	Controls bool
+	Chart    template.HTML
+}
+
+// WindowURL returns the link to the same chart limited to another window.
+func (d ChartPageData) WindowURL(window string) string {
+	query := url.Values{
+		"window":  {window},
+		"rolling": {strconv.Itoa(d.Rolling)},
+		"theme":   {d.Theme.Name},
+	}
+	if d.Refresh > 0 {
+		query.Set("refresh", strconv.Itoa(d.Refresh))
+	}
+	return "/counters/" + url.PathEscape(d.Name) + "/chart?" + query.Encode()
+}
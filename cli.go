@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/r35krag0th/win-loss-rux/version"
+	"github.com/sirupsen/logrus"
+)
+
+// runCommand runs a command-line subcommand against the configured backend and returns the exit code.
+// Running the binary without a subcommand starts the HTTP server instead.
+func runCommand(args []string) int {
+	// Keep stdout free for command output such as exports.
+	logrus.SetOutput(os.Stderr)
+
+	switch args[0] {
+	case "export":
+		return runExportCommand(args[1:])
+	case "import":
+		return runImportCommand(args[1:])
+	case "migrate":
+		return runMigrateCommand(args[1:])
+	case "discord-commands":
+		return runDiscordCommandsCommand(args[1:])
+	case "help", "-h", "--help":
+		printUsage(os.Stdout)
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command: %s\n\n", args[0])
+	printUsage(os.Stderr)
+	return 2
+}
+
+func printUsage(out io.Writer) {
+	fmt.Fprintf(out, "win-loss %s\n\n", version.Version)
+	fmt.Fprintln(out, "Usage:")
+	fmt.Fprintln(out, "  win-loss                  start the HTTP server on :3000")
+	fmt.Fprintln(out, "  win-loss export [flags]   write every counter to a file or stdout")
+	fmt.Fprintln(out, "  win-loss import [flags]   read counters from a file or stdin")
+	fmt.Fprintln(out, "  win-loss migrate [flags]  upgrade every stored counter to the current schema")
+	fmt.Fprintln(out, "  win-loss discord-commands [flags]")
+	fmt.Fprintln(out, "                            register the /win, /loss and /record slash commands")
+	fmt.Fprintln(out, "")
+	fmt.Fprintln(out, "Run 'win-loss <command> -h' for the flags of a command.")
+}
+
+func runExportCommand(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	output := fs.String("o", "-", "file to write the export to, - for stdout")
+	format := fs.String("format", "json", "export format: json or ndjson")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	logger := logrus.WithFields(logrus.Fields{
+		"command": "export",
+		"format":  *format,
+		"version": version.Version,
+	})
+
+	if *format != "json" && *format != "ndjson" {
+		logger.Errorf("Unknown export format: %s", *format)
+		return 2
+	}
+
+	consulClient, err := newConsulClient()
+	if err != nil {
+		logger.WithError(err).Error("Failed to create Consul client")
+		return 1
+	}
+
+	doc, err := ExportCounters(consulClient)
+	if err != nil {
+		logger.WithError(err).Error("Failed to export counters")
+		return 1
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			logger.WithError(err).Error("Failed to create output file")
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if *format == "ndjson" {
+		err = doc.WriteNDJSON(out)
+	} else {
+		err = doc.WriteJSON(out)
+	}
+	if err != nil {
+		logger.WithError(err).Error("Failed to write export")
+		return 1
+	}
+	return 0
+}
+
+func runImportCommand(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	input := fs.String("i", "-", "file to read the export from, - for stdin")
+	mode := fs.String("mode", ImportModeSkip, "how to handle existing counters: merge, overwrite or skip")
+	dryRun := fs.Bool("dry-run", false, "report what would change without writing anything")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	logger := logrus.WithFields(logrus.Fields{
+		"command": "import",
+		"mode":    *mode,
+		"dry_run": *dryRun,
+		"version": version.Version,
+	})
+
+	if !ValidImportMode(*mode) {
+		logger.Errorf("Unknown import mode: %s", *mode)
+		return 2
+	}
+
+	var in io.Reader = os.Stdin
+	if *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
+			logger.WithError(err).Error("Failed to open input file")
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+
+	doc, err := ReadCounterExport(in)
+	if err != nil {
+		logger.WithError(err).Error("Failed to read export")
+		return 1
+	}
+
+	consulClient, err := newConsulClient()
+	if err != nil {
+		logger.WithError(err).Error("Failed to create Consul client")
+		return 1
+	}
+
+	results, err := ImportCounters(consulClient, doc, *mode, *dryRun)
+	if err != nil {
+		logger.WithError(err).Error("Failed to import counters")
+		return 1
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(results); err != nil {
+		logger.WithError(err).Error("Failed to write results")
+		return 1
+	}
+	return 0
+}
+
+func runMigrateCommand(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "report what would be upgraded without writing anything")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	logger := logrus.WithFields(logrus.Fields{
+		"command": "migrate",
+		"dry_run": *dryRun,
+		"version": version.Version,
+	})
+
+	consulClient, err := newConsulClient()
+	if err != nil {
+		logger.WithError(err).Error("Failed to create Consul client")
+		return 1
+	}
+
+	results, err := MigrateCounters(consulClient, *dryRun)
+	if err != nil {
+		logger.WithError(err).Error("Failed to migrate counters")
+		return 1
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(results); err != nil {
+		logger.WithError(err).Error("Failed to write results")
+		return 1
+	}
+
+	for _, result := range results {
+		if result.Error != "" {
+			return 1
+		}
+	}
+	return 0
+}
+
+func runDiscordCommandsCommand(args []string) int {
+	fs := flag.NewFlagSet("discord-commands", flag.ContinueOnError)
+	guild := fs.String("guild", "", "register the commands in this guild only; they show up immediately")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	logger := logrus.WithFields(logrus.Fields{
+		"command": "discord-commands",
+		"guild":   *guild,
+		"version": version.Version,
+	})
+
+	applicationID, botToken := os.Getenv("DISCORD_APPLICATION_ID"), os.Getenv("DISCORD_BOT_TOKEN")
+	if applicationID == "" || botToken == "" {
+		logger.Error("DISCORD_APPLICATION_ID and DISCORD_BOT_TOKEN must be set")
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := RegisterDiscordCommands(ctx, applicationID, botToken, *guild); err != nil {
+		logger.WithError(err).Error("Failed to register slash commands")
+		return 1
+	}
+	logger.Info("Registered slash commands")
+	return 0
+}
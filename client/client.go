@@ -0,0 +1,258 @@
+// Package client is a typed Go client for the /api/v1 routes described in api/openapi.json.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/r35krag0th/win-loss-rux/numericsapp"
+	"github.com/r35krag0th/win-loss-rux/shieldsio"
+)
+
+// Client talks to a single win-loss service.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// Username and Password are sent as basic auth when Password is set. Changing counters needs
+	// the service's API write credentials if it has any; export, import and webhooks need its
+	// admin credentials.
+	Username string
+	Password string
+}
+
+// Error is returned for any response that isn't a 2xx.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("win-loss api: %d %s", e.StatusCode, e.Message)
+}
+
+// New creates a Client for the service at baseURL, e.g. "http://localhost:3000".
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// ListCounters returns the names of all counters.
+func (c *Client) ListCounters(ctx context.Context) ([]string, error) {
+	var names []string
+	err := c.do(ctx, http.MethodGet, "/api/v1/counters", nil, nil, &names)
+	return names, err
+}
+
+// GetCounter returns a counter. Counters that don't exist are returned with zero values.
+func (c *Client) GetCounter(ctx context.Context, name string) (*Counter, error) {
+	var counter Counter
+	err := c.do(ctx, http.MethodGet, counterPath(name), nil, nil, &counter)
+	return &counter, err
+}
+
+// DeleteCounter deletes a counter and its history.
+func (c *Client) DeleteCounter(ctx context.Context, name string) (*Counter, error) {
+	var counter Counter
+	err := c.do(ctx, http.MethodDelete, counterPath(name), nil, nil, &counter)
+	return &counter, err
+}
+
+// ResetCounter sets wins, losses and draws of a counter to zero.
+func (c *Client) ResetCounter(ctx context.Context, name string) (*Counter, error) {
+	var counter Counter
+	err := c.do(ctx, http.MethodPost, counterPath(name)+"/reset", nil, nil, &counter)
+	return &counter, err
+}
+
+// UndoCounter reverts the most recent change to a counter. It fails with a 409 *Error
+// when there is nothing to undo.
+func (c *Client) UndoCounter(ctx context.Context, name string) (*Counter, error) {
+	var counter Counter
+	err := c.do(ctx, http.MethodPost, counterPath(name)+"/undo", nil, nil, &counter)
+	return &counter, err
+}
+
+// AdjustCounter sets wins, losses and draws of a counter to the given values.
+func (c *Client) AdjustCounter(ctx context.Context, name string, wins, losses, draws int) (*Counter, error) {
+	body, err := json.Marshal(map[string]int{"wins": wins, "losses": losses, "draws": draws})
+	if err != nil {
+		return nil, err
+	}
+
+	var counter Counter
+	err = c.do(ctx, http.MethodPost, counterPath(name)+"/adjust", nil, body, &counter)
+	return &counter, err
+}
+
+// Increment adds one to the given outcome of a counter, creating the counter if needed.
+func (c *Client) Increment(ctx context.Context, name string, outcome Outcome) (*Counter, error) {
+	var counter Counter
+	err := c.do(ctx, http.MethodPut, counterPath(name)+"/"+string(outcome), nil, nil, &counter)
+	return &counter, err
+}
+
+// Decrement removes one from the given outcome of a counter. Values never go below zero.
+func (c *Client) Decrement(ctx context.Context, name string, outcome Outcome) (*Counter, error) {
+	var counter Counter
+	err := c.do(ctx, http.MethodDelete, counterPath(name)+"/"+string(outcome), nil, nil, &counter)
+	return &counter, err
+}
+
+// Numerics returns one outcome of a counter as a Numerics counter widget.
+// An empty color uses the server's default for the outcome.
+func (c *Client) Numerics(ctx context.Context, name string, outcome Outcome, color string) (*numericsapp.CounterWidgetResponse, error) {
+	query := url.Values{"numerics": {""}}
+	if color != "" {
+		query.Set("color", color)
+	}
+
+	var widget numericsapp.CounterWidgetResponse
+	err := c.do(ctx, http.MethodGet, counterPath(name)+"/"+string(outcome), query, nil, &widget)
+	return &widget, err
+}
+
+// Shields returns a metric of a counter as a shields.io endpoint badge, colored by win rate.
+// metric is one of "record", "wins", "losses", "draws", "winrate" or "streak".
+func (c *Client) Shields(ctx context.Context, name, metric string) (*shieldsio.EndpointResponse, error) {
+	var endpoint shieldsio.EndpointResponse
+	err := c.do(ctx, http.MethodGet, counterPath(name)+"/shields", url.Values{"metric": {metric}}, nil, &endpoint)
+	return &endpoint, err
+}
+
+// History returns the recorded changes of a counter, oldest first.
+func (c *Client) History(ctx context.Context, name string) ([]HistoryEntry, error) {
+	var history []HistoryEntry
+	err := c.do(ctx, http.MethodGet, counterPath(name)+"/history", nil, nil, &history)
+	return history, err
+}
+
+// Chart returns the results and win rates of a counter over time. window is one of "24h", "7d",
+// "30d", "90d" or "all"; rolling is how many results the rolling win rate covers.
+func (c *Client) Chart(ctx context.Context, name, window string, rolling int) (*ChartSeries, error) {
+	query := url.Values{"window": {window}, "rolling": {strconv.Itoa(rolling)}}
+
+	var series ChartSeries
+	err := c.do(ctx, http.MethodGet, counterPath(name)+"/chart", query, nil, &series)
+	return &series, err
+}
+
+// Export returns every counter in the service's environment.
+func (c *Client) Export(ctx context.Context) (*Export, error) {
+	var doc Export
+	err := c.do(ctx, http.MethodGet, "/api/v1/export", nil, nil, &doc)
+	return &doc, err
+}
+
+// Import writes the counters of doc using one of the ImportMode conflict modes.
+func (c *Client) Import(ctx context.Context, doc *Export, mode string, dryRun bool) ([]ImportResult, error) {
+	query := url.Values{"mode": {mode}}
+	if dryRun {
+		query.Set("dry_run", "true")
+	}
+
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []ImportResult
+	err = c.do(ctx, http.MethodPost, "/api/v1/import", query, body, &results)
+	return results, err
+}
+
+// ListWebhooks returns every webhook, or only those of a counter if counter isn't empty. Secrets are omitted.
+func (c *Client) ListWebhooks(ctx context.Context, counter string) ([]Webhook, error) {
+	var query url.Values
+	if counter != "" {
+		query = url.Values{"counter": {counter}}
+	}
+
+	var hooks []Webhook
+	err := c.do(ctx, http.MethodGet, "/api/v1/webhooks", query, nil, &hooks)
+	return hooks, err
+}
+
+// CreateWebhook subscribes hook.URL to counter changes. The returned webhook is the only one
+// that includes the secret used to sign deliveries.
+func (c *Client) CreateWebhook(ctx context.Context, hook Webhook) (*Webhook, error) {
+	body, err := json.Marshal(hook)
+	if err != nil {
+		return nil, err
+	}
+
+	var created Webhook
+	err = c.do(ctx, http.MethodPost, "/api/v1/webhooks", nil, body, &created)
+	return &created, err
+}
+
+// DeleteWebhook removes a webhook and its delivery log.
+func (c *Client) DeleteWebhook(ctx context.Context, id string) error {
+	var deleted Webhook
+	return c.do(ctx, http.MethodDelete, "/api/v1/webhooks/"+url.PathEscape(id), nil, nil, &deleted)
+}
+
+// PingWebhook sends a ping event to a webhook and returns the ID of the delivery.
+func (c *Client) PingWebhook(ctx context.Context, id string) (string, error) {
+	var out struct {
+		Delivery string `json:"delivery"`
+	}
+	err := c.do(ctx, http.MethodPost, "/api/v1/webhooks/"+url.PathEscape(id)+"/ping", nil, nil, &out)
+	return out.Delivery, err
+}
+
+// WebhookDeliveries returns the delivery log of a webhook, newest first.
+func (c *Client) WebhookDeliveries(ctx context.Context, id string) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+	err := c.do(ctx, http.MethodGet, "/api/v1/webhooks/"+url.PathEscape(id)+"/deliveries", nil, nil, &deliveries)
+	return deliveries, err
+}
+
+func counterPath(name string) string {
+	return "/api/v1/counters/" + url.PathEscape(name)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body []byte, out interface{}) error {
+	target := c.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Password != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,133 @@
+package client
+
+import "time"
+
+// Outcome is one of the results a counter tracks.
+type Outcome string
+
+// The outcomes understood by the API, named after their route segment.
+const (
+	Win  Outcome = "win"
+	Loss Outcome = "loss"
+	Draw Outcome = "draw"
+)
+
+// Conflict modes accepted by Import.
+const (
+	ImportModeMerge     = "merge"
+	ImportModeOverwrite = "overwrite"
+	ImportModeSkip      = "skip"
+)
+
+// Counter is a counter as returned by the API.
+type Counter struct {
+	Name       string        `json:"name"`
+	PrettyName string        `json:"pretty_name,omitempty"`
+	Wins       int           `json:"wins"`
+	Losses     int           `json:"losses"`
+	Draws      int           `json:"draws"`
+	Theme      string        `json:"theme,omitempty"`
+	UpdatedAt  *time.Time    `json:"updated_at,omitempty"`
+	Links      *CounterLinks `json:"links,omitempty"`
+}
+
+// CounterLinks are the absolute self links of a counter.
+type CounterLinks struct {
+	Html           string `json:"html"`
+	Solo           string `json:"solo"`
+	Control        string `json:"control"`
+	Chart          string `json:"chart"`
+	Api            string `json:"api"`
+	History        string `json:"history"`
+	Win            string `json:"win"`
+	Loss           string `json:"loss"`
+	Draw           string `json:"draw"`
+	Reset          string `json:"reset"`
+	NumericsWins   string `json:"numerics_wins"`
+	NumericsLosses string `json:"numerics_losses"`
+	NumericsDraws  string `json:"numerics_draws"`
+}
+
+// HistoryEntry is a single recorded change to a counter.
+type HistoryEntry struct {
+	Time   time.Time `json:"time"`
+	Event  string    `json:"event"`
+	Delta  int       `json:"delta"`
+	Wins   int       `json:"wins"`
+	Losses int       `json:"losses"`
+	Draws  int       `json:"draws"`
+}
+
+// Export is the versioned backup document of every counter in an environment.
+type Export struct {
+	FormatVersion int                `json:"format_version"`
+	Env           string             `json:"env"`
+	AppVersion    string             `json:"app_version"`
+	ExportedAt    time.Time          `json:"exported_at"`
+	Counters      []*ExportedCounter `json:"counters,omitempty"`
+}
+
+// ExportedCounter is a single counter in an Export.
+type ExportedCounter struct {
+	Name       string         `json:"name"`
+	PrettyName string         `json:"pretty_name,omitempty"`
+	Wins       int            `json:"wins"`
+	Losses     int            `json:"losses"`
+	Draws      int            `json:"draws"`
+	Theme      string         `json:"theme,omitempty"`
+	History    []HistoryEntry `json:"history,omitempty"`
+}
+
+// ImportResult describes what an import did with one counter.
+type ImportResult struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	Wins   int    `json:"wins"`
+	Losses int    `json:"losses"`
+	Draws  int    `json:"draws"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ChartPoint is the state of a counter after one change.
+type ChartPoint struct {
+	Time           time.Time `json:"time"`
+	Wins           int       `json:"wins"`
+	Losses         int       `json:"losses"`
+	Draws          int       `json:"draws"`
+	WinRate        float64   `json:"winrate"`
+	RollingWinRate float64   `json:"rolling_winrate"`
+}
+
+// ChartSeries is the time series behind the chart of a counter.
+type ChartSeries struct {
+	Name    string       `json:"name"`
+	Window  string       `json:"window"`
+	Rolling int          `json:"rolling"`
+	From    time.Time    `json:"from"`
+	To      time.Time    `json:"to"`
+	Points  []ChartPoint `json:"points"`
+}
+
+// Webhook is a subscription to counter changes. Without a Counter it receives the events of every counter.
+type Webhook struct {
+	ID        string    `json:"id,omitempty"`
+	URL       string    `json:"url"`
+	Counter   string    `json:"counter,omitempty"`
+	Events    []string  `json:"events,omitempty"`
+	Format    string    `json:"format,omitempty"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is one attempt to deliver an event to a webhook.
+type WebhookDelivery struct {
+	Delivery   string    `json:"delivery"`
+	Event      string    `json:"event"`
+	Counter    string    `json:"counter"`
+	Time       time.Time `json:"time"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Success    bool      `json:"success"`
+	DurationMs int64     `json:"duration_ms"`
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/r35krag0th/win-loss-rux/client"
+	"github.com/sirupsen/logrus"
+)
+
+// TestClientAgainstRouter runs the typed client against the real router, backed by a fake Consul,
+// so a client path or payload that drifts from the routes fails here. The admin credentials are
+// set, so the export, import and webhook routes are live.
+func TestClientAgainstRouter(t *testing.T) {
+	useFakeConsul(t)
+	t.Setenv("ADMIN_USERNAME", "admin")
+	t.Setenv("ADMIN_PASSWORD", "s3cret")
+	t.Setenv("API_WRITE_PASSWORD", "")
+	server := httptest.NewServer(newRouter(logrus.NewEntry(logrus.StandardLogger()), nil))
+	defer server.Close()
+
+	ctx := context.Background()
+	api := client.New(server.URL)
+	api.Username, api.Password = "admin", "s3cret"
+
+	for _, outcome := range []client.Outcome{client.Win, client.Win, client.Loss} {
+		if _, err := api.Increment(ctx, "client-test", outcome); err != nil {
+			t.Fatalf("Increment(%s): %s", outcome, err)
+		}
+	}
+	counter, err := api.GetCounter(ctx, "client-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counter.Wins != 2 || counter.Losses != 1 || counter.Draws != 0 {
+		t.Errorf("counter = %d/%d/%d, want 2/1/0", counter.Wins, counter.Losses, counter.Draws)
+	}
+
+	history, err := api.History(ctx, "client-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 {
+		t.Errorf("history has %d entries, want 3", len(history))
+	}
+
+	counter, err = api.UndoCounter(ctx, "client-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counter.Losses != 0 {
+		t.Errorf("losses after undo = %d, want 0", counter.Losses)
+	}
+
+	names, err := api.ListCounters(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !containsString(names, "client-test") {
+		t.Errorf("ListCounters = %v, want client-test in it", names)
+	}
+
+	widget, err := api.Numerics(ctx, "client-test", client.Win, "blue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if widget.Data.Value != 2 {
+		t.Errorf("numerics value = %d, want 2", widget.Data.Value)
+	}
+
+	export, err := api.Export(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := api.Import(ctx, export, "skip", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Action != "skipped" {
+		t.Errorf("dry-run import of the export = %+v, want client-test skipped", results)
+	}
+
+	hooks, err := api.ListWebhooks(ctx, "")
+	if err != nil || len(hooks) != 0 {
+		t.Errorf("ListWebhooks = %+v, %v, want none", hooks, err)
+	}
+
+	_, err = api.PingWebhook(ctx, "missing")
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 404 || apiErr.Message != "Webhook not found" {
+		t.Errorf("PingWebhook(missing) = %v, want a 404 *client.Error saying the webhook was not found", err)
+	}
+
+	anonymous := client.New(server.URL)
+	if _, err = anonymous.PingWebhook(ctx, "missing"); !errors.As(err, &apiErr) || apiErr.StatusCode != 401 {
+		t.Errorf("PingWebhook without credentials = %v, want a 401 *client.Error", err)
+	}
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/gookit/rux"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Badge styles, named like their shields.io counterparts.
+const (
+	BadgeStyleFlat        = "flat"
+	BadgeStyleFlatSquare  = "flat-square"
+	BadgeStylePlastic     = "plastic"
+	BadgeStyleForTheBadge = "for-the-badge"
+)
+
+// Default badge colors.
+const (
+	defaultBadgeLabelColor = "#555555"
+	defaultBadgeColor      = "#007ec6"
+)
+
+// badgeColors are the named colors shields.io understands.
+var badgeColors = map[string]string{
+	"brightgreen":   "#44cc11",
+	"green":         "#97ca00",
+	"yellowgreen":   "#a4a61d",
+	"yellow":        "#dfb317",
+	"orange":        "#fe7d37",
+	"red":           "#e05d44",
+	"blue":          "#007ec6",
+	"grey":          "#555555",
+	"gray":          "#555555",
+	"lightgrey":     "#9f9f9f",
+	"lightgray":     "#9f9f9f",
+	"success":       "#44cc11",
+	"important":     "#fe7d37",
+	"critical":      "#e05d44",
+	"informational": "#007ec6",
+	"inactive":      "#9f9f9f",
+}
+
+// maxBadgeLabel keeps badges, and the PNGs rendered for them, at a sensible size.
+const maxBadgeLabel = 64
+
+var hexColor = regexp.MustCompile(`^#?([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// verdanaWidthRatio approximates how much wider Verdana, which SVG badges ask for, runs than
+// the Go font the text is measured with.
+const verdanaWidthRatio = 1.1
+
+// ParseBadgeColor turns a shields.io color name or a hex color (with or without "#") into "#rrggbb".
+func ParseBadgeColor(value string) (string, bool) {
+	if named, ok := badgeColors[strings.ToLower(value)]; ok {
+		return named, true
+	}
+	match := hexColor.FindStringSubmatch(value)
+	if match == nil {
+		return "", false
+	}
+	hex := strings.ToLower(match[1])
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	return "#" + hex, true
+}
+
+// Badge is a two part image such as "team-a | 12-4-1".
+type Badge struct {
+	Label      string
+	Message    string
+	LabelColor string
+	Color      string
+	Style      string
+}
+
+// NewBadgeFromQuery builds the badge of a counter from the metric, label, color, labelColor
+// and style query parameters.
+func NewBadgeFromQuery(c *rux.Context, counter *WinLossCounter) (*Badge, error) {
+	metric := c.Query("metric", MetricRecord)
+	message, ok := metricMessage(counter, metric)
+	if !ok {
+		return nil, fmt.Errorf("unsupported metric: %s", metric)
+	}
+
+	b := &Badge{
+		Label:   counter.PrettyName,
+		Message: message,
+		Style:   c.Query("style", BadgeStyleFlat),
+	}
+	if label, ok := c.QueryParam("label"); ok {
+		b.Label = label
+	}
+	if utf8.RuneCountInString(b.Label) > maxBadgeLabel {
+		return nil, fmt.Errorf("label must not be longer than %d characters", maxBadgeLabel)
+	}
+
+	switch b.Style {
+	case BadgeStyleFlat, BadgeStyleFlatSquare, BadgeStylePlastic, BadgeStyleForTheBadge:
+	default:
+		return nil, fmt.Errorf("unsupported style: %s", b.Style)
+	}
+
+	if b.LabelColor, ok = ParseBadgeColor(c.Query("labelColor", defaultBadgeLabelColor)); !ok {
+		return nil, fmt.Errorf("unsupported labelColor: %s", c.Query("labelColor"))
+	}
+	if b.Color, ok = ParseBadgeColor(c.Query("color", defaultBadgeColor)); !ok {
+		return nil, fmt.Errorf("unsupported color: %s", c.Query("color"))
+	}
+	return b, nil
+}
+
+// badgeLayout is the geometry shared by the SVG and PNG renderings.
+type badgeLayout struct {
+	label, message           string
+	labelWidth, messageWidth int
+	height                   int
+	radius                   int
+	fontSize                 float64
+	bold                     bool
+}
+
+func (b *Badge) layout() badgeLayout {
+	l := badgeLayout{
+		label:    b.Label,
+		message:  b.Message,
+		height:   20,
+		radius:   3,
+		fontSize: 11,
+	}
+	padding := 10
+	letterSpacing := 0
+
+	switch b.Style {
+	case BadgeStyleFlatSquare:
+		l.radius = 0
+	case BadgeStylePlastic:
+		l.height = 18
+		l.radius = 4
+	case BadgeStyleForTheBadge:
+		l.label = strings.ToUpper(l.label)
+		l.message = strings.ToUpper(l.message)
+		l.height = 28
+		l.radius = 0
+		l.fontSize = 10
+		l.bold = true
+		padding = 24
+		letterSpacing = 1
+	}
+
+	face := badgeFace(l.fontSize, l.bold)
+	l.labelWidth = int(math.Ceil(textWidth(face, l.label)*verdanaWidthRatio)) + padding + letterSpacing*utf8.RuneCountInString(l.label)
+	l.messageWidth = int(math.Ceil(textWidth(face, l.message)*verdanaWidthRatio)) + padding + letterSpacing*utf8.RuneCountInString(l.message)
+	if l.label == "" {
+		l.labelWidth = 0
+	}
+	return l
+}
+
+// badgePart is the label or the message half of a badge.
+type badgePart struct {
+	text       string
+	x, width   int
+	background string
+}
+
+func (l badgeLayout) parts(b *Badge) []badgePart {
+	return []badgePart{
+		{l.label, 0, l.labelWidth, b.LabelColor},
+		{l.message, l.labelWidth, l.messageWidth, b.Color},
+	}
+}
+
+// SVG renders the badge as an SVG image.
+func (b *Badge) SVG() []byte {
+	l := b.layout()
+	width := l.labelWidth + l.messageWidth
+	title := html.EscapeString(b.Message)
+	if b.Label != "" {
+		title = html.EscapeString(b.Label + ": " + b.Message)
+	}
+
+	out := bytes.Buffer{}
+	fmt.Fprintf(&out, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" role="img" aria-label="%s">`, width, l.height, title)
+	fmt.Fprintf(&out, `<title>%s</title>`, title)
+
+	switch b.Style {
+	case BadgeStyleFlat:
+		out.WriteString(`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`)
+	case BadgeStylePlastic:
+		out.WriteString(`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#fff" stop-opacity=".7"/><stop offset=".1" stop-color="#aaa" stop-opacity=".1"/><stop offset=".9" stop-opacity=".3"/><stop offset="1" stop-opacity=".5"/></linearGradient>`)
+	}
+
+	fmt.Fprintf(&out, `<clipPath id="r"><rect width="%d" height="%d" rx="%d" fill="#fff"/></clipPath>`, width, l.height, l.radius)
+	out.WriteString(`<g clip-path="url(#r)">`)
+	fmt.Fprintf(&out, `<rect width="%d" height="%d" fill="%s"/>`, l.labelWidth, l.height, b.LabelColor)
+	fmt.Fprintf(&out, `<rect x="%d" width="%d" height="%d" fill="%s"/>`, l.labelWidth, l.messageWidth, l.height, b.Color)
+	if b.Style == BadgeStyleFlat || b.Style == BadgeStylePlastic {
+		fmt.Fprintf(&out, `<rect width="%d" height="%d" fill="url(#s)"/>`, width, l.height)
+	}
+	out.WriteString(`</g>`)
+
+	weight := "normal"
+	spacing := "0"
+	if l.bold {
+		weight = "bold"
+		spacing = "1"
+	}
+	fmt.Fprintf(&out, `<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="%g" font-weight="%s" letter-spacing="%s">`, l.fontSize, weight, spacing)
+	baseline := float64(l.height)/2 + l.fontSize*0.35
+	for _, part := range l.parts(b) {
+		if part.text == "" {
+			continue
+		}
+		center := float64(part.x) + float64(part.width)/2
+		text := html.EscapeString(part.text)
+		if b.Style != BadgeStyleForTheBadge {
+			fmt.Fprintf(&out, `<text x="%.1f" y="%.1f" fill="#010101" fill-opacity=".3">%s</text>`, center, baseline+1, text)
+		}
+		fmt.Fprintf(&out, `<text x="%.1f" y="%.1f" fill="%s">%s</text>`, center, baseline, badgeTextColor(part.background), text)
+	}
+	out.WriteString(`</g></svg>`)
+	return out.Bytes()
+}
+
+// PNG renders the badge as a PNG image using the Go fonts.
+func (b *Badge) PNG() ([]byte, error) {
+	l := b.layout()
+	width := l.labelWidth + l.messageWidth
+	img := image.NewRGBA(image.Rect(0, 0, width, l.height))
+
+	labelColor := mustHexRGBA(b.LabelColor)
+	messageColor := mustHexRGBA(b.Color)
+	for y := 0; y < l.height; y++ {
+		for x := 0; x < width; x++ {
+			if !insideRoundedRect(x, y, width, l.height, l.radius) {
+				continue
+			}
+			c := messageColor
+			if x < l.labelWidth {
+				c = labelColor
+			}
+			img.SetRGBA(x, y, shade(c, b.Style, float64(y)/float64(l.height)))
+		}
+	}
+
+	face := badgeFace(l.fontSize, l.bold)
+	baseline := int(math.Round(float64(l.height)/2 + l.fontSize*0.35))
+	for _, part := range l.parts(b) {
+		if part.text == "" {
+			continue
+		}
+		x := part.x + (part.width-int(math.Round(textWidth(face, part.text))))/2
+		if b.Style != BadgeStyleForTheBadge {
+			drawText(img, face, part.text, x, baseline+1, color.RGBA{1, 1, 1, 77})
+		}
+		drawText(img, face, part.text, x, baseline, mustHexRGBA(badgeTextColor(part.background)))
+	}
+
+	out := bytes.Buffer{}
+	if err := png.Encode(&out, img); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// BadgeETag identifies a rendering of a counter's badge: the counter's modify index plus the
+// request's format and query, since both change the image.
+func BadgeETag(counter *WinLossCounter, format, rawQuery string) string {
+	h := fnv.New64a()
+	h.Write([]byte(counter.Name + "\x00" + format + "\x00" + rawQuery))
+	return fmt.Sprintf(`"%d-%x"`, counter.ModifyIndex(), h.Sum64())
+}
+
+// ServeBadge writes a rendered badge with caching headers, answering 304 when the client's copy is current.
+func ServeBadge(c *rux.Context, etag, contentType string, body []byte) {
+	c.SetHeader("ETag", etag)
+	c.SetHeader("Cache-Control", "public, max-age=60, must-revalidate")
+	if match := c.Req.Header.Get("If-None-Match"); match != "" && match == etag {
+		c.SetStatus(304)
+		return
+	}
+	c.Blob(200, contentType, body)
+}
+
+// badgeTextColor picks black or white text, whichever reads better on the background.
+func badgeTextColor(background string) string {
+	c := mustHexRGBA(background)
+	luminance := 0.299*float64(c.R) + 0.587*float64(c.G) + 0.114*float64(c.B)
+	if luminance > 186 {
+		return "#333333"
+	}
+	return "#ffffff"
+}
+
+var (
+	badgeFontsOnce sync.Once
+	badgeRegular   *opentype.Font
+	badgeBold      *opentype.Font
+)
+
+// badgeFace returns the Go font at the given size. Parsed fonts are shared, but faces aren't safe
+// for concurrent use, so every rendering gets its own.
+func badgeFace(size float64, bold bool) font.Face {
+	badgeFontsOnce.Do(func() {
+		var err error
+		if badgeRegular, err = opentype.Parse(goregular.TTF); err == nil {
+			badgeBold, err = opentype.Parse(gobold.TTF)
+		}
+		if err != nil {
+			panic(fmt.Sprintf("bundled Go font is invalid: %s", err))
+		}
+	})
+
+	parsed := badgeRegular
+	if bold {
+		parsed = badgeBold
+	}
+	face, err := opentype.NewFace(parsed, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		panic(fmt.Sprintf("bundled Go font is invalid: %s", err))
+	}
+	return face
+}
+
+func textWidth(face font.Face, text string) float64 {
+	return float64(font.MeasureString(face, text)) / 64
+}
+
+func drawText(img draw.Image, face font.Face, text string, x, y int, c color.Color) {
+	d := font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(c),
+		Face: face,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(text)
+}
+
+// insideRoundedRect reports whether the pixel at x, y lies in a width by height rectangle with rounded corners.
+func insideRoundedRect(x, y, width, height, radius int) bool {
+	if radius == 0 {
+		return true
+	}
+	cx, cy := -1, -1
+	switch {
+	case x < radius:
+		cx = radius
+	case x >= width-radius:
+		cx = width - radius - 1
+	}
+	switch {
+	case y < radius:
+		cy = radius
+	case y >= height-radius:
+		cy = height - radius - 1
+	}
+	if cx < 0 || cy < 0 {
+		return true
+	}
+	dx, dy := float64(x-cx), float64(y-cy)
+	return dx*dx+dy*dy <= float64(radius*radius)
+}
+
+// shade applies the style's vertical gradient to a background color at the relative height pos.
+func shade(c color.RGBA, style string, pos float64) color.RGBA {
+	var amount float64
+	switch style {
+	case BadgeStyleFlat:
+		amount = 0.05 - 0.1*pos
+	case BadgeStylePlastic:
+		amount = 0.25 - 0.5*pos
+	default:
+		return c
+	}
+
+	blend := func(v uint8) uint8 {
+		if amount > 0 {
+			return uint8(float64(v) + (255-float64(v))*amount)
+		}
+		return uint8(float64(v) * (1 + amount))
+	}
+	return color.RGBA{R: blend(c.R), G: blend(c.G), B: blend(c.B), A: 255}
+}
+
+// mustHexRGBA converts a color returned by ParseBadgeColor.
+func mustHexRGBA(hex string) color.RGBA {
+	var r, g, b uint8
+	fmt.Sscanf(hex, "#%02x%02x%02x", &r, &g, &b)
+	return color.RGBA{R: r, G: g, B: b, A: 255}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBadges(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		status      int
+		ariaLabel   string
+		fill        string
+		height      int
+		errorSubstr string
+	}{
+		{"record", "", 200, "Team A: 2-1-0", "#007ec6", 20, ""},
+		{"win rate without a label", "?metric=winrate&label=&color=red", 200, "66.7%", "#e05d44", 20, ""},
+		{"hex colors", "?label=wld&color=abc&labelColor=%23123456", 200, "wld: 2-1-0", "#aabbcc", 20, ""},
+		{"for the badge", "?style=for-the-badge", 200, "Team A: 2-1-0", "#007ec6", 28, ""},
+		{"unknown metric", "?metric=elo", 400, "", "", 0, "unsupported metric: elo"},
+		{"unknown style", "?style=round", 400, "", "", 0, "unsupported style: round"},
+		{"unknown color", "?color=glitter", 400, "", "", 0, "unsupported color: glitter"},
+		{"label too long", "?label=" + strings.Repeat("x", maxBadgeLabel+1), 400, "", "", 0, "label must not be longer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, consul := apiTestRouter(t, "")
+			consul.Put(consulKeyPrefix+"/team-a", `{"schema_version":1,"name":"team-a","pretty_name":"Team A","wins":2,"losses":1,"draws":0}`)
+
+			svg := httptest.NewRecorder()
+			r.ServeHTTP(svg, httptest.NewRequest(http.MethodGet, "/counters/team-a/badge.svg"+tt.query, nil))
+			if svg.Code != tt.status {
+				t.Fatalf("svg status = %d, want %d: %s", svg.Code, tt.status, svg.Body.String())
+			}
+			if tt.status != 200 {
+				if !strings.Contains(svg.Body.String(), tt.errorSubstr) {
+					t.Errorf("error = %q, want %q", svg.Body.String(), tt.errorSubstr)
+				}
+				return
+			}
+			body := svg.Body.String()
+			if !strings.Contains(body, fmt.Sprintf(`aria-label="%s"`, tt.ariaLabel)) {
+				t.Errorf("svg is not labelled %q: %s", tt.ariaLabel, body)
+			}
+			if !strings.Contains(body, fmt.Sprintf(`fill="%s"/>`, tt.fill)) {
+				t.Errorf("svg has no %s part: %s", tt.fill, body)
+			}
+
+			pngResponse := httptest.NewRecorder()
+			r.ServeHTTP(pngResponse, httptest.NewRequest(http.MethodGet, "/counters/team-a/badge.png"+tt.query, nil))
+			if pngResponse.Code != 200 || pngResponse.Header().Get("Content-Type") != "image/png" {
+				t.Fatalf("png status = %d, content type %q", pngResponse.Code, pngResponse.Header().Get("Content-Type"))
+			}
+			img, err := png.Decode(bytes.NewReader(pngResponse.Body.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Both formats share one layout
+			size := img.Bounds().Size()
+			if want := fmt.Sprintf(`width="%d" height="%d"`, size.X, tt.height); size.Y != tt.height || !strings.Contains(body, want) {
+				t.Errorf("png is %dx%d, svg starts %.120s", size.X, size.Y, body)
+			}
+		})
+	}
+}
+
+func TestBadgeETag(t *testing.T) {
+	r, consul := apiTestRouter(t, "")
+	consul.Put(consulKeyPrefix+"/team-a", `{"schema_version":1,"name":"team-a","wins":2,"losses":1,"draws":0}`)
+
+	get := func(path, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	etag := get("/counters/team-a/badge.svg", "").Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+	if w := get("/counters/team-a/badge.svg", etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("unchanged badge = %d with %d bytes, want an empty 304", w.Code, w.Body.Len())
+	}
+	if w := get("/counters/team-a/badge.svg?style=plastic", etag); w.Code != http.StatusOK {
+		t.Errorf("badge with another query = %d, want 200", w.Code)
+	}
+	if w := get("/counters/team-a/badge.png", etag); w.Code != http.StatusOK {
+		t.Errorf("badge in another format = %d, want 200", w.Code)
+	}
+
+	apiRequest{method: http.MethodPut, path: "/api/v1/counters/team-a/win"}.serve(r)
+	if w := get("/counters/team-a/badge.svg", etag); w.Code != http.StatusOK {
+		t.Errorf("badge of a changed counter = %d, want 200", w.Code)
+	}
+}
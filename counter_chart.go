@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gookit/rux"
+)
+
+// Windows the chart can be limited to, as accepted by the window query parameter.
+const (
+	ChartWindowDay     = "24h"
+	ChartWindowWeek    = "7d"
+	ChartWindowMonth   = "30d"
+	ChartWindowQuarter = "90d"
+	ChartWindowAll     = "all"
+)
+
+// chartWindows maps every window to how far back it reaches. Zero means the whole history.
+var chartWindows = map[string]time.Duration{
+	ChartWindowDay:     24 * time.Hour,
+	ChartWindowWeek:    7 * 24 * time.Hour,
+	ChartWindowMonth:   30 * 24 * time.Hour,
+	ChartWindowQuarter: 90 * 24 * time.Hour,
+	ChartWindowAll:     0,
+}
+
+// ChartWindowNames lists the windows in the order they are offered on the chart page.
+var ChartWindowNames = []string{ChartWindowDay, ChartWindowWeek, ChartWindowMonth, ChartWindowQuarter, ChartWindowAll}
+
+// defaultChartRolling is how many results the rolling win rate covers unless a request asks otherwise.
+const defaultChartRolling = 10
+
+// chartQuery reads the window and rolling query parameters shared by the chart page and its JSON endpoint.
+func chartQuery(c *rux.Context) (string, int, error) {
+	window := c.Query("window", ChartWindowAll)
+	if !ValidChartWindow(window) {
+		return "", 0, fmt.Errorf("unsupported window: %s", window)
+	}
+	rolling, err := strconv.Atoi(c.Query("rolling", strconv.Itoa(defaultChartRolling)))
+	if err != nil || rolling < 1 || rolling > maxHistoryEntries {
+		return "", 0, fmt.Errorf("rolling must be a number between 1 and %d", maxHistoryEntries)
+	}
+	return window, rolling, nil
+}
+
+// ValidChartWindow reports whether window is one of the supported chart windows.
+func ValidChartWindow(window string) bool {
+	_, ok := chartWindows[window]
+	return ok
+}
+
+// ChartPoint is the state of a counter after one change.
+type ChartPoint struct {
+	Time           time.Time `json:"time"`
+	Wins           int       `json:"wins"`
+	Losses         int       `json:"losses"`
+	Draws          int       `json:"draws"`
+	WinRate        float64   `json:"winrate"`
+	RollingWinRate float64   `json:"rolling_winrate"`
+}
+
+// ChartSeries is the time series behind the chart of a counter.
+type ChartSeries struct {
+	Name    string       `json:"name"`
+	Window  string       `json:"window"`
+	Rolling int          `json:"rolling"`
+	From    time.Time    `json:"from"`
+	To      time.Time    `json:"to"`
+	Points  []ChartPoint `json:"points"`
+}
+
+// ChartSeries builds the cumulative W/L/D and win rates of the counter over window, ending at now.
+// The rolling win rate covers the last rolling results that are still counted.
+func (w WinLossCounter) ChartSeries(window string, rolling int, now time.Time) *ChartSeries {
+	return chartSeriesOf(w.Name, w.History(), window, rolling, now)
+}
+
+func chartSeriesOf(name string, history []HistoryEntry, window string, rolling int, now time.Time) *ChartSeries {
+	if rolling <= 0 {
+		rolling = defaultChartRolling
+	}
+	now = now.UTC()
+
+	series := &ChartSeries{
+		Name:    name,
+		Window:  window,
+		Rolling: rolling,
+		To:      now,
+		Points:  []ChartPoint{},
+	}
+
+	// Replaying the whole history, not just the window, keeps the rolling win rate right at the
+	// start of the window. The results are replayed once, one entry at a time.
+	all := make([]ChartPoint, 0, len(history))
+	replayed := []string{}
+	for _, entry := range history {
+		replayed = replayResult(replayed, entry)
+		results := replayed
+		if len(results) > rolling {
+			results = results[len(results)-rolling:]
+		}
+		wins := 0
+		for _, result := range results {
+			if result == HistoryEventWin {
+				wins++
+			}
+		}
+
+		point := ChartPoint{
+			Time:    entry.Time.UTC(),
+			Wins:    entry.Wins,
+			Losses:  entry.Losses,
+			Draws:   entry.Draws,
+			WinRate: winRatePercent(entry.Wins, entry.Losses, entry.Draws),
+		}
+		if len(results) > 0 {
+			point.RollingWinRate = winRatePercent(wins, len(results)-wins, 0)
+		}
+		all = append(all, point)
+	}
+
+	if len(all) == 0 {
+		series.From = now
+		return series
+	}
+
+	series.From = all[0].Time
+	if reach := chartWindows[window]; reach > 0 {
+		series.From = now.Add(-reach)
+	}
+
+	// The window starts with the values the counter had at that moment, if it existed yet.
+	first := sort.Search(len(all), func(i int) bool { return !all[i].Time.Before(series.From) })
+	if first > 0 {
+		start := all[first-1]
+		start.Time = series.From
+		series.Points = append(series.Points, start)
+	}
+	series.Points = append(series.Points, all[first:]...)
+
+	// Carry the current values on to the end of the window.
+	if len(series.Points) > 0 {
+		end := series.Points[len(series.Points)-1]
+		if end.Time.Before(now) {
+			end.Time = now
+			series.Points = append(series.Points, end)
+		}
+	}
+	return series
+}
+
+// Chart colors of the individual lines. Axes and labels use the theme's colors.
+const (
+	chartColorWins    = "#4caf50"
+	chartColorLosses  = "#e05050"
+	chartColorDraws   = "#9e9e9e"
+	chartColorWinRate = "#42a5f5"
+)
+
+// chartLayout is the geometry of the SVG chart.
+type chartLayout struct {
+	width, height       float64
+	left, right         float64
+	top, split, bottom  float64
+	from, to            time.Time
+	maxCount            int
+	countTop, countBase float64
+	rateTop, rateBase   float64
+}
+
+func (l chartLayout) x(t time.Time) float64 {
+	span := l.to.Sub(l.from)
+	if span <= 0 {
+		return (l.left + l.width - l.right) / 2
+	}
+	return l.left + float64(t.Sub(l.from))/float64(span)*(l.width-l.left-l.right)
+}
+
+func (l chartLayout) countY(v int) float64 {
+	return l.countBase - float64(v)/float64(l.maxCount)*(l.countBase-l.countTop)
+}
+
+func (l chartLayout) rateY(v float64) float64 {
+	return l.rateBase - v/100*(l.rateBase-l.rateTop)
+}
+
+// RenderChartSVG draws the series as an SVG image: cumulative W/L/D on top and the win rates below.
+// Text and axes use CSS variables of the theme so the chart blends into the page it is embedded in.
+func RenderChartSVG(series *ChartSeries, width, height int) template.HTML {
+	l := chartLayout{
+		width:  float64(width),
+		height: float64(height),
+		left:   48,
+		right:  16,
+		top:    24,
+		bottom: 32,
+		from:   series.From,
+		to:     series.To,
+	}
+	l.split = l.top + (l.height-l.top-l.bottom)*0.55
+	l.countTop, l.countBase = l.top, l.split-16
+	l.rateTop, l.rateBase = l.split+8, l.height-l.bottom
+
+	l.maxCount = 1
+	for _, p := range series.Points {
+		for _, v := range []int{p.Wins, p.Losses, p.Draws} {
+			if v > l.maxCount {
+				l.maxCount = v
+			}
+		}
+	}
+
+	out := bytes.Buffer{}
+	fmt.Fprintf(&out, `<svg xmlns="http://www.w3.org/2000/svg" class="chart" width="%d" height="%d" viewBox="0 0 %d %d" font-size="12">`, width, height, width, height)
+	out.WriteString(`<style>.axis{stroke:var(--wl-secondary,#888);stroke-width:1}.grid{stroke:var(--wl-secondary,#888);stroke-opacity:.25}text{fill:var(--wl-primary,#000);font-family:var(--wl-font,sans-serif)}.line{fill:none;stroke-width:2}</style>`)
+
+	// Axes and grid lines
+	plotRight := l.width - l.right
+	for _, y := range []float64{l.countBase, l.rateBase} {
+		fmt.Fprintf(&out, `<line class="axis" x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f"/>`, l.left, y, plotRight, y)
+	}
+	fmt.Fprintf(&out, `<line class="axis" x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f"/>`, l.left, l.countTop, l.left, l.countBase)
+	fmt.Fprintf(&out, `<line class="axis" x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f"/>`, l.left, l.rateTop, l.left, l.rateBase)
+	for _, v := range []int{0, l.maxCount / 2, l.maxCount} {
+		y := l.countY(v)
+		fmt.Fprintf(&out, `<line class="grid" x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f"/>`, l.left, y, plotRight, y)
+		fmt.Fprintf(&out, `<text x="%.1f" y="%.1f" text-anchor="end" dominant-baseline="middle">%d</text>`, l.left-6, y, v)
+	}
+	for _, v := range []float64{0, 50, 100} {
+		y := l.rateY(v)
+		fmt.Fprintf(&out, `<line class="grid" x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f"/>`, l.left, y, plotRight, y)
+		fmt.Fprintf(&out, `<text x="%.1f" y="%.1f" text-anchor="end" dominant-baseline="middle">%.0f%%</text>`, l.left-6, y, v)
+	}
+
+	// Time labels at the start, middle and end of the window
+	layout := "Jan 2 15:04"
+	if l.to.Sub(l.from) > 7*24*time.Hour {
+		layout = "Jan 2"
+	}
+	mid := l.from.Add(l.to.Sub(l.from) / 2)
+	for i, t := range []time.Time{l.from, mid, l.to} {
+		anchor := []string{"start", "middle", "end"}[i]
+		fmt.Fprintf(&out, `<text x="%.1f" y="%.1f" text-anchor="%s">%s</text>`, l.x(t), l.height-10, anchor, html.EscapeString(t.Format(layout)))
+	}
+
+	if len(series.Points) == 0 {
+		fmt.Fprintf(&out, `<text x="%.1f" y="%.1f" text-anchor="middle">No results recorded</text>`, l.width/2, l.countTop+(l.countBase-l.countTop)/2)
+	}
+
+	counts := []struct {
+		color string
+		value func(ChartPoint) int
+	}{
+		{chartColorWins, func(p ChartPoint) int { return p.Wins }},
+		{chartColorLosses, func(p ChartPoint) int { return p.Losses }},
+		{chartColorDraws, func(p ChartPoint) int { return p.Draws }},
+	}
+	for _, count := range counts {
+		writePolyline(&out, count.color, "", series.Points, func(p ChartPoint) float64 { return l.countY(count.value(p)) }, l)
+	}
+	writePolyline(&out, chartColorWinRate, "4 3", series.Points, func(p ChartPoint) float64 { return l.rateY(p.WinRate) }, l)
+	writePolyline(&out, chartColorWinRate, "", series.Points, func(p ChartPoint) float64 { return l.rateY(p.RollingWinRate) }, l)
+
+	// Legend
+	legend := []struct{ color, dash, label string }{
+		{chartColorWins, "", "Wins"},
+		{chartColorLosses, "", "Losses"},
+		{chartColorDraws, "", "Draws"},
+		{chartColorWinRate, "4 3", "Win rate"},
+		{chartColorWinRate, "", fmt.Sprintf("Last %d", series.Rolling)},
+	}
+	x := l.left
+	for _, item := range legend {
+		fmt.Fprintf(&out, `<line class="line" x1="%.1f" y1="10" x2="%.1f" y2="10" stroke="%s" stroke-dasharray="%s"/>`, x, x+16, item.color, item.dash)
+		fmt.Fprintf(&out, `<text x="%.1f" y="10" dominant-baseline="middle">%s</text>`, x+20, html.EscapeString(item.label))
+		x += 28 + float64(len(item.label))*7
+	}
+
+	out.WriteString(`</svg>`)
+	return template.HTML(out.String())
+}
+
+// writePolyline draws one series as a step line, since values only change when a result is recorded.
+func writePolyline(out *bytes.Buffer, color, dash string, points []ChartPoint, y func(ChartPoint) float64, l chartLayout) {
+	if len(points) == 0 {
+		return
+	}
+	fmt.Fprintf(out, `<polyline class="line" stroke="%s" stroke-dasharray="%s" points="`, color, dash)
+	for i, p := range points {
+		if i > 0 {
+			fmt.Fprintf(out, "%.1f,%.1f ", l.x(p.Time), y(points[i-1]))
+		}
+		fmt.Fprintf(out, "%.1f,%.1f ", l.x(p.Time), y(p))
+	}
+	out.WriteString(`"/>`)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChartSeries(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	ago := func(d time.Duration) time.Time { return now.Add(-d) }
+	day := 24 * time.Hour
+	history := []HistoryEntry{
+		{Time: ago(10 * day), Event: HistoryEventWin, Delta: 1, Wins: 1},
+		{Time: ago(9 * day), Event: HistoryEventWin, Delta: 1, Wins: 2},
+		{Time: ago(3 * day), Event: HistoryEventLoss, Delta: 1, Wins: 2, Losses: 1},
+		{Time: ago(2 * day), Event: HistoryEventWin, Delta: 1, Wins: 3, Losses: 1},
+		{Time: ago(time.Hour), Event: HistoryEventLoss, Delta: -1, Wins: 3},
+		{Time: ago(30 * time.Minute), Event: HistoryEventDraw, Delta: 1, Wins: 3, Draws: 1},
+	}
+
+	// Points are written as "<age> <wins>-<losses>-<draws> <rolling win rate>"
+	tests := []struct {
+		name    string
+		history []HistoryEntry
+		window  string
+		rolling int
+		from    time.Time
+		want    []string
+	}{
+		{"whole history", history, ChartWindowAll, 2, ago(10 * day), []string{
+			"240h0m0s 1-0-0 100.0",
+			"216h0m0s 2-0-0 100.0",
+			"72h0m0s 2-1-0 50.0",
+			"48h0m0s 3-1-0 50.0",
+			"1h0m0s 3-0-0 100.0",
+			"30m0s 3-0-1 50.0",
+			"0s 3-0-1 50.0",
+		}},
+		{"week starts with the values it had then", history, ChartWindowWeek, 2, ago(7 * day), []string{
+			"168h0m0s 2-0-0 100.0",
+			"72h0m0s 2-1-0 50.0",
+			"48h0m0s 3-1-0 50.0",
+			"1h0m0s 3-0-0 100.0",
+			"30m0s 3-0-1 50.0",
+			"0s 3-0-1 50.0",
+		}},
+		{"day", history, ChartWindowDay, 2, ago(day), []string{
+			"24h0m0s 3-1-0 50.0",
+			"1h0m0s 3-0-0 100.0",
+			"30m0s 3-0-1 50.0",
+			"0s 3-0-1 50.0",
+		}},
+		{"rolling over more results than there are", history, ChartWindowDay, 10, ago(day), []string{
+			"24h0m0s 3-1-0 75.0",
+			"1h0m0s 3-0-0 100.0",
+			"30m0s 3-0-1 75.0",
+			"0s 3-0-1 75.0",
+		}},
+		{"reset clears the rolling results", []HistoryEntry{
+			{Time: ago(2 * time.Hour), Event: HistoryEventLoss, Delta: 1, Losses: 1},
+			{Time: ago(time.Hour), Event: HistoryEventReset},
+			{Time: ago(time.Minute), Event: HistoryEventWin, Delta: 1, Wins: 1},
+		}, ChartWindowAll, 10, ago(2 * time.Hour), []string{
+			"2h0m0s 0-1-0 0.0",
+			"1h0m0s 0-0-0 0.0",
+			"1m0s 1-0-0 100.0",
+			"0s 1-0-0 100.0",
+		}},
+		{"no history", nil, ChartWindowWeek, 10, now, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			series := chartSeriesOf("team-a", tt.history, tt.window, tt.rolling, now)
+			if !series.From.Equal(tt.from) || !series.To.Equal(now) {
+				t.Errorf("series spans %s to %s, want %s to %s", series.From, series.To, tt.from, now)
+			}
+			got := []string{}
+			for _, point := range series.Points {
+				got = append(got, fmt.Sprintf("%s %d-%d-%d %.1f", now.Sub(point.Time), point.Wins, point.Losses, point.Draws, point.RollingWinRate))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("points =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
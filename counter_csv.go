@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gookit/rux"
+)
+
+// csvContentType is the media type used for all CSV responses.
+const csvContentType = "text/csv; charset=utf-8"
+
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// wantsCSV reports whether the request asked for CSV, either with ?format=csv or an Accept header.
+func wantsCSV(c *rux.Context) bool {
+	if format, ok := c.QueryParam("format"); ok {
+		return format == "csv"
+	}
+	return strings.Contains(c.Header("Accept"), "text/csv")
+}
+
+// csvFilename builds a download filename such as "my-counter-history-2006-01-02.csv".
+func csvFilename(parts ...string) string {
+	cleaned := make([]string, 0, len(parts)+1)
+	for _, part := range parts {
+		part = strings.Trim(unsafeFilenameChars.ReplaceAllString(part, "-"), "-")
+		if part != "" {
+			cleaned = append(cleaned, part)
+		}
+	}
+	cleaned = append(cleaned, time.Now().UTC().Format("2006-01-02"))
+	return strings.Join(cleaned, "-") + ".csv"
+}
+
+// startCSVResponse sets the headers of a CSV download and returns a writer for the response body.
+func startCSVResponse(c *rux.Context, filename string) *csv.Writer {
+	c.SetHeader("Content-Type", csvContentType)
+	c.SetHeader("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.SetStatus(200)
+	return csv.NewWriter(c.Resp)
+}
+
+// WriteCountersCSV writes one row per counter with its name, pretty name, W/L/D and win rate.
+func WriteCountersCSV(out *csv.Writer, counters []*WinLossCounter) error {
+	err := out.Write([]string{"name", "pretty_name", "wins", "losses", "draws", "win_rate"})
+	if err != nil {
+		return err
+	}
+
+	for _, counter := range counters {
+		err = out.Write([]string{
+			counter.Name,
+			counter.PrettyName,
+			strconv.Itoa(counter.Wins),
+			strconv.Itoa(counter.Losses),
+			strconv.Itoa(counter.Draws),
+			strconv.FormatFloat(counter.WinRate(), 'f', 4, 64),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+// WriteHistoryCSV writes one row per history entry, flushing as it goes so large histories are streamed.
+func WriteHistoryCSV(out *csv.Writer, history []HistoryEntry) error {
+	err := out.Write([]string{"time", "event", "delta", "wins", "losses", "draws"})
+	if err != nil {
+		return err
+	}
+
+	for i, entry := range history {
+		err = out.Write([]string{
+			entry.Time.Format(time.RFC3339),
+			entry.Event,
+			strconv.Itoa(entry.Delta),
+			strconv.Itoa(entry.Wins),
+			strconv.Itoa(entry.Losses),
+			strconv.Itoa(entry.Draws),
+		})
+		if err != nil {
+			return err
+		}
+
+		if i%100 == 99 {
+			out.Flush()
+			if err = out.Error(); err != nil {
+				return err
+			}
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/r35krag0th/win-loss-rux/version"
+	"github.com/sirupsen/logrus"
+)
+
+// CounterExportFormatVersion is the version of the export document written by ExportCounters.
+// Bump it whenever the layout of CounterExport or ExportedCounter changes.
+const CounterExportFormatVersion = 1
+
+// Conflict modes understood by ImportCounters.
+const (
+	ImportModeMerge     = "merge"
+	ImportModeOverwrite = "overwrite"
+	ImportModeSkip      = "skip"
+)
+
+// Actions reported back by ImportCounters for every counter in the document.
+const (
+	ImportActionCreated     = "created"
+	ImportActionMerged      = "merged"
+	ImportActionOverwritten = "overwritten"
+	ImportActionSkipped     = "skipped"
+	ImportActionFailed      = "failed"
+)
+
+// CounterExport is the versioned document used to back up and move counters between environments.
+// As NDJSON the document is written as a header line (without counters) followed by one counter per line.
+type CounterExport struct {
+	FormatVersion int                `json:"format_version"`
+	Env           string             `json:"env"`
+	AppVersion    string             `json:"app_version"`
+	ExportedAt    time.Time          `json:"exported_at"`
+	Counters      []*ExportedCounter `json:"counters,omitempty"`
+}
+
+// ExportedCounter is a single counter as it appears in a CounterExport.
+type ExportedCounter struct {
+	Name       string         `json:"name"`
+	PrettyName string         `json:"pretty_name,omitempty"`
+	Wins       int            `json:"wins"`
+	Losses     int            `json:"losses"`
+	Draws      int            `json:"draws"`
+	Theme      string         `json:"theme,omitempty"`
+	History    []HistoryEntry `json:"history,omitempty"`
+}
+
+// ImportResult describes what ImportCounters did (or would do, for a dry run) with one counter.
+type ImportResult struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	Wins   int    `json:"wins"`
+	Losses int    `json:"losses"`
+	Draws  int    `json:"draws"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ValidImportMode reports whether mode is one of the supported conflict modes.
+func ValidImportMode(mode string) bool {
+	switch mode {
+	case ImportModeMerge, ImportModeOverwrite, ImportModeSkip:
+		return true
+	}
+	return false
+}
+
+// ExportCounters loads every counter in the current APP_ENV from the storage backend (Consul).
+// Any failure to read a counter fails the whole export, so a backup is never silently incomplete.
+func ExportCounters(consulClient *api.Client) (*CounterExport, error) {
+	logger := logrus.WithFields(logrus.Fields{
+		"func":    "ExportCounters",
+		"version": version.Version,
+	})
+
+	helper := NewWinLossCounter("")
+	helper.SetConsulClient(consulClient)
+
+	doc := &CounterExport{
+		FormatVersion: CounterExportFormatVersion,
+		Env:           envName,
+		AppVersion:    version.Version,
+		ExportedAt:    time.Now().UTC(),
+		Counters:      []*ExportedCounter{},
+	}
+
+	names, err := helper.listAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list counters: %w", err)
+	}
+	for _, name := range names {
+		logger.Debugf("Exporting counter: %s", name)
+		counter := NewWinLossCounter(name)
+		counter.SetConsulClient(consulClient)
+		found, err := counter.load()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load counter %s: %w", name, err)
+		}
+		if !found {
+			// Deleted since it was listed
+			continue
+		}
+		history, err := counter.loadHistory()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load history of counter %s: %w", name, err)
+		}
+
+		doc.Counters = append(doc.Counters, &ExportedCounter{
+			Name:       counter.Name,
+			PrettyName: counter.PrettyName,
+			Wins:       counter.Wins,
+			Losses:     counter.Losses,
+			Draws:      counter.Draws,
+			Theme:      counter.Theme,
+			History:    history,
+		})
+	}
+
+	logger.Infof("Exported %d counters", len(doc.Counters))
+	return doc, nil
+}
+
+// WriteJSON writes the export as a single indented JSON document.
+func (e *CounterExport) WriteJSON(out io.Writer) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(e)
+}
+
+// WriteNDJSON writes the export as a header line followed by one line per counter.
+func (e *CounterExport) WriteNDJSON(out io.Writer) error {
+	enc := json.NewEncoder(out)
+
+	header := *e
+	header.Counters = nil
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+
+	for _, counter := range e.Counters {
+		if err := enc.Encode(counter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadCounterExport parses an export written by either WriteJSON or WriteNDJSON.
+func ReadCounterExport(in io.Reader) (*CounterExport, error) {
+	dec := json.NewDecoder(in)
+
+	var doc CounterExport
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to read export header: %w", err)
+	}
+	if doc.FormatVersion == 0 {
+		return nil, errors.New("export is missing format_version")
+	}
+	if doc.FormatVersion > CounterExportFormatVersion {
+		return nil, fmt.Errorf("export format_version %d is newer than supported version %d", doc.FormatVersion, CounterExportFormatVersion)
+	}
+
+	// NDJSON: every value after the header is a single counter.
+	for {
+		var counter ExportedCounter
+		err := dec.Decode(&counter)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read exported counter: %w", err)
+		}
+		doc.Counters = append(doc.Counters, &counter)
+	}
+
+	for _, counter := range doc.Counters {
+		if counter.Name == "" {
+			return nil, errors.New("export contains a counter without a name")
+		}
+	}
+
+	return &doc, nil
+}
+
+// ImportCounters writes the counters, and their history, of an export into the storage backend (Consul).
+// Counters that already exist are handled according to mode: merge adds the imported values
+// to the existing ones and interleaves the histories, overwrite replaces them, and skip leaves
+// them untouched.
+// A counter that can't be loaded or saved is reported as failed, with its error, and the import
+// carries on with the next one.
+// When dryRun is true nothing is written, but the returned results describe what would happen.
+func ImportCounters(consulClient *api.Client, doc *CounterExport, mode string, dryRun bool) ([]ImportResult, error) {
+	logger := logrus.WithFields(logrus.Fields{
+		"func":    "ImportCounters",
+		"mode":    mode,
+		"dry_run": dryRun,
+		"version": version.Version,
+	})
+
+	if !ValidImportMode(mode) {
+		return nil, fmt.Errorf("unknown import mode: %s", mode)
+	}
+
+	results := []ImportResult{}
+	for _, imported := range doc.Counters {
+		counter := NewWinLossCounter(imported.Name)
+		counter.SetConsulClient(consulClient)
+
+		exists, err := counter.Exists()
+		if err != nil {
+			return results, err
+		}
+
+		action := ImportActionCreated
+		if exists {
+			if _, err := counter.load(); err != nil {
+				logger.WithField("name", counter.Name).WithError(err).Error("Failed to load the existing counter")
+				results = append(results, ImportResult{Name: counter.Name, Action: ImportActionFailed, Error: err.Error()})
+				continue
+			}
+			switch mode {
+			case ImportModeSkip:
+				action = ImportActionSkipped
+			case ImportModeMerge:
+				action = ImportActionMerged
+			case ImportModeOverwrite:
+				action = ImportActionOverwritten
+			}
+		}
+
+		switch action {
+		case ImportActionMerged:
+			counter.Wins += imported.Wins
+			counter.Losses += imported.Losses
+			counter.Draws += imported.Draws
+		case ImportActionCreated, ImportActionOverwritten:
+			counter.Wins = imported.Wins
+			counter.Losses = imported.Losses
+			counter.Draws = imported.Draws
+		}
+		if imported.PrettyName != "" && action != ImportActionSkipped {
+			counter.PrettyName = imported.PrettyName
+		}
+		if imported.Theme != "" && action != ImportActionSkipped {
+			counter.Theme = imported.Theme
+		}
+		counter.ValidateAndFix()
+
+		logger.WithFields(logrus.Fields{
+			"name":   counter.Name,
+			"action": action,
+		}).Info("Importing counter")
+
+		if !dryRun && action != ImportActionSkipped {
+			if err := counter.save(); err != nil {
+				logger.WithField("name", counter.Name).WithError(err).Error("Failed to save the imported counter")
+				results = append(results, ImportResult{Name: counter.Name, Action: ImportActionFailed, Error: err.Error()})
+				continue
+			}
+			if len(imported.History) > 0 {
+				history := imported.History
+				if action == ImportActionMerged {
+					history = append(counter.History(), history...)
+					sort.SliceStable(history, func(i, j int) bool {
+						return history[i].Time.Before(history[j].Time)
+					})
+				}
+				counter.SetHistory(history)
+			}
+		}
+
+		results = append(results, ImportResult{
+			Name:   counter.Name,
+			Action: action,
+			Wins:   counter.Wins,
+			Losses: counter.Losses,
+			Draws:  counter.Draws,
+		})
+	}
+
+	return results, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestImportCountersReportsFailures(t *testing.T) {
+	doc := &CounterExport{FormatVersion: CounterExportFormatVersion, Counters: []*ExportedCounter{
+		{Name: "existing", Wins: 2},
+		{Name: "new", Wins: 3},
+	}}
+
+	tests := []struct {
+		name     string
+		stored   string
+		readOnly bool
+		want     map[string]string
+	}{
+		{"writes succeed", `{"schema_version":1,"name":"existing","wins":1}`, false, map[string]string{"existing": ImportActionMerged, "new": ImportActionCreated}},
+		{"writes fail", `{"schema_version":1,"name":"existing","wins":1}`, true, map[string]string{"existing": ImportActionFailed, "new": ImportActionFailed}},
+		{"existing counter unreadable", `{"wins":`, false, map[string]string{"existing": ImportActionFailed, "new": ImportActionCreated}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			consul, client := newFakeConsul(t)
+			consul.Put(consulKeyPrefix+"/existing", tt.stored)
+			consul.SetReadOnly(tt.readOnly)
+
+			results, err := ImportCounters(client, doc, ImportModeMerge, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != len(tt.want) {
+				t.Fatalf("results = %+v, want one per counter", results)
+			}
+			for _, result := range results {
+				if result.Action != tt.want[result.Name] {
+					t.Errorf("%s = %s, want %s", result.Name, result.Action, tt.want[result.Name])
+				}
+				if (result.Action == ImportActionFailed) != (result.Error != "") {
+					t.Errorf("%s: action %s with error %q", result.Name, result.Action, result.Error)
+				}
+			}
+			if stored, _ := consul.Get(consulKeyPrefix + "/existing"); tt.readOnly && !strings.Contains(stored, `"wins":1`) {
+				t.Errorf("a failed write changed the counter: %s", stored)
+			}
+		})
+	}
+}
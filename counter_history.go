@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/r35krag0th/win-loss-rux/version"
+	"github.com/sirupsen/logrus"
+)
+
+// Events recorded in a counter's history.
+const (
+	HistoryEventWin    = "win"
+	HistoryEventLoss   = "loss"
+	HistoryEventDraw   = "draw"
+	HistoryEventReset  = "reset"
+	HistoryEventAdjust = "adjust"
+)
+
+// maxHistoryEntries caps how many entries are kept per counter so the history stays
+// well below Consul's value size limit. The oldest entries are dropped first.
+const maxHistoryEntries = 2000
+
+// HistoryEntry is a single change to a counter, along with the counter's values after the change.
+type HistoryEntry struct {
+	Time   time.Time `json:"time"`
+	Event  string    `json:"event"`
+	Delta  int       `json:"delta"`
+	Wins   int       `json:"wins"`
+	Losses int       `json:"losses"`
+	Draws  int       `json:"draws"`
+}
+
+func (w WinLossCounter) historyKey() string {
+	return fmt.Sprintf(strings.Join([]string{historyKeyPrefix, "%s"}, "/"), w.Name)
+}
+
+// History returns the recorded changes of this counter, oldest first. Failures are logged and
+// yield no history.
+func (w WinLossCounter) History() []HistoryEntry {
+	history, err := w.loadHistory()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"name":    w.Name,
+			"func":    "History",
+			"version": version.Version,
+		}).WithError(err).Errorf("Failed to load history: %s", w.historyKey())
+		return []HistoryEntry{}
+	}
+	return history
+}
+
+// loadHistory is History for callers that must not mistake a failure for an empty history.
+func (w WinLossCounter) loadHistory() ([]HistoryEntry, error) {
+	history := []HistoryEntry{}
+	if w.Name == "" {
+		return history, nil
+	}
+
+	kv := w.consulClient.KV()
+
+	logrus.Debugf("kv.Get(%s, nil)", w.historyKey())
+	p, _, err := kv.Get(w.historyKey(), consulQueryOptions(w.ctx))
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return history, nil
+	}
+
+	if err := json.Unmarshal(p.Value, &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// SetHistory replaces the recorded changes of this counter in the storage backend (Consul).
+func (w WinLossCounter) SetHistory(history []HistoryEntry) {
+	logger := logrus.WithFields(logrus.Fields{
+		"name":    w.Name,
+		"func":    "SetHistory",
+		"version": version.Version,
+	})
+
+	if len(history) > maxHistoryEntries {
+		history = history[len(history)-maxHistoryEntries:]
+	}
+
+	b, err := json.Marshal(history)
+	if err != nil {
+		logger.WithError(err).Error("Failed to marshall history into JSON")
+		return
+	}
+
+	kv := w.consulClient.KV()
+	_, err = kv.Put(&api.KVPair{Key: w.historyKey(), Value: b}, consulWriteOptions(w.ctx))
+	if err != nil {
+		logger.WithError(err).Error("Failed to write history to Consul")
+	}
+}
+
+// recordHistory appends an event with the counter's current values to its history.
+func (w WinLossCounter) recordHistory(event string, delta int) {
+	logrus.WithFields(logrus.Fields{
+		"name":    w.Name,
+		"func":    "recordHistory",
+		"event":   event,
+		"delta":   delta,
+		"version": version.Version,
+	}).Debug("Recording history entry")
+
+	history := append(w.History(), HistoryEntry{
+		Time:   time.Now().UTC(),
+		Event:  event,
+		Delta:  delta,
+		Wins:   w.Wins,
+		Losses: w.Losses,
+		Draws:  w.Draws,
+	})
+	w.SetHistory(history)
+	statsdEvent(w, event, delta)
+	notifyWebhooks(w, event, delta)
+}
+
+// destroyHistory deletes the recorded changes of this counter from the storage backend (Consul).
+func (w WinLossCounter) destroyHistory() {
+	logger := logrus.WithFields(logrus.Fields{
+		"name":    w.Name,
+		"func":    "destroyHistory",
+		"version": version.Version,
+	})
+
+	kv := w.consulClient.KV()
+	_, err := kv.Delete(w.historyKey(), consulWriteOptions(w.ctx))
+	if err != nil {
+		logger.WithError(err).Error("Failed to delete history")
+	}
+}
+
+// replayResults replays a history into the results that are still counted, oldest first.
+// A decrement removes the most recent result of its kind and a reset clears everything.
+func replayResults(history []HistoryEntry) []string {
+	results := []string{}
+	for _, entry := range history {
+		results = replayResult(results, entry)
+	}
+	return results
+}
+
+// replayResult applies one history entry to the results replayed so far.
+func replayResult(results []string, entry HistoryEntry) []string {
+	switch {
+	case entry.Event == HistoryEventReset:
+		return results[:0]
+	case entry.Delta > 0:
+		return append(results, entry.Event)
+	case entry.Delta < 0:
+		for i := len(results) - 1; i >= 0; i-- {
+			if results[i] == entry.Event {
+				return append(results[:i], results[i+1:]...)
+			}
+		}
+	}
+	return results
+}
+
+// streakOf returns the kind and length of the run of identical results at the end of a history.
+func streakOf(history []HistoryEntry) (string, int) {
+	results := replayResults(history)
+	if len(results) == 0 {
+		return "", 0
+	}
+
+	last := results[len(results)-1]
+	length := 0
+	for i := len(results) - 1; i >= 0 && results[i] == last; i-- {
+		length++
+	}
+	return last, length
+}
+
+// valuesAt returns the counter values as they were at t according to the history.
+// Before the first entry the values are derived by undoing that entry.
+// The boolean is false when the history is empty and nothing can be said.
+func valuesAt(history []HistoryEntry, t time.Time) (HistoryEntry, bool) {
+	if len(history) == 0 {
+		return HistoryEntry{}, false
+	}
+
+	for i := len(history) - 1; i >= 0; i-- {
+		if !history[i].Time.After(t) {
+			return history[i], true
+		}
+	}
+
+	first := history[0]
+	before := HistoryEntry{Time: t, Wins: first.Wins, Losses: first.Losses, Draws: first.Draws}
+	switch first.Event {
+	case HistoryEventWin:
+		before.Wins -= first.Delta
+	case HistoryEventLoss:
+		before.Losses -= first.Delta
+	case HistoryEventDraw:
+		before.Draws -= first.Delta
+	}
+	return before, true
+}
+
+// Streak returns the kind ("win", "loss" or "draw") and length of the counter's current run of results.
+func (w WinLossCounter) Streak() (string, int) {
+	return streakOf(w.History())
+}
+
+// StreakLabel returns the current streak in the short form used on scoreboards, such as "W3".
+// Without any results it returns "-".
+func (w WinLossCounter) StreakLabel() string {
+	return streakLabel(w.Streak())
+}
+
+func streakLabel(event string, length int) string {
+	if length == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%s%d", strings.ToUpper(event[:1]), length)
+}
+
+// valuesBefore returns the counter values as they were before the last entry of a history.
+// The boolean is false when that can't be known, i.e. the only entry is a reset or an adjustment.
+func valuesBefore(history []HistoryEntry) (HistoryEntry, bool) {
+	if len(history) == 0 {
+		return HistoryEntry{}, false
+	}
+	if len(history) > 1 {
+		return history[len(history)-2], true
+	}
+
+	only := history[0]
+	if only.Event == HistoryEventReset || only.Event == HistoryEventAdjust {
+		return HistoryEntry{}, false
+	}
+	return valuesAt(history, only.Time.Add(-time.Nanosecond))
+}
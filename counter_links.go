@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gookit/rux"
+)
+
+type baseURLContextKey struct{}
+
+// CounterLinks are the absolute self links of a counter, so clients can follow them instead of
+// building paths themselves.
+type CounterLinks struct {
+	Html           string `json:"html"`
+	Solo           string `json:"solo"`
+	Control        string `json:"control"`
+	Chart          string `json:"chart"`
+	Api            string `json:"api"`
+	History        string `json:"history"`
+	Win            string `json:"win"`
+	Loss           string `json:"loss"`
+	Draw           string `json:"draw"`
+	Reset          string `json:"reset"`
+	NumericsWins   string `json:"numerics_wins"`
+	NumericsLosses string `json:"numerics_losses"`
+	NumericsDraws  string `json:"numerics_draws"`
+}
+
+// CounterUrls is the html and api pair counter responses carried before links was added.
+//
+// Deprecated: use CounterLinks. It is still returned for clients that haven't moved over yet.
+type CounterUrls struct {
+	Html string `json:"html"`
+	Api  string `json:"api"`
+}
+
+// NewCounterLinks builds the links of the named counter below baseURL (e.g. "https://wl.example.com").
+func NewCounterLinks(baseURL, name string) *CounterLinks {
+	baseURL = strings.TrimRight(baseURL, "/")
+	escaped := url.PathEscape(name)
+	html := baseURL + "/counters/" + escaped
+	api := baseURL + "/api/v1/counters/" + escaped
+
+	return &CounterLinks{
+		Html:           html,
+		Solo:           html + "/solo",
+		Control:        html + "/control",
+		Chart:          html + "/chart",
+		Api:            api,
+		History:        api + "/history",
+		Win:            api + "/win",
+		Loss:           api + "/loss",
+		Draw:           api + "/draw",
+		Reset:          api + "/reset",
+		NumericsWins:   api + "/win?numerics",
+		NumericsLosses: api + "/loss?numerics",
+		NumericsDraws:  api + "/draw?numerics",
+	}
+}
+
+// publicBaseURL returns PUBLIC_BASE_URL when it is set, otherwise the scheme and host the request
+// was made to, honoring the X-Forwarded-Proto and X-Forwarded-Host headers set by reverse proxies.
+func publicBaseURL(r *http.Request) string {
+	if configured := os.Getenv("PUBLIC_BASE_URL"); configured != "" {
+		return strings.TrimRight(configured, "/")
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := firstHeaderValue(r.Header.Get("X-Forwarded-Proto")); proto != "" {
+		scheme = proto
+	}
+
+	host := r.Host
+	if forwardedHost := firstHeaderValue(r.Header.Get("X-Forwarded-Host")); forwardedHost != "" {
+		host = forwardedHost
+	}
+
+	return scheme + "://" + host
+}
+
+// firstHeaderValue returns the first entry of a comma separated header added to by each proxy hop.
+func firstHeaderValue(v string) string {
+	return strings.TrimSpace(strings.Split(v, ",")[0])
+}
+
+// baseURLMiddleware stores the public base URL of the request in its context for handleCounter.
+func baseURLMiddleware(c *rux.Context) {
+	c.WithReqCtxValue(baseURLContextKey{}, publicBaseURL(c.Req))
+	c.Next()
+}
+
+// baseURLFromContext returns the base URL stored by baseURLMiddleware, if any.
+func baseURLFromContext(ctx context.Context) (string, bool) {
+	baseURL, ok := ctx.Value(baseURLContextKey{}).(string)
+	return baseURL, ok
+}
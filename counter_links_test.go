@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCounterLinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		public  string
+		headers map[string]string
+		want    string
+	}{
+		{"request host", "", nil, "http://example.com/counters/team-a"},
+		{"forwarded", "", map[string]string{"X-Forwarded-Proto": "https, http", "X-Forwarded-Host": "wl.example.com"}, "https://wl.example.com/counters/team-a"},
+		{"configured", "https://scores.example.com/", map[string]string{"X-Forwarded-Host": "wl.example.com"}, "https://scores.example.com/counters/team-a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := apiTestRouter(t, "")
+			t.Setenv("PUBLIC_BASE_URL", tt.public)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/counters/team-a", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+			}
+
+			var counter WinLossCounter
+			if err := json.Unmarshal(w.Body.Bytes(), &counter); err != nil {
+				t.Fatal(err)
+			}
+			if counter.Links == nil || counter.Links.Html != tt.want {
+				t.Fatalf("links = %+v, want html %q", counter.Links, tt.want)
+			}
+			if counter.Urls == nil || counter.Urls.Html != counter.Links.Html || counter.Urls.Api != counter.Links.Api {
+				t.Errorf("Urls = %+v, want the html and api links", counter.Urls)
+			}
+		})
+	}
+}
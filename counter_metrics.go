@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Metrics of a counter that can be selected by query parameter.
+const (
+	MetricWins    = "wins"
+	MetricLosses  = "losses"
+	MetricDraws   = "draws"
+	MetricWinRate = "winrate"
+	MetricRecord  = "record"
+	MetricStreak  = "streak"
+)
+
+// soloMetrics are the metrics the solo overlay can show.
+var soloMetrics = []string{MetricWins, MetricLosses, MetricDraws, MetricRecord, MetricWinRate, MetricStreak}
+
+// isSoloMetric reports whether the solo overlay can show the metric.
+func isSoloMetric(metric string) bool {
+	for _, m := range soloMetrics {
+		if m == metric {
+			return true
+		}
+	}
+	return false
+}
+
+// metricValueOf returns a numeric metric for the given values. The win rate is a percentage.
+func metricValueOf(metric string, wins, losses, draws int) (float64, bool) {
+	switch metric {
+	case MetricWins:
+		return float64(wins), true
+	case MetricLosses:
+		return float64(losses), true
+	case MetricDraws:
+		return float64(draws), true
+	case MetricWinRate:
+		return winRatePercent(wins, losses, draws), true
+	}
+	return 0, false
+}
+
+// winRatePercent returns the share of results that were wins as a percentage rounded to one decimal.
+func winRatePercent(wins, losses, draws int) float64 {
+	games := wins + losses + draws
+	if games == 0 {
+		return 0
+	}
+	return math.Round(float64(wins)*1000/float64(games)) / 10
+}
+
+// metricPostfix is the label shown next to a metric in widgets.
+func metricPostfix(metric string) string {
+	switch metric {
+	case MetricWins:
+		return "Wins"
+	case MetricLosses:
+		return "Losses"
+	case MetricDraws:
+		return "Draws"
+	case MetricWinRate:
+		return "Win Rate"
+	case MetricRecord:
+		return "Record"
+	case MetricStreak:
+		return "Streak"
+	}
+	return metric
+}
+
+// metricMessage formats a metric of the counter as text, e.g. "12-4-1" for the record or "75.0%"
+// for the win rate. The boolean is false for unknown metrics.
+func metricMessage(counter *WinLossCounter, metric string) (string, bool) {
+	switch metric {
+	case MetricRecord:
+		return fmt.Sprintf("%d-%d-%d", counter.Wins, counter.Losses, counter.Draws), true
+	case MetricWinRate:
+		return strconv.FormatFloat(winRatePercent(counter.Wins, counter.Losses, counter.Draws), 'f', 1, 64) + "%", true
+	case MetricStreak:
+		return counter.StreakLabel(), true
+	}
+
+	value, ok := metricValueOf(metric, counter.Wins, counter.Losses, counter.Draws)
+	if !ok {
+		return "", false
+	}
+	return strconv.Itoa(int(value)), true
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/r35krag0th/win-loss-rux/schema"
+	"github.com/r35krag0th/win-loss-rux/version"
+	"github.com/sirupsen/logrus"
+)
+
+// MigrationResult describes the stored schema version of one counter and whether it was upgraded.
+type MigrationResult struct {
+	Name        string `json:"name"`
+	FromVersion int    `json:"from_version"`
+	ToVersion   int    `json:"to_version"`
+	Migrated    bool   `json:"migrated"`
+	Error       string `json:"error,omitempty"`
+}
+
+// MigrateCounters upgrades every stored counter in the current APP_ENV to schema.CurrentVersion.
+// Counters are normally upgraded when they are read; this is the one-off equivalent for all of them.
+// When dryRun is true nothing is written.
+func MigrateCounters(consulClient *api.Client, dryRun bool) ([]MigrationResult, error) {
+	logger := logrus.WithFields(logrus.Fields{
+		"func":    "MigrateCounters",
+		"dry_run": dryRun,
+		"version": version.Version,
+	})
+
+	kv := consulClient.KV()
+	pairs, _, err := kv.List(consulKeyPrefix+"/", nil)
+	if err != nil {
+		logger.WithError(err).Error("Failed to list keys")
+		return nil, err
+	}
+
+	results := []MigrationResult{}
+	for _, pair := range pairs {
+		name := strings.TrimPrefix(pair.Key, consulKeyPrefix+"/")
+		if name == "" || strings.Contains(name, "/") {
+			continue
+		}
+
+		counter := NewWinLossCounter(name)
+		counter.SetConsulClient(consulClient)
+
+		result := MigrationResult{Name: name, ToVersion: schema.CurrentVersion}
+		storedVersion, err := counter.decodeRecord(pair.Value)
+		result.FromVersion = storedVersion
+		if err != nil {
+			result.ToVersion = storedVersion
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+
+		if storedVersion < schema.CurrentVersion {
+			logger.WithFields(logrus.Fields{
+				"name":           name,
+				"schema_version": storedVersion,
+			}).Info("Migrating counter")
+			result.Migrated = dryRun || counter.saveIfUnchanged(pair.ModifyIndex)
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
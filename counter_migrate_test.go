@@ -0,0 +1,113 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/r35krag0th/win-loss-rux/schema"
+)
+
+// seedMigrationFixtures stores every document in testdata/migrate as a counter named after its file.
+func seedMigrationFixtures(t *testing.T, consul *fakeConsul) []string {
+	t.Helper()
+	names := []string{"invalid", "v0_legacy", "v1_current"}
+	for _, name := range names {
+		consul.Put(consulKeyPrefix+"/"+name, strings.TrimSpace(string(readTestdata(t, "migrate/"+name+".json"))))
+	}
+	return names
+}
+
+func TestMigrateCountersDryRun(t *testing.T) {
+	consul, client := newFakeConsul(t)
+	seedMigrationFixtures(t, consul)
+	writes := consul.Writes()
+
+	results, err := MigrateCounters(client, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGoldenJSON(t, "migrate/dry_run.golden", results)
+	if consul.Writes() != writes {
+		t.Errorf("a dry run wrote %d times", consul.Writes()-writes)
+	}
+}
+
+func TestMigrateCountersWritesBack(t *testing.T) {
+	consul, client := newFakeConsul(t)
+	names := seedMigrationFixtures(t, consul)
+	current := consul.ModifyIndex(consulKeyPrefix + "/v1_current")
+
+	results, err := MigrateCounters(client, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGoldenJSON(t, "migrate/results.golden", results)
+
+	for _, name := range names {
+		stored, _ := consul.Get(consulKeyPrefix + "/" + name)
+		checkGolden(t, "migrate/"+name+".stored.golden", []byte(stored+"\n"))
+	}
+	if consul.ModifyIndex(consulKeyPrefix+"/v1_current") != current {
+		t.Error("a counter already at the current schema_version was written")
+	}
+}
+
+func TestLoadWritesBackMigratedCounter(t *testing.T) {
+	consul, client := newFakeConsul(t)
+	seedMigrationFixtures(t, consul)
+
+	counter := NewWinLossCounter("v0_legacy")
+	counter.SetConsulClient(client)
+	counter.Load()
+
+	if counter.Wins != 12 || counter.Losses != 7 || counter.Draws != 1 {
+		t.Errorf("loaded %d/%d/%d, want 12/7/1", counter.Wins, counter.Losses, counter.Draws)
+	}
+	stored, _ := consul.Get(consulKeyPrefix + "/v0_legacy")
+	checkGolden(t, "migrate/v0_legacy.stored.golden", []byte(stored+"\n"))
+}
+
+func TestMigrationLosesCASRace(t *testing.T) {
+	consul, client := newFakeConsul(t)
+	seedMigrationFixtures(t, consul)
+	key := consulKeyPrefix + "/v0_legacy"
+	stale := consul.ModifyIndex(key)
+
+	counter := NewWinLossCounter("v0_legacy")
+	counter.SetConsulClient(client)
+	if _, err := counter.decodeRecord(readTestdata(t, "migrate/v0_legacy.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another writer updates the counter between the read and the write-back
+	changed := `{"schema_version":1,"name":"v0_legacy","wins":13,"losses":7,"draws":1}`
+	consul.Put(key, changed)
+
+	if counter.saveIfUnchanged(stale) {
+		t.Fatal("write-back with a stale ModifyIndex succeeded")
+	}
+	if stored, _ := consul.Get(key); stored != changed {
+		t.Errorf("stored = %s, want the concurrent write %s", stored, changed)
+	}
+}
+
+func TestMigratedCounterIsCurrent(t *testing.T) {
+	consul, client := newFakeConsul(t)
+	seedMigrationFixtures(t, consul)
+
+	if _, err := MigrateCounters(client, false); err != nil {
+		t.Fatal(err)
+	}
+	results, err := MigrateCounters(client, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results {
+		if result.Migrated {
+			t.Errorf("%s was migrated twice", result.Name)
+		}
+		if result.Error == "" && result.FromVersion != schema.CurrentVersion {
+			t.Errorf("%s is at schema_version %d after migrating", result.Name, result.FromVersion)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"time"
+
+	"github.com/r35krag0th/win-loss-rux/numericsapp"
+)
+
+// numericsGraphPoints is the default number of points returned for the line graph widget.
+const numericsGraphPoints = 50
+
+// WinRateToNumericsGauge returns the win rate as a percentage gauge for the Numerics iOS Application
+func (w WinLossCounter) WinRateToNumericsGauge(color string) *numericsapp.GaugeWidgetResponse {
+	return numericsapp.NewPercentageWidgetResponse(
+		metricPostfix(MetricWinRate),
+		color,
+		winRatePercent(w.Wins, w.Losses, w.Draws),
+	)
+}
+
+// ToNumericsPieChart returns the Wins, Losses, and Draws split as a pie chart for the Numerics iOS Application
+func (w WinLossCounter) ToNumericsPieChart(color string) *numericsapp.PieChartWidgetResponse {
+	return &numericsapp.PieChartWidgetResponse{
+		WidgetResponse: numericsapp.WidgetResponse{
+			Postfix: w.PrettyName,
+			Color:   color,
+		},
+		Data: []*numericsapp.NDataNamedInt{
+			numericsapp.NewNDataNamedInt("Wins", w.Wins),
+			numericsapp.NewNDataNamedInt("Losses", w.Losses),
+			numericsapp.NewNDataNamedInt("Draws", w.Draws),
+		},
+	}
+}
+
+// ToNumericsNumberDiff compares a metric now against its value at the end of yesterday (UTC)
+// for the Numerics iOS Application. The win rate is not supported because the widget only shows integers.
+func (w WinLossCounter) ToNumericsNumberDiff(metric string, color string, now time.Time) (*numericsapp.NumberDiffWidgetResponse, bool) {
+	if metric == MetricWinRate {
+		return nil, false
+	}
+	current, ok := metricValueOf(metric, w.Wins, w.Losses, w.Draws)
+	if !ok {
+		return nil, false
+	}
+
+	previous := current
+	endOfYesterday := now.UTC().Truncate(24 * time.Hour)
+	if values, ok := valuesAt(w.History(), endOfYesterday); ok {
+		previous, _ = metricValueOf(metric, values.Wins, values.Losses, values.Draws)
+	}
+
+	return numericsapp.NewNumberDiffWidgetResponse(metricPostfix(metric), color, int(current), int(previous)), true
+}
+
+// ToNumericsLineGraph returns the last points values of a metric over the counter's history
+// for the Numerics iOS Application.
+func (w WinLossCounter) ToNumericsLineGraph(metric string, color string, points int) (*numericsapp.LineGraphWidgetResponse, bool) {
+	if _, ok := metricValueOf(metric, 0, 0, 0); !ok {
+		return nil, false
+	}
+
+	history := w.History()
+	if points > 0 && len(history) > points {
+		history = history[len(history)-points:]
+	}
+
+	data := make([]*numericsapp.NDataFloat, 0, len(history))
+	for _, entry := range history {
+		value, _ := metricValueOf(metric, entry.Wins, entry.Losses, entry.Draws)
+		data = append(data, numericsapp.NewNDataFloat(value))
+	}
+
+	return &numericsapp.LineGraphWidgetResponse{
+		WidgetResponse: numericsapp.WidgetResponse{
+			Postfix: metricPostfix(metric),
+			Color:   color,
+		},
+		Data: data,
+	}, true
+}
+
+// StreakToNumericsLabel returns the current streak, such as "W3", as a label for the Numerics iOS Application
+func (w WinLossCounter) StreakToNumericsLabel(color string) *numericsapp.LabelWidgetResponse {
+	return numericsapp.NewLabelWidgetResponse("Streak", color, w.StreakLabel())
+}
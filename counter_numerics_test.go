@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// numericsTestCounter stores a counter with a few days of history in a fake Consul.
+func numericsTestCounter(t *testing.T) *WinLossCounter {
+	t.Helper()
+	_, client := newFakeConsul(t)
+
+	counter := NewWinLossCounter("numerics")
+	counter.SetConsulClient(client)
+	counter.PrettyName = "Numerics"
+	counter.Wins, counter.Losses, counter.Draws = 7, 4, 1
+	counter.Save()
+
+	day := func(d, hour int) time.Time { return time.Date(2026, 10, d, hour, 0, 0, 0, time.UTC) }
+	counter.SetHistory([]HistoryEntry{
+		{Time: day(16, 20), Event: HistoryEventWin, Delta: 1, Wins: 5, Losses: 3, Draws: 1},
+		{Time: day(17, 19), Event: HistoryEventLoss, Delta: 1, Wins: 5, Losses: 4, Draws: 1},
+		{Time: day(17, 21), Event: HistoryEventWin, Delta: 1, Wins: 6, Losses: 4, Draws: 1},
+		{Time: day(18, 18), Event: HistoryEventWin, Delta: 1, Wins: 7, Losses: 4, Draws: 1},
+	})
+	return counter
+}
+
+func TestNumericsWidgets(t *testing.T) {
+	counter := numericsTestCounter(t)
+	now := time.Date(2026, 10, 18, 22, 0, 0, 0, time.UTC)
+
+	checkGoldenJSON(t, "numerics/wins.golden", counter.WinsToNumericsCounter("green"))
+	checkGoldenJSON(t, "numerics/losses.golden", counter.LossesToNumericsCounter("red"))
+	checkGoldenJSON(t, "numerics/draws.golden", counter.DrawsToNumericsCounter("gray"))
+	checkGoldenJSON(t, "numerics/winrate.golden", counter.WinRateToNumericsGauge("green"))
+	checkGoldenJSON(t, "numerics/split.golden", counter.ToNumericsPieChart("blue"))
+	checkGoldenJSON(t, "numerics/streak.golden", counter.StreakToNumericsLabel("gray"))
+
+	diff, ok := counter.ToNumericsNumberDiff(MetricWins, "green", now)
+	if !ok {
+		t.Fatal("no number diff for wins")
+	}
+	checkGoldenJSON(t, "numerics/diff.golden", diff)
+
+	graph, ok := counter.ToNumericsLineGraph(MetricWinRate, "green", 3)
+	if !ok {
+		t.Fatal("no line graph for the win rate")
+	}
+	checkGoldenJSON(t, "numerics/graph.golden", graph)
+}
+
+func TestNumericsUnsupportedMetrics(t *testing.T) {
+	counter := numericsTestCounter(t)
+
+	if _, ok := counter.ToNumericsNumberDiff(MetricWinRate, "green", time.Now()); ok {
+		t.Error("number diff of the win rate should be unsupported")
+	}
+	if _, ok := counter.ToNumericsNumberDiff("bogus", "green", time.Now()); ok {
+		t.Error("number diff of an unknown metric should be unsupported")
+	}
+	if _, ok := counter.ToNumericsLineGraph("bogus", "green", 3); ok {
+		t.Error("line graph of an unknown metric should be unsupported")
+	}
+}
+
+func TestNumericsDiffWithoutHistory(t *testing.T) {
+	_, client := newFakeConsul(t)
+	counter := NewWinLossCounter("fresh")
+	counter.SetConsulClient(client)
+	counter.Wins = 3
+
+	diff, ok := counter.ToNumericsNumberDiff(MetricWins, "green", time.Now())
+	if !ok {
+		t.Fatal("no number diff for wins")
+	}
+	checkGoldenJSON(t, "numerics/diff_without_history.golden", diff)
+}
+
+func TestNumericsWinRateRounding(t *testing.T) {
+	tests := []struct {
+		name                string
+		wins, losses, draws int
+	}{
+		{"two_thirds", 2, 1, 0},
+		{"one_sixth", 1, 5, 0},
+		{"no_games", 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := NewWinLossCounter("rounding")
+			counter.Wins, counter.Losses, counter.Draws = tt.wins, tt.losses, tt.draws
+			checkGoldenJSON(t, "numerics/winrate_"+tt.name+".golden", counter.WinRateToNumericsGauge("green"))
+		})
+	}
+}
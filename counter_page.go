@@ -1,6 +1,9 @@
 package main
 
 import (
+	"regexp"
+	"strconv"
+
 	"github.com/r35krag0th/win-loss-rux/version"
 	"github.com/sirupsen/logrus"
 )
@@ -13,6 +16,22 @@ type CounterPage struct {
 	Losses     int
 	Draws      int
 	PrettyName string
+	Theme      *Theme
+
+	// Used by the solo overlay
+	Metric       string
+	Value        string
+	Label        string
+	FontSize     string
+	StreakKind   string
+	StreakLength int
+}
+
+var cssFontSize = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?(em|rem|px|pt|vw|vh|%)$`)
+
+// ValidFontSize reports whether size is a plain CSS length that is safe to put in a stylesheet.
+func ValidFontSize(size string) bool {
+	return cssFontSize.MatchString(size)
 }
 
 // NewCounterPageFromWinLossCounter creates a CounterPage from a WinLossCounter that is usually
@@ -36,3 +55,20 @@ func NewCounterPageFromWinLossCounter(counter *WinLossCounter) *CounterPage {
 		Name:       counter.Name,
 	}
 }
+
+// SetSoloMetric selects the metric shown by the solo overlay and fills in its initial value.
+func (p *CounterPage) SetSoloMetric(counter *WinLossCounter, metric string) {
+	p.Metric = metric
+
+	switch metric {
+	case MetricWinRate:
+		p.Value = strconv.FormatFloat(winRatePercent(counter.Wins, counter.Losses, counter.Draws), 'f', 1, 64)
+	case MetricStreak:
+		event, length := counter.Streak()
+		p.StreakKind = streakLabel(event, length)[:1]
+		p.StreakLength = length
+	default:
+		value, _ := metricValueOf(metric, counter.Wins, counter.Losses, counter.Draws)
+		p.Value = strconv.Itoa(int(value))
+	}
+}
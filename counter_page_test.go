@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSoloOverlay(t *testing.T) {
+	if err := pageTemplates.SetDir(""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		status  int
+		want    []string
+		missing string
+	}{
+		{"wins by default", "", 200, []string{`odometer wins">2</div>`, `font-size: 10em;`, `<div class="counter_name">Solo</div>`}, ""},
+		{"losses", "?metric=losses", 200, []string{`odometer losses">1</div>`}, ""},
+		{"record", "?metric=record", 200, []string{`odometer wins">2</div>`, `odometer losses">1</div>`, `odometer draws">0</div>`}, ""},
+		{"win rate", "?metric=winrate", 200, []string{`odometer winrate">66.7</div><div class="unit">%</div>`}, ""},
+		{"streak without history", "?metric=streak", 200, []string{`<div class="streak_kind">-</div><div class="counter_digit odometer streak">0</div>`}, ""},
+		{"label and size", "?label=Ranked&size=4rem", 200, []string{`<div class="counter_name">Ranked</div>`, `font-size: 4rem;`}, ""},
+		{"empty label", "?label=", 200, nil, `class="counter_name"`},
+		{"unknown metric", "?metric=elo", 400, []string{"Unsupported metric: elo"}, ""},
+		{"unsafe size", "?size=1em%7D%20body%7Bcolor:red", 400, []string{"Unsupported size"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, consul := apiTestRouter(t, "")
+			consul.Put(consulKeyPrefix+"/solo", `{"schema_version":1,"name":"solo","pretty_name":"Solo","wins":2,"losses":1,"draws":0}`)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/counters/solo/solo"+tt.query, nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			body := w.Body.String()
+			for _, want := range tt.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("body does not contain %q", want)
+				}
+			}
+			if tt.missing != "" && strings.Contains(body, tt.missing) {
+				t.Errorf("body contains %q", tt.missing)
+			}
+		})
+	}
+}
+
+func TestControlPage(t *testing.T) {
+	if err := pageTemplates.SetDir(""); err != nil {
+		t.Fatal(err)
+	}
+	r, consul := apiTestRouter(t, "")
+	consul.Put(consulKeyPrefix+"/panel", `{"schema_version":1,"name":"panel","pretty_name":"Ranked","wins":2,"losses":1,"draws":3}`)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/counters/panel/control", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	for _, want := range []string{
+		`var counterURL = "/api/v1/counters/panel";`,
+		`<h1>Ranked</h1>`,
+		`<span class="value wins">2</span>`,
+		`<input id="adjust-draws" type="number" min="0" inputmode="numeric" value="3">`,
+	} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("body does not contain %q", want)
+		}
+	}
+}
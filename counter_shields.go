@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gookit/rux"
+	"github.com/r35krag0th/win-loss-rux/shieldsio"
+)
+
+// defaultWinRateColors is used unless SHIELDS_WINRATE_COLORS or the thresholds query parameter say otherwise.
+const defaultWinRateColors = "60:brightgreen,50:green,40:yellow,25:orange,0:red"
+
+// noGamesColor is the badge color of a counter without any results.
+const noGamesColor = "lightgrey"
+
+// WinRateThreshold colors every win rate at or above MinWinRate, unless a higher threshold matches.
+type WinRateThreshold struct {
+	MinWinRate float64
+	Color      string
+}
+
+// WinRateColors picks badge colors by win rate.
+type WinRateColors []WinRateThreshold
+
+// ParseWinRateColors reads thresholds such as "60:brightgreen,50:green,0:red". Colors are
+// shields.io color names or hex colors.
+func ParseWinRateColors(spec string) (WinRateColors, error) {
+	var colors WinRateColors
+	for _, part := range strings.Split(spec, ",") {
+		minimum, color, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid threshold %q, expected <win rate>:<color>", part)
+		}
+		value, err := strconv.ParseFloat(minimum, 64)
+		if err != nil || value < 0 || value > 100 {
+			return nil, fmt.Errorf("invalid threshold %q, the win rate must be between 0 and 100", part)
+		}
+		if _, ok := ParseBadgeColor(color); !ok {
+			return nil, fmt.Errorf("invalid threshold %q, unknown color %q", part, color)
+		}
+		colors = append(colors, WinRateThreshold{MinWinRate: value, Color: color})
+	}
+
+	sort.Slice(colors, func(i, j int) bool { return colors[i].MinWinRate > colors[j].MinWinRate })
+	return colors, nil
+}
+
+// ColorFor returns the color of the highest threshold the win rate reaches, or noGamesColor if
+// there are no results or no threshold matches.
+func (w WinRateColors) ColorFor(wins, losses, draws int) string {
+	if wins+losses+draws == 0 {
+		return noGamesColor
+	}
+	rate := winRatePercent(wins, losses, draws)
+	for _, threshold := range w {
+		if rate >= threshold.MinWinRate {
+			return threshold.Color
+		}
+	}
+	return noGamesColor
+}
+
+// WinRateColorsFromEnv returns the thresholds from SHIELDS_WINRATE_COLORS, or the defaults.
+func WinRateColorsFromEnv() (WinRateColors, error) {
+	colors, err := ParseWinRateColors(getenv("SHIELDS_WINRATE_COLORS", defaultWinRateColors))
+	if err != nil {
+		return nil, fmt.Errorf("SHIELDS_WINRATE_COLORS: %w", err)
+	}
+	return colors, nil
+}
+
+// ToShieldsEndpoint returns a metric of the counter as a shields.io endpoint badge.
+// Unless color is set, the badge is colored by win rate.
+func (w WinLossCounter) ToShieldsEndpoint(metric, label, color string, colors WinRateColors) (*shieldsio.EndpointResponse, bool) {
+	message, ok := metricMessage(&w, metric)
+	if !ok {
+		return nil, false
+	}
+	if color == "" {
+		color = colors.ColorFor(w.Wins, w.Losses, w.Draws)
+	}
+	return shieldsio.NewEndpointResponse(label, message, color), true
+}
+
+// shieldsEndpointFromQuery builds the endpoint badge of a counter from the metric, label, color
+// and thresholds query parameters. colors are used unless thresholds is set.
+func shieldsEndpointFromQuery(c *rux.Context, counter *WinLossCounter, colors WinRateColors) (*shieldsio.EndpointResponse, error) {
+	if spec, ok := c.QueryParam("thresholds"); ok {
+		var err error
+		if colors, err = ParseWinRateColors(spec); err != nil {
+			return nil, err
+		}
+	}
+
+	color := c.Query("color")
+	if _, ok := ParseBadgeColor(color); color != "" && !ok {
+		return nil, fmt.Errorf("unsupported color: %s", color)
+	}
+
+	label := counter.PrettyName
+	if value, ok := c.QueryParam("label"); ok {
+		label = value
+	}
+
+	metric := c.Query("metric", MetricRecord)
+	endpoint, ok := counter.ToShieldsEndpoint(metric, label, color, colors)
+	if !ok {
+		return nil, fmt.Errorf("unsupported metric: %s", metric)
+	}
+	return endpoint, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWinRateColorsFromEnv(t *testing.T) {
+	tests := []struct {
+		name                string
+		spec                string
+		wins, losses, draws int
+		want                string
+		err                 string
+	}{
+		{"default", "", 3, 2, 0, "brightgreen", ""},
+		{"default just below a threshold", "", 2, 3, 0, "yellow", ""},
+		{"no games", "", 0, 0, 0, noGamesColor, ""},
+		{"configured", "75:blue,0:ff0000", 2, 1, 0, "ff0000", ""},
+		{"configured without a matching threshold", "50:green", 1, 2, 0, noGamesColor, ""},
+		{"missing color", "60", 0, 0, 0, "", "expected <win rate>:<color>"},
+		{"win rate out of range", "120:green", 0, 0, 0, "", "between 0 and 100"},
+		{"unknown color", "50:glitter", 0, 0, 0, "", `unknown color "glitter"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SHIELDS_WINRATE_COLORS", tt.spec)
+
+			colors, err := WinRateColorsFromEnv()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) || !strings.HasPrefix(err.Error(), "SHIELDS_WINRATE_COLORS: ") {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := colors.ColorFor(tt.wins, tt.losses, tt.draws); got != tt.want {
+				t.Errorf("ColorFor(%d, %d, %d) = %q, want %q", tt.wins, tt.losses, tt.draws, got, tt.want)
+			}
+		})
+	}
+}
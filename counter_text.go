@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/r35krag0th/win-loss-rux/version"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultTextFormat is used when neither the request nor a file sink give a format.
+const defaultTextFormat = "{{.Wins}}-{{.Losses}}-{{.Draws}}"
+
+// maxTextFormat and maxTextOutput keep user supplied formats from producing huge responses.
+const (
+	maxTextFormat = 1024
+	maxTextOutput = 4096
+)
+
+// CounterText is the data available to plain text formats, e.g. "{{.Wins}}W {{.Losses}}L".
+type CounterText struct {
+	Name       string
+	PrettyName string
+	Wins       int
+	Losses     int
+	Draws      int
+	Games      int
+	WinRate    string
+	Record     string
+	Streak     string
+}
+
+// NewCounterText collects the values of a counter for a plain text format.
+func NewCounterText(counter *WinLossCounter) CounterText {
+	winRate, _ := metricMessage(counter, MetricWinRate)
+	record, _ := metricMessage(counter, MetricRecord)
+	return CounterText{
+		Name:       counter.Name,
+		PrettyName: counter.PrettyName,
+		Wins:       counter.Wins,
+		Losses:     counter.Losses,
+		Draws:      counter.Draws,
+		Games:      counter.Games(),
+		WinRate:    winRate,
+		Record:     record,
+		Streak:     counter.StreakLabel(),
+	}
+}
+
+// textFormatFuncs are the template functions a format may call. printf is left out because a
+// width such as %0999999999d allocates before the output limit can stop it.
+var textFormatFuncs = map[string]bool{
+	"and": true, "or": true, "not": true,
+	"eq": true, "ne": true, "lt": true, "le": true, "gt": true, "ge": true,
+	"len": true, "index": true, "slice": true,
+	"print": true, "println": true, "html": true, "js": true, "urlquery": true,
+}
+
+// ParseTextFormat parses a text/template format for CounterText. Formats come from anyone who
+// can load the text endpoint, so only conditionals, fields and the cheap functions above are
+// allowed: loops, nested templates and printf are rejected.
+func ParseTextFormat(format string) (*template.Template, error) {
+	if len(format) > maxTextFormat {
+		return nil, fmt.Errorf("format must not be longer than %d bytes", maxTextFormat)
+	}
+	tmpl, err := template.New("text").Option("missingkey=error").Parse(format)
+	if err != nil {
+		return nil, err
+	}
+	if len(tmpl.Templates()) > 1 {
+		return nil, fmt.Errorf("format must not define templates")
+	}
+	if err = checkTextFormatNode(tmpl.Tree.Root); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// checkTextFormatNode walks a parsed format and rejects anything ParseTextFormat doesn't allow.
+func checkTextFormatNode(node parse.Node) error {
+	switch n := node.(type) {
+	case nil:
+		return nil
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := checkTextFormatNode(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *parse.TextNode, *parse.CommentNode, *parse.FieldNode, *parse.VariableNode, *parse.DotNode,
+		*parse.StringNode, *parse.NumberNode, *parse.BoolNode, *parse.NilNode:
+		return nil
+	case *parse.ActionNode:
+		return checkTextFormatNode(n.Pipe)
+	case *parse.IfNode:
+		return checkTextFormatBranch(&n.BranchNode)
+	case *parse.WithNode:
+		return checkTextFormatBranch(&n.BranchNode)
+	case *parse.PipeNode:
+		if n == nil {
+			return nil
+		}
+		for _, cmd := range n.Cmds {
+			if err := checkTextFormatNode(cmd); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			if err := checkTextFormatNode(arg); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *parse.ChainNode:
+		return checkTextFormatNode(n.Node)
+	case *parse.IdentifierNode:
+		if !textFormatFuncs[n.Ident] {
+			return fmt.Errorf("function %q is not allowed in formats", n.Ident)
+		}
+		return nil
+	case *parse.RangeNode:
+		return fmt.Errorf("range is not allowed in formats")
+	case *parse.TemplateNode:
+		return fmt.Errorf("template is not allowed in formats")
+	default:
+		return fmt.Errorf("%s is not allowed in formats", node)
+	}
+}
+
+func checkTextFormatBranch(branch *parse.BranchNode) error {
+	for _, node := range []parse.Node{branch.Pipe, branch.List, branch.ElseList} {
+		if err := checkTextFormatNode(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// limitedBuffer fails writes once more than limit bytes were written.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.limit {
+		return 0, fmt.Errorf("output is longer than %d bytes", b.limit)
+	}
+	return b.Buffer.Write(p)
+}
+
+// RenderText formats the counter with the parsed format.
+func RenderText(tmpl *template.Template, counter *WinLossCounter) ([]byte, error) {
+	out := &limitedBuffer{limit: maxTextOutput}
+	if err := tmpl.Execute(out, NewCounterText(counter)); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// TextSink writes the formatted text of a counter to a local file whenever the counter changes,
+// for OBS text sources that read from a file.
+type TextSink struct {
+	Counter string `json:"counter"`
+	Path    string `json:"path"`
+	Format  string `json:"format,omitempty"`
+
+	tmpl *template.Template
+	last []byte
+}
+
+// LoadTextSinks reads the file sinks from a JSON file such as
+// [{"counter": "team-a", "path": "/obs/team-a.txt", "format": "{{.Wins}}W {{.Losses}}L"}].
+func LoadTextSinks(path string) ([]*TextSink, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var sinks []*TextSink
+	if err = json.Unmarshal(b, &sinks); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, sink := range sinks {
+		if sink.Counter == "" || sink.Path == "" {
+			return nil, fmt.Errorf("%s: sink %d needs a counter and a path", path, i)
+		}
+		if sink.Format == "" {
+			sink.Format = defaultTextFormat
+		}
+		if sink.tmpl, err = ParseTextFormat(sink.Format); err != nil {
+			return nil, fmt.Errorf("%s: sink %d: %w", path, i, err)
+		}
+	}
+	return sinks, nil
+}
+
+// Run watches the sink's counter with Consul blocking queries, so changes made by any instance
+// of the service are picked up, and rewrites the file when its text changes. It runs until stop
+// is closed, or forever if stop is nil.
+func (s *TextSink) Run(consulClient *api.Client, stop <-chan struct{}) {
+	logger := logrus.WithFields(logrus.Fields{
+		"func":    "Run",
+		"name":    s.Counter,
+		"path":    s.Path,
+		"version": version.Version,
+	})
+	logger.Info("Writing counter text to file on changes")
+
+	counter := NewWinLossCounter(s.Counter)
+	counter.SetConsulClient(consulClient)
+	kv := consulClient.KV()
+
+	var waitIndex uint64
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		_, meta, err := kv.Get(counter.consulKey(), &api.QueryOptions{WaitIndex: waitIndex, WaitTime: 5 * time.Minute})
+		if err != nil {
+			logger.WithError(err).Error("Failed to watch counter; retrying")
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		// Consul asks clients to reset when the index goes backwards and to rate limit when it
+		// returns without a change.
+		changed := meta.LastIndex != waitIndex
+		if meta.LastIndex < waitIndex {
+			waitIndex = 0
+		} else {
+			waitIndex = meta.LastIndex
+		}
+		if !changed {
+			time.Sleep(time.Second)
+			continue
+		}
+
+		counter.Load()
+		if err = s.write(counter); err != nil {
+			logger.WithError(err).Error("Failed to write counter text")
+		}
+	}
+}
+
+// write renders the counter and replaces the file if the text changed. The file is replaced by
+// renaming a temporary file so readers never see a partial write.
+func (s *TextSink) write(counter *WinLossCounter) error {
+	text, err := RenderText(s.tmpl, counter)
+	if err != nil {
+		return err
+	}
+	if s.last != nil && bytes.Equal(text, s.last) {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), "."+filepath.Base(s.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err = tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err = tmp.Write(text); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), s.Path); err != nil {
+		return err
+	}
+
+	s.last = text
+	return nil
+}
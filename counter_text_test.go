@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTextFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		ok     bool
+	}{
+		{"default", defaultTextFormat, true},
+		{"fields and text", "{{.PrettyName}}: {{.Wins}}W {{.Losses}}L ({{.WinRate}})", true},
+		{"if and else", "{{if gt .Draws 0}}{{.Record}}{{else}}{{.Wins}}-{{.Losses}}{{end}}", true},
+		{"with and variables", "{{with $s := .Streak}}{{$s}}{{end}}", true},
+		{"allowed functions", "{{print .Wins | urlquery}} {{len .Name}} {{not (eq .Wins .Losses)}}", true},
+		{"comment", "{{/* wins */}}{{.Wins}}", true},
+		{"range", "{{range 1000000000}}x{{end}}", false},
+		{"nested range", "{{range .Name}}{{range .Name}}x{{end}}{{end}}", false},
+		{"define", `{{define "x"}}{{.Wins}}{{end}}{{template "x" .}}`, false},
+		{"block", `{{block "x" .}}{{.Wins}}{{end}}`, false},
+		{"template", `{{template "text" .}}`, false},
+		{"printf", "{{printf \"%0999999999d\" .Wins}}", false},
+		{"printf in a condition", "{{if printf \"%d\" .Wins}}x{{end}}", false},
+		{"call", "{{call .Name}}", false},
+		{"unclosed action", "{{.Wins}", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseTextFormat(tt.format)
+			if tt.ok && err != nil {
+				t.Errorf("ParseTextFormat(%q) = %s, want it accepted", tt.format, err)
+			}
+			if !tt.ok && err == nil {
+				t.Errorf("ParseTextFormat(%q) was accepted", tt.format)
+			}
+		})
+	}
+}
+
+func TestRenderText(t *testing.T) {
+	_, client := newFakeConsul(t)
+	counter := NewWinLossCounter("text")
+	counter.SetConsulClient(client)
+	counter.PrettyName = "Text"
+	counter.Wins, counter.Losses, counter.Draws = 3, 2, 1
+
+	tmpl, err := ParseTextFormat("{{.PrettyName}} {{.Wins}}W {{.Losses}}L{{if .Draws}} {{.Draws}}D{{end}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := RenderText(tmpl, counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(text), "Text 3W 2L 1D"; got != want {
+		t.Errorf("RenderText = %q, want %q", got, want)
+	}
+
+	// Fields are only known once the format is rendered against a counter
+	tmpl, err = ParseTextFormat("{{.Wins}} {{.Nope}}")
+	if err != nil {
+		t.Fatalf("ParseTextFormat rejected an unknown field: %s", err)
+	}
+	if _, err = RenderText(tmpl, counter); err == nil || !strings.Contains(err.Error(), "can't evaluate field Nope") {
+		t.Errorf("RenderText with an unknown field = %v, want the unknown field error", err)
+	}
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Discord interaction and response types, see
+// https://discord.com/developers/docs/interactions/receiving-and-responding
+const (
+	discordInteractionPing    = 1
+	discordInteractionCommand = 2
+
+	discordResponsePong    = 1
+	discordResponseMessage = 4
+
+	discordFlagEphemeral = 64
+)
+
+// Headers Discord signs every interaction with.
+const (
+	DiscordSignatureHeader = "X-Signature-Ed25519"
+	DiscordTimestampHeader = "X-Signature-Timestamp"
+)
+
+// Slash commands handled by the interactions endpoint.
+const (
+	DiscordCommandWin    = "win"
+	DiscordCommandLoss   = "loss"
+	DiscordCommandRecord = "record"
+)
+
+// discordCounterOption is the name of the option that selects the counter.
+const discordCounterOption = "counter"
+
+// maxDiscordBody caps the size of interactions read from Discord.
+const maxDiscordBody = 64 << 10
+
+// Embed colors
+const (
+	discordColorWin    = 0x4caf50
+	discordColorLoss   = 0xe05050
+	discordColorRecord = 0x42a5f5
+)
+
+// DiscordConfig configures the interactions endpoint. It is read from DISCORD_PUBLIC_KEY,
+// DISCORD_GUILDS, DISCORD_ROLES and DISCORD_DEFAULT_COUNTER.
+type DiscordConfig struct {
+	PublicKey      ed25519.PublicKey
+	Guilds         []string
+	Roles          []string
+	DefaultCounter string
+}
+
+// DiscordConfigFromEnv reads the interactions configuration. It returns nil without an error if
+// DISCORD_PUBLIC_KEY isn't set, which disables the endpoint.
+func DiscordConfigFromEnv() (*DiscordConfig, error) {
+	publicKey := os.Getenv("DISCORD_PUBLIC_KEY")
+	if publicKey == "" {
+		return nil, nil
+	}
+
+	key, err := hex.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("DISCORD_PUBLIC_KEY must be the hex encoded public key of the Discord application")
+	}
+	return &DiscordConfig{
+		PublicKey:      key,
+		Guilds:         splitList(os.Getenv("DISCORD_GUILDS")),
+		Roles:          splitList(os.Getenv("DISCORD_ROLES")),
+		DefaultCounter: os.Getenv("DISCORD_DEFAULT_COUNTER"),
+	}, nil
+}
+
+// splitList splits a comma separated list, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Verify checks the Ed25519 signature Discord sends with every interaction. The signed message
+// is the timestamp header followed by the raw body.
+func (d DiscordConfig) Verify(signature, timestamp string, body []byte) bool {
+	sig, err := hex.DecodeString(signature)
+	if err != nil || len(sig) != ed25519.SignatureSize || timestamp == "" {
+		return false
+	}
+	return ed25519.Verify(d.PublicKey, append([]byte(timestamp), body...), sig)
+}
+
+// Allowed reports whether an interaction may change or show counters. An empty allowlist allows
+// everything; interactions outside a guild are refused when either allowlist is set.
+func (d DiscordConfig) Allowed(interaction *DiscordInteraction) bool {
+	if len(d.Guilds) > 0 && !containsString(d.Guilds, interaction.GuildID) {
+		return false
+	}
+	if len(d.Roles) == 0 {
+		return true
+	}
+	if interaction.Member == nil {
+		return false
+	}
+	for _, role := range interaction.Member.Roles {
+		if containsString(d.Roles, role) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// DiscordInteraction is the part of an interaction the endpoint uses.
+type DiscordInteraction struct {
+	ID      string `json:"id"`
+	Type    int    `json:"type"`
+	GuildID string `json:"guild_id,omitempty"`
+	Member  *struct {
+		Roles []string `json:"roles"`
+		User  struct {
+			ID       string `json:"id"`
+			Username string `json:"username"`
+		} `json:"user"`
+	} `json:"member,omitempty"`
+	Data *struct {
+		Name    string `json:"name"`
+		Options []struct {
+			Name  string          `json:"name"`
+			Value json.RawMessage `json:"value"`
+		} `json:"options"`
+	} `json:"data,omitempty"`
+}
+
+// Option returns the string value of a slash command option.
+func (i DiscordInteraction) Option(name string) string {
+	if i.Data == nil {
+		return ""
+	}
+	for _, option := range i.Data.Options {
+		var value string
+		if option.Name == name && json.Unmarshal(option.Value, &value) == nil {
+			return value
+		}
+	}
+	return ""
+}
+
+// DiscordEmbedField is one name/value pair of an embed.
+type DiscordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+// DiscordEmbed is a rich message block.
+type DiscordEmbed struct {
+	Title     string              `json:"title,omitempty"`
+	URL       string              `json:"url,omitempty"`
+	Color     int                 `json:"color,omitempty"`
+	Fields    []DiscordEmbedField `json:"fields,omitempty"`
+	Footer    *DiscordEmbedFooter `json:"footer,omitempty"`
+	Timestamp *time.Time          `json:"timestamp,omitempty"`
+}
+
+// DiscordEmbedFooter is the small text below an embed.
+type DiscordEmbedFooter struct {
+	Text string `json:"text"`
+}
+
+// DiscordResponse answers an interaction.
+type DiscordResponse struct {
+	Type int                  `json:"type"`
+	Data *DiscordResponseData `json:"data,omitempty"`
+}
+
+// DiscordResponseData is the message sent in reply to a command.
+type DiscordResponseData struct {
+	Content string         `json:"content,omitempty"`
+	Embeds  []DiscordEmbed `json:"embeds,omitempty"`
+	Flags   int            `json:"flags,omitempty"`
+}
+
+// discordReply is a message only the user who ran the command can see.
+func discordReply(format string, args ...interface{}) DiscordResponse {
+	return DiscordResponse{
+		Type: discordResponseMessage,
+		Data: &DiscordResponseData{Content: fmt.Sprintf(format, args...), Flags: discordFlagEphemeral},
+	}
+}
+
+// DiscordRecordEmbed shows the record of a counter.
+func DiscordRecordEmbed(counter *WinLossCounter, color int) DiscordEmbed {
+	winRate, _ := metricMessage(counter, MetricWinRate)
+	embed := DiscordEmbed{
+		Title: counter.PrettyName,
+		Color: color,
+		Fields: []DiscordEmbedField{
+			{Name: "Wins", Value: fmt.Sprint(counter.Wins), Inline: true},
+			{Name: "Losses", Value: fmt.Sprint(counter.Losses), Inline: true},
+			{Name: "Draws", Value: fmt.Sprint(counter.Draws), Inline: true},
+			{Name: "Win rate", Value: winRate, Inline: true},
+		},
+		Timestamp: counter.UpdatedAt,
+	}
+	if counter.Links != nil {
+		embed.URL = counter.Links.Html
+	}
+	if streak := counter.StreakLabel(); streak != "-" {
+		embed.Footer = &DiscordEmbedFooter{Text: "Streak: " + streak}
+	}
+	return embed
+}
+
+// DiscordCommands are the slash command definitions registered with Discord.
+func DiscordCommands() []map[string]interface{} {
+	counterOption := map[string]interface{}{
+		"type":        3, // STRING
+		"name":        discordCounterOption,
+		"description": "Name of the counter",
+	}
+	if os.Getenv("DISCORD_DEFAULT_COUNTER") == "" {
+		counterOption["required"] = true
+	}
+	options := []map[string]interface{}{counterOption}
+
+	return []map[string]interface{}{
+		{"name": DiscordCommandWin, "description": "Record a win", "options": options},
+		{"name": DiscordCommandLoss, "description": "Record a loss", "options": options},
+		{"name": DiscordCommandRecord, "description": "Show the current record", "options": options},
+	}
+}
+
+// RegisterDiscordCommands replaces the application's slash commands, in one guild if guildID is
+// set or globally otherwise. Guild commands are available immediately, global ones can take a while.
+func RegisterDiscordCommands(ctx context.Context, applicationID, botToken, guildID string) error {
+	endpoint := fmt.Sprintf("https://discord.com/api/v10/applications/%s/commands", applicationID)
+	if guildID != "" {
+		endpoint = fmt.Sprintf("https://discord.com/api/v10/applications/%s/guilds/%s/commands", applicationID, guildID)
+	}
+
+	body, err := json.Marshal(DiscordCommands())
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bot "+botToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("discord answered %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// Respond runs a slash command and builds the reply. Only existing counters can be changed, so a
+// typo in Discord doesn't create a new counter.
+func (d DiscordConfig) Respond(ctx context.Context, interaction *DiscordInteraction) DiscordResponse {
+	if interaction.Data == nil {
+		return discordReply("Unsupported interaction")
+	}
+	if !d.Allowed(interaction) {
+		return discordReply("You are not allowed to use this command here.")
+	}
+
+	name := interaction.Option(discordCounterOption)
+	if name == "" {
+		name = d.DefaultCounter
+	}
+	if name == "" {
+		return discordReply("Which counter? Pass the counter option.")
+	}
+	if !ValidCounterName(name) {
+		return discordReply("There is no counter called %s.", name)
+	}
+
+	counter := handleCounter(ctx, name)
+	exists, err := counter.Exists()
+	if err != nil {
+		return discordReply("Something bad happened, try again later.")
+	}
+	if !exists {
+		return discordReply("There is no counter called %s.", name)
+	}
+
+	color := discordColorRecord
+	switch interaction.Data.Name {
+	case DiscordCommandWin:
+		counter.AddWin()
+		color = discordColorWin
+	case DiscordCommandLoss:
+		counter.AddLoss()
+		color = discordColorLoss
+	case DiscordCommandRecord:
+	default:
+		return discordReply("Unknown command: %s", interaction.Data.Name)
+	}
+
+	return DiscordResponse{
+		Type: discordResponseMessage,
+		Data: &DiscordResponseData{Embeds: []DiscordEmbed{DiscordRecordEmbed(counter, color)}},
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gookit/rux"
+	"github.com/sirupsen/logrus"
+)
+
+// discordTest serves the interactions endpoint for a generated application key, backed by a fake
+// Consul holding the counter "team-a".
+type discordTest struct {
+	router     *rux.Router
+	consul     *fakeConsul
+	privateKey ed25519.PrivateKey
+}
+
+func newDiscordTest(t *testing.T, env map[string]string) *discordTest {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DISCORD_PUBLIC_KEY", hex.EncodeToString(publicKey))
+	for _, key := range []string{"DISCORD_GUILDS", "DISCORD_ROLES", "DISCORD_DEFAULT_COUNTER"} {
+		t.Setenv(key, env[key])
+	}
+
+	consul := useFakeConsul(t)
+	consul.Put(consulKeyPrefix+"/team-a", `{"schema_version":1,"name":"team-a","pretty_name":"Team A","wins":2,"losses":1,"draws":0}`)
+	return &discordTest{
+		router:     newRouter(logrus.NewEntry(logrus.StandardLogger()), nil),
+		consul:     consul,
+		privateKey: privateKey,
+	}
+}
+
+// post sends body to the endpoint, signed with the application key unless signature overrides it.
+func (d *discordTest) post(body string, signature *string) *httptest.ResponseRecorder {
+	timestamp := "1760800000"
+	req := httptest.NewRequest(http.MethodPost, "/discord/interactions", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DiscordTimestampHeader, timestamp)
+	if signature == nil {
+		req.Header.Set(DiscordSignatureHeader, hex.EncodeToString(ed25519.Sign(d.privateKey, []byte(timestamp+body))))
+	} else if *signature != "" {
+		req.Header.Set(DiscordSignatureHeader, *signature)
+	}
+	w := httptest.NewRecorder()
+	d.router.ServeHTTP(w, req)
+	return w
+}
+
+// discordCommand builds an application command interaction.
+func discordCommand(name, counter, guild string, roles ...string) string {
+	interaction := map[string]interface{}{
+		"id":       "1",
+		"type":     discordInteractionCommand,
+		"guild_id": guild,
+		"member":   map[string]interface{}{"roles": roles, "user": map[string]string{"id": "7", "username": "tester"}},
+		"data":     map[string]interface{}{"name": name, "options": []map[string]string{}},
+	}
+	if counter != "" {
+		interaction["data"].(map[string]interface{})["options"] = []map[string]string{{"name": discordCounterOption, "value": counter}}
+	}
+	b, _ := json.Marshal(interaction)
+	return string(b)
+}
+
+func decodeDiscordResponse(t *testing.T, w *httptest.ResponseRecorder) DiscordResponse {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	var response DiscordResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestDiscordSignatures(t *testing.T) {
+	d := newDiscordTest(t, nil)
+	ping := `{"id":"1","type":1}`
+
+	_, otherPrivate, _ := ed25519.GenerateKey(rand.Reader)
+	wrongKey := hex.EncodeToString(ed25519.Sign(otherPrivate, []byte("1760800000"+ping)))
+	missing := ""
+	garbage := "not-hex"
+	short := "abcd"
+
+	tests := []struct {
+		name      string
+		signature *string
+		want      int
+	}{
+		{"valid", nil, http.StatusOK},
+		{"signed by another key", &wrongKey, http.StatusUnauthorized},
+		{"missing", &missing, http.StatusUnauthorized},
+		{"not hex", &garbage, http.StatusUnauthorized},
+		{"too short", &short, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := d.post(ping, tt.signature).Code; got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("tampered body", func(t *testing.T) {
+		signature := hex.EncodeToString(ed25519.Sign(d.privateKey, []byte("1760800000"+ping)))
+		if got := d.post(`{"id":"2","type":1}`, &signature).Code; got != http.StatusUnauthorized {
+			t.Errorf("status = %d, want 401", got)
+		}
+	})
+}
+
+func TestDiscordPing(t *testing.T) {
+	d := newDiscordTest(t, nil)
+	if response := decodeDiscordResponse(t, d.post(`{"id":"1","type":1}`, nil)); response.Type != discordResponsePong {
+		t.Errorf("response type = %d, want PONG", response.Type)
+	}
+	if got := d.post(`{"id":"1","type":99}`, nil).Code; got != http.StatusBadRequest {
+		t.Errorf("unsupported interaction type = %d, want 400", got)
+	}
+}
+
+func TestDiscordCommands(t *testing.T) {
+	d := newDiscordTest(t, nil)
+
+	response := decodeDiscordResponse(t, d.post(discordCommand(DiscordCommandWin, "team-a", "g1"), nil))
+	if response.Type != discordResponseMessage || response.Data == nil || len(response.Data.Embeds) != 1 {
+		t.Fatalf("win response = %+v", response)
+	}
+	embed := response.Data.Embeds[0]
+	if embed.Title != "Team A" || embed.Color != discordColorWin || embed.Fields[0].Value != "3" {
+		t.Errorf("win embed = %+v", embed)
+	}
+
+	response = decodeDiscordResponse(t, d.post(discordCommand(DiscordCommandLoss, "team-a", "g1"), nil))
+	if embed = response.Data.Embeds[0]; embed.Color != discordColorLoss || embed.Fields[1].Value != "2" {
+		t.Errorf("loss embed = %+v", embed)
+	}
+
+	response = decodeDiscordResponse(t, d.post(discordCommand(DiscordCommandRecord, "team-a", "g1"), nil))
+	if embed = response.Data.Embeds[0]; embed.Color != discordColorRecord || embed.Fields[0].Value != "3" || embed.Fields[1].Value != "2" {
+		t.Errorf("record embed = %+v", embed)
+	}
+
+	stored, _ := d.consul.Get(consulKeyPrefix + "/team-a")
+	if !strings.Contains(stored, `"wins":3`) || !strings.Contains(stored, `"losses":2`) {
+		t.Errorf("stored counter = %s, want 3 wins and 2 losses", stored)
+	}
+}
+
+func TestDiscordReplies(t *testing.T) {
+	tests := []struct {
+		name        string
+		env         map[string]string
+		interaction string
+		want        string
+	}{
+		{"unknown counter", nil, discordCommand(DiscordCommandWin, "team-b", "g1"), "There is no counter called team-b."},
+		{"invalid counter name", nil, discordCommand(DiscordCommandWin, "../etc", "g1"), "There is no counter called ../etc."},
+		{"no counter", nil, discordCommand(DiscordCommandRecord, "", "g1"), "Which counter? Pass the counter option."},
+		{"unknown command", nil, discordCommand("draw", "team-a", "g1"), "Unknown command: draw"},
+		{"no data", nil, `{"id":"1","type":2}`, "Unsupported interaction"},
+		{"guild not allowed", map[string]string{"DISCORD_GUILDS": "g2,g3"}, discordCommand(DiscordCommandWin, "team-a", "g1"), "You are not allowed to use this command here."},
+		{"role missing", map[string]string{"DISCORD_ROLES": "r1"}, discordCommand(DiscordCommandWin, "team-a", "g1", "r2"), "You are not allowed to use this command here."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDiscordTest(t, tt.env)
+			response := decodeDiscordResponse(t, d.post(tt.interaction, nil))
+			if response.Data == nil || response.Data.Content != tt.want {
+				t.Fatalf("response = %+v, want %q", response.Data, tt.want)
+			}
+			if response.Data.Flags != discordFlagEphemeral {
+				t.Error("the reply is not ephemeral")
+			}
+			if stored, _ := d.consul.Get(consulKeyPrefix + "/team-a"); !strings.Contains(stored, `"wins":2`) {
+				t.Errorf("the counter changed: %s", stored)
+			}
+		})
+	}
+}
+
+func TestDiscordAllowlistsAndDefaultCounter(t *testing.T) {
+	d := newDiscordTest(t, map[string]string{
+		"DISCORD_GUILDS":          "g1",
+		"DISCORD_ROLES":           "r1,r2",
+		"DISCORD_DEFAULT_COUNTER": "team-a",
+	})
+
+	response := decodeDiscordResponse(t, d.post(discordCommand(DiscordCommandWin, "", "g1", "r0", "r2"), nil))
+	if response.Data == nil || len(response.Data.Embeds) != 1 || response.Data.Embeds[0].Fields[0].Value != "3" {
+		t.Errorf("win on the default counter = %+v", response.Data)
+	}
+}
+
+func TestDiscordConfigFromEnv(t *testing.T) {
+	t.Setenv("DISCORD_PUBLIC_KEY", "")
+	if config, err := DiscordConfigFromEnv(); config != nil || err != nil {
+		t.Errorf("without a key = %+v, %v, want the endpoint disabled", config, err)
+	}
+
+	t.Setenv("DISCORD_PUBLIC_KEY", "abcd")
+	if _, err := DiscordConfigFromEnv(); err == nil {
+		t.Error("a short key was accepted")
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/r35krag0th/win-loss-rux/version"
+	"github.com/sirupsen/logrus"
+)
+
+// statsdNamespace prefixes the name of every metric sent to DogStatsD.
+const statsdNamespace = "winloss."
+
+// dogstatsd sends metrics to the Datadog agent. It discards them unless SetupDogStatsD found an agent.
+var dogstatsd statsd.ClientInterface = &statsd.NoOpClient{}
+
+// SetupDogStatsD points dogstatsd at the agent given by DD_AGENT_HOST and DD_DOGSTATSD_PORT
+// (8125 by default). Without DD_AGENT_HOST no metrics are sent. Every metric is tagged with the
+// service, env and version. The returned function flushes pending metrics and closes the client.
+func SetupDogStatsD() (func() error, error) {
+	host := os.Getenv("DD_AGENT_HOST")
+	if host == "" {
+		return func() error { return nil }, nil
+	}
+	addr := net.JoinHostPort(host, getenv("DD_DOGSTATSD_PORT", "8125"))
+
+	client, err := statsd.New(addr,
+		statsd.WithNamespace(statsdNamespace),
+		statsd.WithTags([]string{"service:win-loss", "env:" + envName, "version:" + version.Version}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"func":    "SetupDogStatsD",
+		"addr":    addr,
+		"version": version.Version,
+	}).Info("Sending metrics to DogStatsD")
+	dogstatsd = client
+	return client.Close, nil
+}
+
+// counterTags tags a metric with the counter it is about.
+func counterTags(name string, tags ...string) []string {
+	return append([]string{"counter:" + name}, tags...)
+}
+
+// statsdEvent counts an outcome event of a counter. Wins, losses and draws are counted with their
+// delta, so a decrement cancels out the increment it undoes.
+func statsdEvent(counter WinLossCounter, event string, delta int) {
+	value := int64(1)
+	switch event {
+	case HistoryEventWin, HistoryEventLoss, HistoryEventDraw:
+		value = int64(delta)
+	}
+	dogstatsd.Count("counter.events", value, counterTags(counter.Name, "event:"+event), 1)
+}
+
+// statsdGauges sends the current values of a counter.
+func statsdGauges(counter WinLossCounter) {
+	tags := counterTags(counter.Name)
+	dogstatsd.Gauge("counter.wins", float64(counter.Wins), tags, 1)
+	dogstatsd.Gauge("counter.losses", float64(counter.Losses), tags, 1)
+	dogstatsd.Gauge("counter.draws", float64(counter.Draws), tags, 1)
+	dogstatsd.Gauge("counter.winrate", winRatePercent(counter.Wins, counter.Losses, counter.Draws), tags, 1)
+}
+
+// statsdBackendTiming times a Consul call. Calls about a single counter are tagged with it.
+func statsdBackendTiming(operation, keyspace, counter string, status int, took time.Duration) {
+	tags := []string{"operation:" + operation, "keyspace:" + keyspace, "status:" + strconv.Itoa(status)}
+	if counter != "" {
+		tags = counterTags(counter, tags...)
+	}
+	dogstatsd.Timing("consul.request", took, tags, 1)
+}
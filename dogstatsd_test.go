@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DataDog/datadog-go/v5/statsd"
+	"github.com/r35krag0th/win-loss-rux/version"
+)
+
+// statsdAgent is a UDP listener standing in for the Datadog agent.
+type statsdAgent struct {
+	conn  net.PacketConn
+	close func() error
+}
+
+// useStatsdAgent points SetupDogStatsD at a local UDP listener and restores the no-op client
+// after the test.
+func useStatsdAgent(t *testing.T) *statsdAgent {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	_, port, _ := net.SplitHostPort(conn.LocalAddr().String())
+	t.Setenv("DD_AGENT_HOST", "127.0.0.1")
+	t.Setenv("DD_DOGSTATSD_PORT", port)
+	closeDogStatsD, err := SetupDogStatsD()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		closeDogStatsD()
+		dogstatsd = &statsd.NoOpClient{}
+	})
+	return &statsdAgent{conn: conn, close: closeDogStatsD}
+}
+
+// lines flushes the client and returns the metric lines the agent receives.
+func (a *statsdAgent) lines(t *testing.T) []string {
+	t.Helper()
+	if err := dogstatsd.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return a.read()
+}
+
+// read returns every metric line received until the agent is quiet.
+func (a *statsdAgent) read() []string {
+	var lines []string
+	buf := make([]byte, 65536)
+	for {
+		a.conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, _, err := a.conn.ReadFrom(buf)
+		if err != nil {
+			return lines
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(buf[:n])), "\n") {
+			lines = append(lines, line)
+		}
+	}
+}
+
+// statsdLine is a parsed "name:value|type|#tags" line.
+type statsdLine struct {
+	name, value, kind string
+	tags              map[string]bool
+}
+
+func parseStatsdLine(line string) statsdLine {
+	parts := strings.Split(line, "|")
+	name, value, _ := strings.Cut(parts[0], ":")
+	parsed := statsdLine{name: name, value: value, tags: map[string]bool{}}
+	if len(parts) > 1 {
+		parsed.kind = parts[1]
+	}
+	for _, part := range parts[2:] {
+		if strings.HasPrefix(part, "#") {
+			for _, tag := range strings.Split(part[1:], ",") {
+				parsed.tags[tag] = true
+			}
+		}
+	}
+	return parsed
+}
+
+// findStatsdLine returns the first line with the name and every one of the tags.
+func findStatsdLine(lines []string, name string, tags ...string) (statsdLine, bool) {
+	for _, line := range lines {
+		parsed := parseStatsdLine(line)
+		if parsed.name != name {
+			continue
+		}
+		matches := true
+		for _, tag := range tags {
+			matches = matches && parsed.tags[tag]
+		}
+		if matches {
+			return parsed, true
+		}
+	}
+	return statsdLine{}, false
+}
+
+func TestDogStatsDCounterMetrics(t *testing.T) {
+	consul := useFakeConsul(t)
+	consul.Put(consulKeyPrefix+"/team-a", `{"schema_version":1,"name":"team-a","pretty_name":"Team A","wins":2,"losses":1,"draws":0}`)
+	agent := useStatsdAgent(t)
+
+	counter := handleCounter(context.Background(), "team-a")
+	counter.AddWin()
+	lines := agent.lines(t)
+
+	globalTags := []string{"service:win-loss", "env:" + envName, "version:" + version.Version}
+	tests := []struct {
+		name  string
+		value string
+		kind  string
+		tags  []string
+	}{
+		{"winloss.counter.events", "1", "c", []string{"counter:team-a", "event:win"}},
+		{"winloss.counter.wins", "3", "g", []string{"counter:team-a"}},
+		{"winloss.counter.losses", "1", "g", []string{"counter:team-a"}},
+		{"winloss.counter.draws", "0", "g", []string{"counter:team-a"}},
+		{"winloss.counter.winrate", "75", "g", []string{"counter:team-a"}},
+	}
+	for _, tt := range tests {
+		line, ok := findStatsdLine(lines, tt.name, append(tt.tags, globalTags...)...)
+		if !ok {
+			t.Errorf("no %s line tagged %v in %q", tt.name, tt.tags, lines)
+			continue
+		}
+		if line.value != tt.value || line.kind != tt.kind {
+			t.Errorf("%s = %s|%s, want %s|%s", tt.name, line.value, line.kind, tt.value, tt.kind)
+		}
+	}
+
+	timing, ok := findStatsdLine(lines, "winloss.consul.request", "counter:team-a", "keyspace:counters", "status:200")
+	if !ok {
+		t.Fatalf("no consul.request timing for team-a in %q", lines)
+	}
+	if timing.kind != "ms" {
+		t.Errorf("consul.request type = %s, want ms", timing.kind)
+	}
+}
+
+func TestDogStatsDDecrementCancelsIncrement(t *testing.T) {
+	useFakeConsul(t)
+	agent := useStatsdAgent(t)
+
+	counter := WinLossCounter{Name: "team-b"}
+	statsdEvent(counter, HistoryEventLoss, -1)
+	statsdEvent(counter, HistoryEventReset, 0)
+	lines := agent.lines(t)
+
+	if line, ok := findStatsdLine(lines, "winloss.counter.events", "counter:team-b", "event:loss"); !ok || line.value != "-1" {
+		t.Errorf("loss decrement = %+v, want a count of -1", line)
+	}
+	if line, ok := findStatsdLine(lines, "winloss.counter.events", "counter:team-b", "event:reset"); !ok || line.value != "1" {
+		t.Errorf("reset = %+v, want a count of 1", line)
+	}
+}
+
+func TestDogStatsDCloseFlushes(t *testing.T) {
+	agent := useStatsdAgent(t)
+
+	statsdEvent(WinLossCounter{Name: "team-c"}, HistoryEventDraw, 1)
+	if err := agent.close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := findStatsdLine(agent.read(), "winloss.counter.events", "counter:team-c", "event:draw"); !ok {
+		t.Error("closing the client dropped a buffered metric")
+	}
+}
+
+func TestDogStatsDDisabled(t *testing.T) {
+	t.Setenv("DD_AGENT_HOST", "")
+	closeDogStatsD, err := SetupDogStatsD()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := closeDogStatsD(); err != nil {
+		t.Errorf("closing the disabled client: %s", err)
+	}
+	if _, ok := dogstatsd.(*statsd.NoOpClient); !ok {
+		t.Errorf("dogstatsd = %T without DD_AGENT_HOST, want the no-op client", dogstatsd)
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+// fakeConsul is an in-memory stand-in for the parts of the Consul HTTP API the service uses:
+// the KV store (including CAS, recursive listing and blocking queries) and transactions.
+type fakeConsul struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	index   uint64
+	kv      map[string]*api.KVPair
+	changed chan struct{}
+	// failing makes every request fail with a 500, like a Consul without a leader
+	failing bool
+	// readOnly makes every write fail with a 500, while reads still succeed
+	readOnly bool
+	// writes counts the KV writes, transactions included
+	writes int
+}
+
+// newFakeConsul starts a fake Consul and returns it with a client for it.
+func newFakeConsul(t *testing.T) (*fakeConsul, *api.Client) {
+	t.Helper()
+	f := &fakeConsul{index: 1, kv: map[string]*api.KVPair{}, changed: make(chan struct{})}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.Close)
+	// Counter changes notify webhooks in the background; let them finish against this fake
+	// instead of outliving the test.
+	t.Cleanup(webhooks.Wait)
+
+	client, err := api.NewClient(&api.Config{Address: strings.TrimPrefix(f.URL, "http://"), Scheme: "http"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f, client
+}
+
+// useFakeConsul points newConsulClient at a fake Consul for the rest of the test.
+func useFakeConsul(t *testing.T) *fakeConsul {
+	t.Helper()
+	f, _ := newFakeConsul(t)
+	t.Setenv("CONSUL_ADDR", strings.TrimPrefix(f.URL, "http://"))
+	t.Setenv("CONSUL_SCHEME", "http")
+	return f
+}
+
+// Put stores a value as if another client wrote it.
+func (f *fakeConsul) Put(key, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.set(key, []byte(value))
+}
+
+// Delete removes a key as if another client deleted it.
+func (f *fakeConsul) Delete(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.remove(key)
+}
+
+// Get returns a stored value.
+func (f *fakeConsul) Get(key string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pair, ok := f.kv[key]
+	if !ok {
+		return "", false
+	}
+	return string(pair.Value), true
+}
+
+// Keys returns every stored key with the given prefix, sorted.
+func (f *fakeConsul) Keys(prefix string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys := []string{}
+	for key := range f.kv {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ModifyIndex returns the ModifyIndex of a stored key, or 0.
+func (f *fakeConsul) ModifyIndex(key string) uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if pair, ok := f.kv[key]; ok {
+		return pair.ModifyIndex
+	}
+	return 0
+}
+
+// Writes returns how many writes the fake has accepted.
+func (f *fakeConsul) Writes() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.writes
+}
+
+// SetFailing makes every following request fail, or succeed again.
+func (f *fakeConsul) SetFailing(failing bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failing = failing
+}
+
+// SetReadOnly makes every following write fail, or succeed again.
+func (f *fakeConsul) SetReadOnly(readOnly bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.readOnly = readOnly
+}
+
+// set and remove must be called with mu held.
+func (f *fakeConsul) set(key string, value []byte) {
+	f.index++
+	f.writes++
+	pair, ok := f.kv[key]
+	if !ok {
+		pair = &api.KVPair{Key: key, CreateIndex: f.index}
+		f.kv[key] = pair
+	}
+	pair.Value = value
+	pair.ModifyIndex = f.index
+	f.notify()
+}
+
+func (f *fakeConsul) remove(key string) {
+	f.index++
+	f.writes++
+	delete(f.kv, key)
+	f.notify()
+}
+
+func (f *fakeConsul) notify() {
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeConsul) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	failing := f.failing || (f.readOnly && r.Method != http.MethodGet)
+	f.mu.Unlock()
+	if failing {
+		http.Error(w, "No cluster leader", http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/v1/txn" && r.Method == http.MethodPut:
+		f.serveTxn(w, r)
+	case strings.HasPrefix(r.URL.Path, "/v1/kv/"):
+		f.serveKV(w, r, strings.TrimPrefix(r.URL.Path, "/v1/kv/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeConsul) serveKV(w http.ResponseWriter, r *http.Request, key string) {
+	query := r.URL.Query()
+
+	if r.Method == http.MethodGet {
+		f.waitForChange(r.Context(), query)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+
+	switch r.Method {
+	case http.MethodGet:
+		var pairs []*api.KVPair
+		for k, pair := range f.kv {
+			if k == key || (query.Has("recurse") || query.Has("keys")) && strings.HasPrefix(k, key) {
+				pairs = append(pairs, pair)
+			}
+		}
+		if len(pairs) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+		if query.Has("keys") {
+			keys := make([]string, len(pairs))
+			for i, pair := range pairs {
+				keys[i] = pair.Key
+			}
+			writeFakeJSON(w, http.StatusOK, keys)
+			return
+		}
+		writeFakeJSON(w, http.StatusOK, pairs)
+
+	case http.MethodPut:
+		value, _ := io.ReadAll(r.Body)
+		if cas := query.Get("cas"); cas != "" {
+			if !f.casMatches(key, cas) {
+				writeFakeJSON(w, http.StatusOK, false)
+				return
+			}
+		}
+		f.set(key, value)
+		writeFakeJSON(w, http.StatusOK, true)
+
+	case http.MethodDelete:
+		if cas := query.Get("cas"); cas != "" && !f.casMatches(key, cas) {
+			writeFakeJSON(w, http.StatusOK, false)
+			return
+		}
+		for k := range f.kv {
+			if k == key || query.Has("recurse") && strings.HasPrefix(k, key) {
+				f.remove(k)
+			}
+		}
+		writeFakeJSON(w, http.StatusOK, true)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// casMatches must be called with mu held. An index of 0 only matches a missing key.
+func (f *fakeConsul) casMatches(key, cas string) bool {
+	index, err := strconv.ParseUint(cas, 10, 64)
+	if err != nil {
+		return false
+	}
+	pair, ok := f.kv[key]
+	if index == 0 {
+		return !ok
+	}
+	return ok && pair.ModifyIndex == index
+}
+
+// waitForChange blocks a query with an index until the store changes past it, the wait expires or
+// the client gives up.
+func (f *fakeConsul) waitForChange(ctx context.Context, query url.Values) {
+	index, _ := strconv.ParseUint(query.Get("index"), 10, 64)
+	if index == 0 {
+		return
+	}
+	wait, err := time.ParseDuration(query.Get("wait"))
+	if err != nil || wait <= 0 || wait > 5*time.Second {
+		wait = 5 * time.Second
+	}
+	timeout := time.After(wait)
+	for {
+		f.mu.Lock()
+		current, changed := f.index, f.changed
+		f.mu.Unlock()
+		if current > index {
+			return
+		}
+		select {
+		case <-changed:
+		case <-timeout:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// serveTxn applies a KV transaction atomically: either every operation succeeds or none is applied.
+func (f *fakeConsul) serveTxn(w http.ResponseWriter, r *http.Request) {
+	var ops api.TxnOps
+	if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var errs api.TxnErrors
+	for i, op := range ops {
+		if op.KV == nil {
+			errs = append(errs, &api.TxnError{OpIndex: i, What: "only KV operations are supported"})
+			continue
+		}
+		cas := strconv.FormatUint(op.KV.Index, 10)
+		switch op.KV.Verb {
+		case api.KVSet, api.KVDelete:
+		case api.KVCAS, api.KVDeleteCAS, api.KVCheckIndex:
+			if !f.casMatches(op.KV.Key, cas) {
+				errs = append(errs, &api.TxnError{OpIndex: i, What: "index mismatch for " + op.KV.Key})
+			}
+		case api.KVCheckNotExists:
+			if _, ok := f.kv[op.KV.Key]; ok {
+				errs = append(errs, &api.TxnError{OpIndex: i, What: "key exists: " + op.KV.Key})
+			}
+		default:
+			errs = append(errs, &api.TxnError{OpIndex: i, What: "unsupported verb " + string(op.KV.Verb)})
+		}
+	}
+	if len(errs) > 0 {
+		writeFakeJSON(w, http.StatusConflict, api.TxnResponse{Errors: errs})
+		return
+	}
+
+	var results api.TxnResults
+	for _, op := range ops {
+		switch op.KV.Verb {
+		case api.KVSet, api.KVCAS:
+			f.set(op.KV.Key, op.KV.Value)
+			results = append(results, &api.TxnResult{KV: &api.KVPair{Key: op.KV.Key, ModifyIndex: f.index}})
+		case api.KVDelete, api.KVDeleteCAS:
+			if _, ok := f.kv[op.KV.Key]; ok {
+				f.remove(op.KV.Key)
+			}
+		}
+	}
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+	writeFakeJSON(w, http.StatusOK, api.TxnResponse{Results: results})
+}
+
+func writeFakeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/gookit/rux"
+	"github.com/hashicorp/consul/api"
+	"github.com/r35krag0th/win-loss-rux/version"
+	"github.com/sirupsen/logrus"
+)
+
+// servicePort is the port the service listens on.
+const servicePort = 3000
+
+// defaultReadyTimeout is how long /readyz waits for Consul unless READY_TIMEOUT says otherwise.
+const defaultReadyTimeout = 2 * time.Second
+
+// BuildInfo is the response of /version.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// CurrentBuildInfo returns the build information injected with -ldflags.
+func CurrentBuildInfo() BuildInfo {
+	return BuildInfo{
+		Version:   version.Version,
+		Commit:    version.Commit,
+		BuildDate: version.BuildDate,
+		GoVersion: runtime.Version(),
+	}
+}
+
+// Readiness is the response of /readyz. Checks maps each check to "ok" or what is wrong.
+type Readiness struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// ReadinessCheck reports whether the service can serve requests: Consul answers within Timeout
+// and every page template is parsed.
+type ReadinessCheck struct {
+	Timeout time.Duration
+
+	consulClient *api.Client
+}
+
+// ReadinessCheckFromEnv creates the readiness check. READY_TIMEOUT sets how long to wait for Consul.
+func ReadinessCheckFromEnv() (*ReadinessCheck, error) {
+	timeout, err := time.ParseDuration(getenv("READY_TIMEOUT", defaultReadyTimeout.String()))
+	if err != nil || timeout <= 0 {
+		return nil, errors.New("READY_TIMEOUT must be a positive duration such as 2s")
+	}
+	consulClient, err := newConsulClient()
+	if err != nil {
+		return nil, err
+	}
+	return &ReadinessCheck{Timeout: timeout, consulClient: consulClient}, nil
+}
+
+// Check runs every readiness check.
+func (r *ReadinessCheck) Check(ctx context.Context) Readiness {
+	result := Readiness{Status: "ready", Checks: map[string]string{"consul": "ok", "templates": "ok"}}
+
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+	// Reading the counters prefix needs a Consul leader, like every counter operation does
+	if _, _, err := r.consulClient.KV().Get(consulKeyPrefix, (&api.QueryOptions{}).WithContext(ctx)); err != nil {
+		result.Status = "not ready"
+		result.Checks["consul"] = err.Error()
+	}
+	if !pageTemplates.Parsed() {
+		result.Status = "not ready"
+		result.Checks["templates"] = "not parsed"
+	}
+	return result
+}
+
+// healthRoutes registers /healthz, /readyz and /version. Without a readiness check there is no /readyz.
+func healthRoutes(r *rux.Router, readiness *ReadinessCheck) {
+	r.GET("/healthz", func(c *rux.Context) {
+		c.JSON(200, map[string]string{"status": "ok"})
+	})
+
+	if readiness != nil {
+		r.GET("/readyz", func(c *rux.Context) {
+			result := readiness.Check(c.Req.Context())
+			status := 200
+			if result.Status != "ready" {
+				status = 503
+			}
+			c.JSON(status, result)
+		})
+	}
+
+	r.GET("/version", func(c *rux.Context) {
+		c.JSON(200, CurrentBuildInfo())
+	})
+}
+
+// RegisterService registers the service with the local Consul agent if CONSUL_REGISTER is true,
+// with /healthz and /readyz as its checks. The agent reaches the service at CONSUL_SERVICE_ADDRESS,
+// the host name by default. It returns a function that deregisters the service again.
+func RegisterService() (func() error, error) {
+	if getenv("CONSUL_REGISTER", "false") != "true" {
+		return func() error { return nil }, nil
+	}
+	logger := logrus.WithFields(logrus.Fields{
+		"func":    "RegisterService",
+		"version": version.Version,
+	})
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	name := getenv("CONSUL_SERVICE_NAME", "win-loss")
+	id := getenv("CONSUL_SERVICE_ID", fmt.Sprintf("%s-%s-%s", name, envName, hostname))
+	address := getenv("CONSUL_SERVICE_ADDRESS", hostname)
+	baseURL := "http://" + net.JoinHostPort(address, strconv.Itoa(servicePort))
+
+	consulClient, err := newConsulClient()
+	if err != nil {
+		return nil, err
+	}
+	registration := &api.AgentServiceRegistration{
+		ID:      id,
+		Name:    name,
+		Address: address,
+		Port:    servicePort,
+		Tags:    []string{envName},
+		Meta: map[string]string{
+			"version": version.Version,
+			"commit":  version.Commit,
+		},
+		Checks: api.AgentServiceChecks{
+			{
+				CheckID:                        id + ":healthz",
+				Name:                           "Liveness",
+				HTTP:                           baseURL + "/healthz",
+				Interval:                       "10s",
+				Timeout:                        "2s",
+				DeregisterCriticalServiceAfter: "10m",
+			},
+			{
+				CheckID:  id + ":readyz",
+				Name:     "Readiness",
+				HTTP:     baseURL + "/readyz",
+				Interval: "10s",
+				Timeout:  "5s",
+			},
+		},
+	}
+	if err := consulClient.Agent().ServiceRegister(registration); err != nil {
+		return nil, err
+	}
+	logger.WithFields(logrus.Fields{"service_id": id, "address": baseURL}).Info("Registered service with Consul")
+
+	return func() error {
+		logger.WithField("service_id", id).Info("Deregistering service from Consul")
+		return consulClient.Agent().ServiceDeregister(id)
+	}, nil
+}
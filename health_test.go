@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestReadyz(t *testing.T) {
+	if err := pageTemplates.SetDir(""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		readiness bool
+		failing   bool
+		want      int
+	}{
+		{"without a readiness check", false, false, http.StatusNotFound},
+		{"ready", true, false, http.StatusOK},
+		{"consul failing", true, true, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			consul, client := newFakeConsul(t)
+			consul.SetFailing(tt.failing)
+			var readiness *ReadinessCheck
+			if tt.readiness {
+				readiness = &ReadinessCheck{Timeout: time.Second, consulClient: client}
+			}
+			r := newRouter(logrus.NewEntry(logrus.StandardLogger()), readiness)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if w.Code != tt.want {
+				t.Errorf("/readyz = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+			w = httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			if w.Code != http.StatusOK {
+				t.Errorf("/healthz = %d, want 200", w.Code)
+			}
+		})
+	}
+}
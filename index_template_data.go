@@ -4,6 +4,7 @@ package main
 // The data stored here are based on ClickableLinkData objects to form the list of links.
 type IndexTemplateData struct {
 	Title    string
+	Theme    *Theme
 	Counters []ClickableLinkData
 }
 
@@ -4,28 +4,29 @@ import (
 	"bytes"
 	"context"
 	_ "embed"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"html/template"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/getsentry/sentry-go"
-	sentryhttp "github.com/getsentry/sentry-go/http"
 	"github.com/gookit/rux"
 	"github.com/hashicorp/consul/api"
 	"github.com/r35krag0th/win-loss-rux/version"
 	"github.com/sirupsen/logrus"
 )
 
-//go:embed templates/counter.gohtml
-var embedCounterTemplate string
-
-//go:embed templates/index.gohtml
-var embedIndexTemplate string
-
-//go:embed templates/solo_counter.gohtml
-var embedSoloCounterTemplate string
+//go:embed api/openapi.json
+var embedOpenAPISpec []byte
 
 func init() {
 	logrus.SetFormatter(&logrus.TextFormatter{})
@@ -34,17 +35,14 @@ func init() {
 	logrus.SetLevel(logrus.InfoLevel)
 }
 
-func handleCounter(ctx context.Context, name string) *WinLossCounter {
+// newConsulClient creates a Consul client using CONSUL_ADDR and CONSUL_SCHEME when both are set,
+// falling back to the Consul defaults otherwise.
+func newConsulClient() (*api.Client, error) {
 	logger := logrus.WithFields(logrus.Fields{
-		"counter_name": name,
-		"version":      version.Version,
+		"func":    "newConsulClient",
+		"version": version.Version,
 	})
 
-	span := sentry.StartSpan(ctx, "Initialize WinLossCounter")
-	logger.Debug("Creating new WinLossCounter")
-	tmp := NewWinLossCounter(name)
-	span.Finish()
-
 	consulScheme := os.Getenv("CONSUL_SCHEME")
 	logger.Debugf("Fetched CONSUL_SCHEME environment variable: %s", consulScheme)
 
@@ -61,9 +59,36 @@ func handleCounter(ctx context.Context, name string) *WinLossCounter {
 		}
 	}
 
-	span = sentry.StartSpan(ctx, "Initialize Consul Client")
+	// Time every request for the backend metrics
+	transport := targetConfig.Transport
+	if transport == nil {
+		transport = api.DefaultConfig().Transport
+	}
+	httpClient, err := api.NewHttpClient(transport, targetConfig.TLSConfig)
+	if err != nil {
+		return nil, err
+	}
+	httpClient.Transport = backendMetricsTransport{next: httpClient.Transport}
+	targetConfig.HttpClient = httpClient
+
+	return api.NewClient(targetConfig)
+}
+
+func handleCounter(ctx context.Context, name string) *WinLossCounter {
+	logger := logrus.WithFields(logrus.Fields{
+		"counter_name": name,
+		"version":      version.Version,
+	})
+
+	_, span := StartSpan(ctx, "Initialize WinLossCounter")
+	logger.Debug("Creating new WinLossCounter")
+	tmp := NewWinLossCounter(name)
+	tmp.SetContext(ctx)
+	span.Finish()
+
+	_, span = StartSpan(ctx, "Initialize Consul Client")
 	logger.Debug("Creating Consul client")
-	consulClient, err := api.NewClient(targetConfig)
+	consulClient, err := newConsulClient()
 	if err != nil {
 		logger.Error("Failed to create Consul client", err)
 		sentry.CaptureException(err)
@@ -73,7 +98,11 @@ func handleCounter(ctx context.Context, name string) *WinLossCounter {
 	logger.Debug("Setting Consul Client in WinLossCounter")
 	tmp.SetConsulClient(consulClient)
 
-	span = sentry.StartSpan(ctx, "Load data from Consul")
+	if baseURL, ok := baseURLFromContext(ctx); ok {
+		tmp.SetLinks(baseURL)
+	}
+
+	_, span = StartSpan(ctx, "Load data from Consul")
 	defer span.Finish()
 
 	logger.Debug("Loading counter's data")
@@ -83,15 +112,61 @@ func handleCounter(ctx context.Context, name string) *WinLossCounter {
 	return tmp
 }
 
+// handleWebhookStore creates a WebhookStore with a new Consul client.
+func handleWebhookStore(ctx context.Context) *WebhookStore {
+	_, span := StartSpan(ctx, "Initialize Consul Client")
+	defer span.Finish()
+
+	consulClient, err := newConsulClient()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to create Consul client")
+		sentry.CaptureException(err)
+	}
+	store := NewWebhookStore(consulClient)
+	store.ctx = ctx
+	return store
+}
+
+// handleWebhook loads the webhook named in the route, answering 404 if it doesn't exist.
+func handleWebhook(c *rux.Context) (*Webhook, bool) {
+	hook, err := handleWebhookStore(c.Req.Context()).Get(c.Param("id"))
+	if errors.Is(err, ErrWebhookNotFound) {
+		c.AbortWithStatus(404, "Webhook not found")
+		return nil, false
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Failed to load webhook")
+		c.AbortWithStatus(500, "Something bad happened")
+		return nil, false
+	}
+	return hook, true
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
 	rootLogger := logrus.WithFields(logrus.Fields{
 		"version":  version.Version,
 		"env_name": envName,
 	})
 
-	err := sentry.Init(sentry.ClientOptions{
+	shutdownTracing, err := SetupTracing(context.Background())
+	if err != nil {
+		rootLogger.Fatalf("Failed to set up tracing: %s", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	closeDogStatsD, err := SetupDogStatsD()
+	if err != nil {
+		rootLogger.Fatalf("Failed to set up DogStatsD: %s", err)
+	}
+	defer closeDogStatsD()
+
+	err = sentry.Init(sentry.ClientOptions{
 		Dsn:              os.Getenv("SENTRY_DSN"),
-		EnableTracing:    true,
+		EnableTracing:    tracers.sentry,
 		TracesSampleRate: 0.01,
 		Environment:      getenv("APP_ENV", "local"),
 		Release:          version.Version,
@@ -102,28 +177,138 @@ func main() {
 	// Flush buffered events before the program terminates.
 	defer sentry.Flush(2 * time.Second)
 
-	sentryHandler := sentryhttp.New(sentryhttp.Options{})
+	if err := pageTemplates.SetDir(os.Getenv("TEMPLATE_DIR")); err != nil {
+		rootLogger.Fatalf("Failed to parse templates: %s", err)
+	}
+	if os.Getenv("TEMPLATE_DIR") != "" && getenv("TEMPLATE_WATCH", "false") == "true" {
+		go pageTemplates.Watch(time.Second, nil)
+	}
+
+	if themeDir := os.Getenv("THEME_DIR"); themeDir != "" {
+		rootLogger.Infof("Loading custom themes from %s", themeDir)
+		if err := themes.LoadDir(themeDir); err != nil {
+			rootLogger.WithError(err).Error("Failed to load custom themes")
+		}
+	}
+
+	if sinkConfig := os.Getenv("TEXT_SINK_CONFIG"); sinkConfig != "" {
+		sinks, err := LoadTextSinks(sinkConfig)
+		if err != nil {
+			rootLogger.Fatalf("Failed to load text sinks: %s", err)
+		}
+		consulClient, err := newConsulClient()
+		if err != nil {
+			rootLogger.Fatalf("Failed to create Consul client for text sinks: %s", err)
+		}
+		for _, sink := range sinks {
+			go sink.Run(consulClient, nil)
+		}
+	}
+
+	counterGauges, err := CounterGaugesFromEnv()
+	if err != nil {
+		rootLogger.Fatalf("Failed to configure counter metrics: %s", err)
+	}
+	if counterGauges != nil {
+		metricsRegistry.MustRegister(counterGauges)
+	}
+
+	// Background workers run until shutdown closes stopWorkers, then main waits for them
+	stopWorkers := make(chan struct{})
+	var workers sync.WaitGroup
+
+	if mqttConfig := MQTTConfigFromEnv(); mqttConfig != nil {
+		consulClient, err := newConsulClient()
+		if err != nil {
+			rootLogger.Fatalf("Failed to create Consul client for MQTT: %s", err)
+		}
+		bridge := NewMQTTBridge(mqttConfig, consulClient)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			bridge.Run(stopWorkers)
+		}()
+	}
+
+	twitchConfig, err := TwitchConfigFromEnv()
+	if err != nil {
+		rootLogger.Fatalf("Failed to configure the Twitch bot: %s", err)
+	}
+	if twitchConfig != nil {
+		bot := NewTwitchBot(twitchConfig)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			bot.Run(stopWorkers)
+		}()
+	}
+
+	readiness, err := ReadinessCheckFromEnv()
+	if err != nil {
+		rootLogger.Fatalf("Failed to configure the readiness check: %s", err)
+	}
+	r := newRouter(rootLogger, readiness)
+
+	deregister, err := RegisterService()
+	if err != nil {
+		rootLogger.Fatalf("Failed to register with Consul: %s", err)
+	}
+	leave := func() {
+		if err := deregister(); err != nil {
+			rootLogger.WithError(err).Error("Failed to deregister from Consul")
+		}
+	}
+
+	// On SIGTERM the service leaves Consul first, so no new traffic is routed to it, then finishes
+	// the requests in flight. main returns instead of exiting so the deferred calls still flush
+	// traces and errors.
+	srv := &http.Server{Addr: fmt.Sprintf(":%d", servicePort), Handler: r}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+
+		rootLogger.Info("Shutting down")
+		leave()
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			rootLogger.WithError(err).Error("Failed to finish requests in flight")
+		}
+		slackResponses.Wait()
+		close(stopWorkers)
+		workers.Wait()
+		// Changes made by the requests and workers above may still have deliveries in flight
+		webhooks.Wait()
+	}()
+
+	rootLogger.Infof("Listening on %s", srv.Addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		rootLogger.WithError(err).Error("Failed to serve HTTP")
+		leave()
+		return
+	}
+	<-stopped
+}
 
+// newRouter registers every route of the service on a new router.
+func newRouter(rootLogger *logrus.Entry, readiness *ReadinessCheck) *rux.Router {
 	r := rux.New()
-	// r.Use(func(c *rux.Context) {
-	// 	sentryHandler.Handle(c.Handler())
-	// 	c.Next()
-	// })
+	r.Use(tracingMiddleware(r))
+	r.Use(baseURLMiddleware)
+	r.Use(metricsMiddleware(r))
 
-	r.Use(rux.WrapHTTPHandlerFunc(sentryHandler.HandleFunc(func(rw http.ResponseWriter, r *http.Request) {
-		hub := sentry.GetHubFromContext(r.Context())
-		hub.Scope().SetTag("someRandomTag", "maybeYouNeedIt")
-		hub.Scope().SetRequest(r)
-	})))
+	r.GET("/metrics", rux.WrapHTTPHandler(metricsHandler()))
+	healthRoutes(r, readiness)
 
 	r.GET("", func(c *rux.Context) {
 		logger := rootLogger.WithFields(logrus.Fields{
 			"path": "/",
 		})
 
-		if hub := sentry.GetHubFromContext(c.Req.Context()); hub != nil {
-			hub.Scope().SetTransaction("Frontend - Index")
-		}
+		traceRoute(c, "Frontend - Index")
 
 		logger.Debug("Creating blank Counter as helper")
 		counter := handleCounter(c.Req.Context(), "")
@@ -136,14 +321,15 @@ func main() {
 			"template": "template/index.gohtml",
 		}).Debug("Initializing template for index page")
 		// tmpl := template.Must(template.ParseFiles("templates/index.gohtml"))
-		tmpl, err := template.New("index").Parse(embedIndexTemplate)
+		tmpl, err := pageTemplates.Get("index.gohtml")
 		if err != nil {
-			logger.WithError(err).Error("Failed to load template from embed")
+			logger.WithError(err).Error("Failed to load template")
 			c.AbortWithStatus(500, "Something bad happened")
 		}
 
 		logger.Debug("Rendering template")
 		data := IndexTemplateData{Title: "WLD - List of Counters"}
+		data.Theme = themes.Resolve(c.Query("theme"))
 
 		logger.Debug("Adding discovered counters to template data")
 		for _, counterName := range counterNames {
@@ -155,7 +341,7 @@ func main() {
 		}
 		out := bytes.Buffer{}
 		logger.Info("Rendering template with data")
-		err = tmpl.Execute(&out, data)
+		err = renderTemplate(c.Req.Context(), tmpl, &out, data)
 		if err != nil {
 			logger.WithError(err).Error("Something failed during execute")
 			c.AbortWithStatus(500, "Something bad happened")
@@ -167,10 +353,7 @@ func main() {
 	})
 
 	r.GET("/counters/{name}", func(c *rux.Context) {
-		if hub := sentry.GetHubFromContext(c.Req.Context()); hub != nil {
-			hub.Scope().SetTransaction("Frontend - Show Counter")
-			hub.Scope().SetExtra("counter_name", c.Param("name"))
-		}
+		traceRoute(c, "Frontend - Show Counter")
 
 		logger := rootLogger.WithFields(logrus.Fields{
 			"path": "/counters/{name}",
@@ -181,9 +364,9 @@ func main() {
 		// counter.SetConsulClient(consulClient)
 
 		// tmpl := template.Must(template.ParseFiles("templates/counter.gohtml"))
-		tmpl, err := template.New("counter").Parse(embedCounterTemplate)
+		tmpl, err := pageTemplates.Get("counter.gohtml")
 		if err != nil {
-			logger.WithError(err).Error("Failed to load template from embed")
+			logger.WithError(err).Error("Failed to load template")
 			c.AbortWithStatus(500, "Something bad happened")
 			return
 		}
@@ -191,9 +374,10 @@ func main() {
 		data := NewCounterPageFromWinLossCounter(counter)
 		data.Name = counter.Name
 		data.Title = fmt.Sprintf("WLD Counter - %s", counter.Name)
+		data.Theme = themes.Resolve(c.Query("theme"), counter.Theme)
 
 		out := bytes.Buffer{}
-		err = tmpl.Execute(&out, data)
+		err = renderTemplate(c.Req.Context(), tmpl, &out, data)
 		if err != nil {
 			logrus.WithError(err).Error("failed to render the template")
 			c.AbortWithStatus(500, "Something bad happened")
@@ -203,19 +387,28 @@ func main() {
 	})
 
 	r.GET("/counters/{name}/solo", func(c *rux.Context) {
-		if hub := sentry.GetHubFromContext(c.Req.Context()); hub != nil {
-			hub.Scope().SetTransaction("Show Counter (Solo Mode)")
-			hub.Scope().SetExtra("counter_name", c.Param("name"))
-		}
+		traceRoute(c, "Show Counter (Solo Mode)")
 		logger := rootLogger.WithFields(logrus.Fields{
 			"path": "/counters/{name}/solo",
 			"name": c.Param("name"),
 		})
+
+		metric := c.Query("metric", MetricWins)
+		if !isSoloMetric(metric) {
+			c.AbortWithStatus(400, fmt.Sprintf("Unsupported metric: %s", metric))
+			return
+		}
+		fontSize := c.Query("size", "10em")
+		if !ValidFontSize(fontSize) {
+			c.AbortWithStatus(400, fmt.Sprintf("Unsupported size: %s", fontSize))
+			return
+		}
+
 		counter := handleCounter(c.Req.Context(), c.Param("name"))
 		// tmpl := template.Must(template.ParseFiles("templates/solo_counter.gohtml"))
-		tmpl, err := template.New("soloCounter").Parse(embedSoloCounterTemplate)
+		tmpl, err := pageTemplates.Get("solo_counter.gohtml")
 		if err != nil {
-			logger.WithError(err).Error("Failed to load template from embed")
+			logger.WithError(err).Error("Failed to load template")
 			c.AbortWithStatus(500, "Something bad happened")
 			return
 		}
@@ -223,9 +416,16 @@ func main() {
 		data := NewCounterPageFromWinLossCounter(counter)
 		data.Name = counter.Name
 		data.Title = fmt.Sprintf("WLD Counter (Solo) - %s", counter.Name)
+		data.Theme = themes.Resolve(c.Query("theme"), counter.Theme)
+		data.SetSoloMetric(counter, metric)
+		data.FontSize = fontSize
+		data.Label = counter.PrettyName
+		if label, ok := c.QueryParam("label"); ok {
+			data.Label = label
+		}
 
 		out := bytes.Buffer{}
-		err = tmpl.Execute(&out, data)
+		err = renderTemplate(c.Req.Context(), tmpl, &out, data)
 		if err != nil {
 			logger.WithError(err).Error("Something failed during execute")
 			c.AbortWithStatus(500, "Something bad happened")
@@ -234,22 +434,697 @@ func main() {
 		c.HTML(200, out.Bytes())
 	})
 
+	r.GET("/counters/{name}/control", func(c *rux.Context) {
+		traceRoute(c, "Frontend - Control Panel")
+		logger := rootLogger.WithFields(logrus.Fields{
+			"path": "/counters/{name}/control",
+			"name": c.Param("name"),
+		})
+
+		counter := handleCounter(c.Req.Context(), c.Param("name"))
+		tmpl, err := pageTemplates.Get("control.gohtml")
+		if err != nil {
+			logger.WithError(err).Error("Failed to load template")
+			c.AbortWithStatus(500, "Something bad happened")
+			return
+		}
+
+		data := NewCounterPageFromWinLossCounter(counter)
+		data.Name = counter.Name
+		data.Title = fmt.Sprintf("WLD Control Panel - %s", counter.Name)
+		data.Theme = themes.Resolve(c.Query("theme"), counter.Theme)
+		data.Label = counter.PrettyName
+		if data.Label == "" {
+			data.Label = counter.Name
+		}
+
+		out := bytes.Buffer{}
+		err = renderTemplate(c.Req.Context(), tmpl, &out, data)
+		if err != nil {
+			logger.WithError(err).Error("Something failed during execute")
+			c.AbortWithStatus(500, "Something bad happened")
+			return
+		}
+		c.HTML(200, out.Bytes())
+	})
+
+	r.GET("/counters/{name}/chart", func(c *rux.Context) {
+		traceRoute(c, "Frontend - Chart")
+		logger := rootLogger.WithFields(logrus.Fields{
+			"path": "/counters/{name}/chart",
+			"name": c.Param("name"),
+		})
+
+		window, rolling, err := chartQuery(c)
+		if err != nil {
+			c.AbortWithStatus(400, err.Error())
+			return
+		}
+		width, errWidth := strconv.Atoi(c.Query("width", "800"))
+		height, errHeight := strconv.Atoi(c.Query("height", "400"))
+		if errWidth != nil || errHeight != nil || width < 200 || height < 200 || width > 4000 || height > 4000 {
+			c.AbortWithStatus(400, "width and height must be numbers between 200 and 4000")
+			return
+		}
+		refresh, err := strconv.Atoi(c.Query("refresh", "60"))
+		if err != nil || refresh < 0 {
+			c.AbortWithStatus(400, "refresh must be a number of seconds, or 0 to disable it")
+			return
+		}
+
+		counter := handleCounter(c.Req.Context(), c.Param("name"))
+		tmpl, err := pageTemplates.Get("chart.gohtml")
+		if err != nil {
+			logger.WithError(err).Error("Failed to load template")
+			c.AbortWithStatus(500, "Something bad happened")
+			return
+		}
+
+		series := counter.ChartSeries(window, rolling, time.Now())
+		data := ChartPageData{
+			Title:    fmt.Sprintf("WLD Chart - %s", counter.Name),
+			Name:     counter.Name,
+			Label:    counter.PrettyName,
+			Theme:    themes.Resolve(c.Query("theme"), counter.Theme),
+			Window:   window,
+			Windows:  ChartWindowNames,
+			Rolling:  rolling,
+			Refresh:  refresh,
+			Controls: c.Query("controls", "true") != "false",
+			Chart:    RenderChartSVG(series, width, height),
+		}
+		if label, ok := c.QueryParam("label"); ok {
+			data.Label = label
+		}
+
+		out := bytes.Buffer{}
+		err = renderTemplate(c.Req.Context(), tmpl, &out, data)
+		if err != nil {
+			logger.WithError(err).Error("Something failed during execute")
+			c.AbortWithStatus(500, "Something bad happened")
+			return
+		}
+		c.HTML(200, out.Bytes())
+	})
+
+	r.GET("/counters/{name}/badge.svg", func(c *rux.Context) {
+		traceRoute(c, "Frontend - Badge (SVG)")
+
+		counter := handleCounter(c.Req.Context(), c.Param("name"))
+		badge, err := NewBadgeFromQuery(c, counter)
+		if err != nil {
+			c.AbortWithStatus(400, err.Error())
+			return
+		}
+		ServeBadge(c, BadgeETag(counter, "svg", c.Req.URL.RawQuery), "image/svg+xml; charset=utf-8", badge.SVG())
+	})
+
+	r.GET("/counters/{name}/badge.png", func(c *rux.Context) {
+		traceRoute(c, "Frontend - Badge (PNG)")
+		logger := rootLogger.WithFields(logrus.Fields{
+			"path": "/counters/{name}/badge.png",
+			"name": c.Param("name"),
+		})
+
+		counter := handleCounter(c.Req.Context(), c.Param("name"))
+		badge, err := NewBadgeFromQuery(c, counter)
+		if err != nil {
+			c.AbortWithStatus(400, err.Error())
+			return
+		}
+		image, err := badge.PNG()
+		if err != nil {
+			logger.WithError(err).Error("Failed to render the badge")
+			c.AbortWithStatus(500, "Something bad happened")
+			return
+		}
+		ServeBadge(c, BadgeETag(counter, "png", c.Req.URL.RawQuery), "image/png", image)
+	})
+
+	r.GET("/counters/{name}/text", func(c *rux.Context) {
+		traceRoute(c, "Frontend - Show Counter (Text)")
+
+		tmpl, err := ParseTextFormat(c.Query("format", defaultTextFormat))
+		if err != nil {
+			c.AbortWithStatus(400, fmt.Sprintf("Invalid format: %s", err))
+			return
+		}
+
+		counter := handleCounter(c.Req.Context(), c.Param("name"))
+		text, err := RenderText(tmpl, counter)
+		if err != nil {
+			c.AbortWithStatus(400, fmt.Sprintf("Invalid format: %s", err))
+			return
+		}
+		c.SetHeader("Cache-Control", "no-cache")
+		c.Blob(200, "text/plain; charset=utf-8", text)
+	})
+
+	r.GET("/themes", func(c *rux.Context) {
+		traceRoute(c, "Frontend - Theme Gallery")
+		logger := rootLogger.WithFields(logrus.Fields{
+			"path": "/themes",
+		})
+
+		tmpl, err := pageTemplates.Get("themes.gohtml")
+		if err != nil {
+			logger.WithError(err).Error("Failed to load template")
+			c.AbortWithStatus(500, "Something bad happened")
+			return
+		}
+
+		data := ThemeGalleryData{
+			Title:   "WLD - Themes",
+			Label:   "sample counter",
+			Counter: c.Query("counter"),
+			Themes:  themes.All(),
+		}
+		if data.Counter != "" {
+			data.Label = NewWinLossCounter(data.Counter).PrettyName
+		}
+
+		out := bytes.Buffer{}
+		err = renderTemplate(c.Req.Context(), tmpl, &out, data)
+		if err != nil {
+			logger.WithError(err).Error("Something failed during execute")
+			c.AbortWithStatus(500, "Something bad happened")
+			return
+		}
+		c.HTML(200, out.Bytes())
+	})
+
+	// Badge colors of the shields.io endpoint
+	winRateColors, err := WinRateColorsFromEnv()
+	if err != nil {
+		rootLogger.Fatalf("Failed to configure badge colors: %s", err)
+	}
+
+	// Discord slash commands, enabled by DISCORD_PUBLIC_KEY
+	discordConfig, err := DiscordConfigFromEnv()
+	if err != nil {
+		rootLogger.Fatalf("Failed to configure Discord interactions: %s", err)
+	}
+	if discordConfig != nil {
+		r.POST("/discord/interactions", func(c *rux.Context) {
+			logger := rootLogger.WithFields(logrus.Fields{
+				"path": "/discord/interactions",
+			})
+			traceRoute(c, "Discord - Interaction")
+
+			body, err := io.ReadAll(io.LimitReader(c.Req.Body, maxDiscordBody))
+			if err != nil {
+				c.AbortWithStatus(400, "Failed to read the request body")
+				return
+			}
+			if !discordConfig.Verify(c.Req.Header.Get(DiscordSignatureHeader), c.Req.Header.Get(DiscordTimestampHeader), body) {
+				c.AbortWithStatus(401, "Invalid request signature")
+				return
+			}
+
+			var interaction DiscordInteraction
+			if err = json.Unmarshal(body, &interaction); err != nil {
+				c.AbortWithStatus(400, "Expected an interaction")
+				return
+			}
+
+			switch interaction.Type {
+			case discordInteractionPing:
+				c.JSON(200, DiscordResponse{Type: discordResponsePong})
+			case discordInteractionCommand:
+				logger.WithFields(logrus.Fields{
+					"guild":   interaction.GuildID,
+					"counter": interaction.Option(discordCounterOption),
+				}).Info("Handling Discord command")
+				c.JSON(200, discordConfig.Respond(c.Req.Context(), &interaction))
+			default:
+				c.AbortWithStatus(400, "Unsupported interaction type")
+			}
+		})
+	}
+
+	// Slack slash command and buttons, enabled by SLACK_SIGNING_SECRET
+	if signingSecret := os.Getenv("SLACK_SIGNING_SECRET"); signingSecret != "" {
+		slackVerifier := NewSlackVerifier(signingSecret)
+		slackLogger := rootLogger.WithFields(logrus.Fields{
+			"path": "/slack",
+		})
+
+		// slackForm reads and verifies a signed form body from Slack.
+		slackForm := func(c *rux.Context) (url.Values, bool) {
+			body, err := io.ReadAll(io.LimitReader(c.Req.Body, maxSlackBody))
+			if err != nil {
+				c.AbortWithStatus(400, "Failed to read the request body")
+				return nil, false
+			}
+			if !slackVerifier.Verify(c.Req.Header.Get(SlackSignatureHeader), c.Req.Header.Get(SlackTimestampHeader), body) {
+				c.AbortWithStatus(401, "Invalid request signature")
+				return nil, false
+			}
+			form, err := url.ParseQuery(string(body))
+			if err != nil {
+				c.AbortWithStatus(400, "Expected a form body")
+				return nil, false
+			}
+			return form, true
+		}
+
+		r.POST("/slack/commands", func(c *rux.Context) {
+			traceRoute(c, "Slack - Command")
+
+			form, ok := slackForm(c)
+			if !ok {
+				return
+			}
+			operation, name, ok := ParseSlackCommand(form.Get("text"))
+			if !ok {
+				c.JSON(200, slackEphemeral(slackUsage))
+				return
+			}
+
+			slackLogger.WithFields(logrus.Fields{
+				"team":      form.Get("team_id"),
+				"user":      form.Get("user_id"),
+				"operation": operation,
+				"name":      name,
+			}).Info("Handling Slack command")
+			c.JSON(200, RunSlackOperation(c.Req.Context(), operation, name))
+		})
+
+		// Button presses are acknowledged right away, the message is updated through its response URL
+		r.POST("/slack/interactions", func(c *rux.Context) {
+			traceRoute(c, "Slack - Interaction")
+
+			form, ok := slackForm(c)
+			if !ok {
+				return
+			}
+			var interaction SlackInteraction
+			if err := json.Unmarshal([]byte(form.Get("payload")), &interaction); err != nil {
+				c.AbortWithStatus(400, "Expected an interaction payload")
+				return
+			}
+			if interaction.Type == "block_actions" {
+				slackResponses.Add(1)
+				go func() {
+					defer slackResponses.Done()
+					RespondToSlackInteraction(&interaction)
+				}()
+			}
+			c.SetStatus(200)
+		})
+	}
+
+	// Admin area for managing counters, behind basic auth and CSRF protection
+	r.Group(adminPrefix, func() {
+		adminLogger := rootLogger.WithFields(logrus.Fields{
+			"path": adminPrefix,
+		})
+
+		r.GET("", func(c *rux.Context) {
+			traceRoute(c, "Admin - List Counters")
+
+			tmpl, err := pageTemplates.Get("admin.gohtml")
+			if err != nil {
+				adminLogger.WithError(err).Error("Failed to load template")
+				c.AbortWithStatus(500, "Something bad happened")
+				return
+			}
+			token, err := csrfToken(c)
+			if err != nil {
+				adminLogger.WithError(err).Error("Failed to create CSRF token")
+				c.AbortWithStatus(500, "Something bad happened")
+				return
+			}
+
+			data := AdminTemplateData{
+				Title:     "WLD - Admin",
+				Theme:     themes.Resolve(c.Query("theme")),
+				Themes:    themes.All(),
+				CSRFToken: token,
+				Notice:    c.Query("notice"),
+				Error:     c.Query("error"),
+				Sort:      c.Query("sort", "name"),
+				Order:     c.Query("order", "asc"),
+			}
+			if !adminSortColumns[data.Sort] {
+				data.Sort = "name"
+			}
+			if data.Order != "desc" {
+				data.Order = "asc"
+			}
+
+			helper := handleCounter(c.Req.Context(), "")
+			for _, name := range helper.ListAll() {
+				counter := handleCounter(c.Req.Context(), name)
+				data.Counters = append(data.Counters, AdminCounterRow{
+					Name:       counter.Name,
+					PrettyName: counter.PrettyName,
+					Wins:       counter.Wins,
+					Losses:     counter.Losses,
+					Draws:      counter.Draws,
+					Theme:      counter.Theme,
+					UpdatedAt:  counter.UpdatedAt,
+				})
+			}
+			data.SortCounters()
+
+			out := bytes.Buffer{}
+			err = renderTemplate(c.Req.Context(), tmpl, &out, data)
+			if err != nil {
+				adminLogger.WithError(err).Error("Something failed during execute")
+				c.AbortWithStatus(500, "Something bad happened")
+				return
+			}
+			c.SetHeader("Cache-Control", "no-store")
+			c.HTML(200, out.Bytes())
+		})
+
+		// Create a counter
+		r.POST("/counters", func(c *rux.Context) {
+			traceRoute(c, "Admin - Create Counter")
+
+			name := strings.TrimSpace(c.Post("name"))
+			if !ValidCounterName(name) {
+				adminRedirect(c, "error", fmt.Sprintf("Invalid counter name: %q", name))
+				return
+			}
+
+			adminLogger.WithField("name", name).Info("Handling Create Counter")
+			counter := handleCounter(c.Req.Context(), name)
+			if prettyName := strings.TrimSpace(c.Post("pretty_name")); prettyName != "" {
+				counter.PrettyName = prettyName
+			}
+			if err := counter.Create(); err != nil {
+				adminRedirect(c, "error", fmt.Sprintf("Failed to create %s: %s", name, err))
+				return
+			}
+			adminRedirect(c, "notice", fmt.Sprintf("Created %s", name))
+		})
+
+		r.Group("/counters/{name}", func() {
+			// Edit the pretty name and theme
+			r.POST("", func(c *rux.Context) {
+				traceRoute(c, "Admin - Edit Counter")
+
+				counter, ok := adminCounter(c)
+				if !ok {
+					return
+				}
+				theme := c.Post("theme")
+				if _, known := themes.Get(theme); theme != "" && !known {
+					adminRedirect(c, "error", fmt.Sprintf("Unknown theme: %s", theme))
+					return
+				}
+
+				adminLogger.WithField("name", counter.Name).Info("Handling Edit Counter")
+				counter.PrettyName = strings.TrimSpace(c.Post("pretty_name"))
+				if counter.PrettyName == "" {
+					counter.PrettyName = NewWinLossCounter(counter.Name).PrettyName
+				}
+				counter.Theme = theme
+				counter.Save()
+				adminRedirect(c, "notice", fmt.Sprintf("Saved %s", counter.Name))
+			})
+
+			r.POST("/rename", func(c *rux.Context) {
+				traceRoute(c, "Admin - Rename Counter")
+
+				counter, ok := adminCounter(c)
+				if !ok {
+					return
+				}
+				newName := strings.TrimSpace(c.Post("new_name"))
+				if !ValidCounterName(newName) {
+					adminRedirect(c, "error", fmt.Sprintf("Invalid counter name: %q", newName))
+					return
+				}
+
+				adminLogger.WithFields(logrus.Fields{
+					"name":     counter.Name,
+					"new_name": newName,
+				}).Info("Handling Rename Counter")
+				oldName := counter.Name
+				if err := counter.Rename(newName); err != nil {
+					adminRedirect(c, "error", fmt.Sprintf("Failed to rename %s: %s", oldName, err))
+					return
+				}
+				adminRedirect(c, "notice", fmt.Sprintf("Renamed %s to %s", oldName, newName))
+			})
+
+			r.POST("/reset", func(c *rux.Context) {
+				traceRoute(c, "Admin - Reset Counter")
+
+				counter, ok := adminCounter(c)
+				if !ok {
+					return
+				}
+				adminLogger.WithField("name", counter.Name).Info("Handling Reset Counter")
+				counter.Reset()
+				adminRedirect(c, "notice", fmt.Sprintf("Reset %s", counter.Name))
+			})
+
+			// Deleting requires typing the counter's name as confirmation
+			r.POST("/delete", func(c *rux.Context) {
+				traceRoute(c, "Admin - Delete Counter")
+
+				counter, ok := adminCounter(c)
+				if !ok {
+					return
+				}
+				if c.Post("confirm") != counter.Name {
+					adminRedirect(c, "error", fmt.Sprintf("Type %s to confirm deleting it", counter.Name))
+					return
+				}
+				adminLogger.WithField("name", counter.Name).Info("Handling Delete Counter")
+				counter.Destroy()
+				adminRedirect(c, "notice", fmt.Sprintf("Deleted %s", counter.Name))
+			})
+		})
+	}, adminAuthMiddleware, csrfMiddleware)
+
+	// JS, CSS and fonts embedded in the binary
+	r.GET(staticPrefix+"{file:.+}", staticAssets.Serve)
+
 	// Use the /api/v1 path as the root
 	r.Group("/api/v1", func() {
 		apiLogger := rootLogger.WithFields(logrus.Fields{
 			"path": "/api/v1",
 		})
 
-		// The Counter routes
+		// The OpenAPI 3 document describing this route tree
+		r.GET("/openapi.json", func(c *rux.Context) {
+			traceRoute(c, "API - OpenAPI Spec")
+
+			c.JSONBytes(200, embedOpenAPISpec)
+		})
+
+		// List every theme that can be selected
+		r.GET("/themes", func(c *rux.Context) {
+			traceRoute(c, "API - List Themes")
+
+			c.JSON(200, themes.All())
+		})
+
+		// Export every counter in this environment
+		r.GET("/export", func(c *rux.Context) {
+			traceRoute(c, "API - Export Counters")
+
+			logger := apiLogger.WithFields(logrus.Fields{
+				"path":   "/api/v1/export",
+				"method": "GET",
+			})
+			logger.Info("Handling Export request")
+
+			consulClient, err := newConsulClient()
+			if err != nil {
+				logger.WithError(err).Error("Failed to create Consul client")
+				c.AbortWithStatus(500, "Something bad happened")
+				return
+			}
+
+			doc, err := ExportCounters(consulClient)
+			if err != nil {
+				logger.WithError(err).Error("Failed to export counters")
+				c.AbortWithStatus(503, "The storage backend is unavailable")
+				return
+			}
+			out := bytes.Buffer{}
+			contentType := "application/json"
+			if c.Query("format") == "ndjson" || strings.Contains(c.Header("Accept"), "application/x-ndjson") {
+				contentType = "application/x-ndjson"
+				err = doc.WriteNDJSON(&out)
+			} else {
+				err = doc.WriteJSON(&out)
+			}
+			if err != nil {
+				logger.WithError(err).Error("Failed to write export")
+				c.AbortWithStatus(500, "Something bad happened")
+				return
+			}
+			c.Blob(200, contentType, out.Bytes())
+		}, backupAuthMiddleware)
+
+		// Import counters from an export document
+		r.POST("/import", func(c *rux.Context) {
+			traceRoute(c, "API - Import Counters")
+
+			mode := c.Query("mode", ImportModeSkip)
+			dryRun := false
+			if value, ok := c.QueryParam("dry_run"); ok {
+				// A bare ?dry_run means true
+				parsed, err := strconv.ParseBool(value)
+				if value != "" && err != nil {
+					c.AbortWithStatus(400, fmt.Sprintf("Invalid dry_run: %s", value))
+					return
+				}
+				dryRun = value == "" || parsed
+			}
+			logger := apiLogger.WithFields(logrus.Fields{
+				"path":    "/api/v1/import",
+				"method":  "POST",
+				"mode":    mode,
+				"dry_run": dryRun,
+			})
+			logger.Info("Handling Import request")
+
+			if !ValidImportMode(mode) {
+				c.AbortWithStatus(400, fmt.Sprintf("Unknown import mode: %s", mode))
+				return
+			}
+
+			doc, err := ReadCounterExport(c.Req.Body)
+			if err != nil {
+				logger.WithError(err).Warn("Failed to read import document")
+				c.AbortWithStatus(400, err.Error())
+				return
+			}
+
+			consulClient, err := newConsulClient()
+			if err != nil {
+				logger.WithError(err).Error("Failed to create Consul client")
+				c.AbortWithStatus(500, "Something bad happened")
+				return
+			}
+
+			results, err := ImportCounters(consulClient, doc, mode, dryRun)
+			if err != nil {
+				logger.WithError(err).Error("Failed to import counters")
+				c.AbortWithStatus(500, "Something bad happened")
+				return
+			}
+			c.JSON(200, results)
+		}, backupAuthMiddleware)
+
+		// Outbound webhooks, managed with the admin credentials
+		r.Group("/webhooks", func() {
+			logger := apiLogger.WithFields(logrus.Fields{
+				"path": "/api/v1/webhooks",
+			})
+
+			r.GET("", func(c *rux.Context) {
+				traceRoute(c, "API - List Webhooks")
+
+				hooks, err := handleWebhookStore(c.Req.Context()).List()
+				if err != nil {
+					logger.WithError(err).Error("Failed to list webhooks")
+					c.AbortWithStatus(500, "Something bad happened")
+					return
+				}
+				redacted := make([]Webhook, 0, len(hooks))
+				for _, hook := range hooks {
+					if counter := c.Query("counter"); counter == "" || hook.Counter == counter {
+						redacted = append(redacted, hook.Redacted())
+					}
+				}
+				c.JSON(200, redacted)
+			})
+
+			// The response is the only time the secret is shown
+			r.POST("", func(c *rux.Context) {
+				traceRoute(c, "API - Create Webhook")
+
+				var hook Webhook
+				if err := json.NewDecoder(c.Req.Body).Decode(&hook); err != nil {
+					c.AbortWithStatus(400, "Expected a JSON body like {\"url\": \"https://example.com/hook\", \"counter\": \"team-a\", \"events\": [\"win\"]}")
+					return
+				}
+				if err := handleWebhookStore(c.Req.Context()).Create(&hook); err != nil {
+					c.AbortWithStatus(400, err.Error())
+					return
+				}
+
+				logger.WithFields(logrus.Fields{
+					"webhook": hook.ID,
+					"counter": hook.Counter,
+				}).Info("Created webhook")
+				c.JSON(201, hook)
+			})
+
+			r.Group("/{id}", func() {
+				r.GET("", func(c *rux.Context) {
+					traceRoute(c, "API - Show Webhook")
+
+					hook, ok := handleWebhook(c)
+					if !ok {
+						return
+					}
+					c.JSON(200, hook.Redacted())
+				})
+
+				r.DELETE("", func(c *rux.Context) {
+					traceRoute(c, "API - Delete Webhook")
+
+					hook, ok := handleWebhook(c)
+					if !ok {
+						return
+					}
+					if err := handleWebhookStore(c.Req.Context()).Delete(hook.ID); err != nil {
+						logger.WithError(err).Error("Failed to delete webhook")
+						c.AbortWithStatus(500, "Something bad happened")
+						return
+					}
+					logger.WithField("webhook", hook.ID).Info("Deleted webhook")
+					c.JSON(200, hook.Redacted())
+				})
+
+				r.GET("/deliveries", func(c *rux.Context) {
+					traceRoute(c, "API - Show Webhook Deliveries")
+
+					hook, ok := handleWebhook(c)
+					if !ok {
+						return
+					}
+					deliveries, err := handleWebhookStore(c.Req.Context()).Deliveries(hook.ID)
+					if err != nil {
+						logger.WithError(err).Error("Failed to load webhook deliveries")
+						c.AbortWithStatus(500, "Something bad happened")
+						return
+					}
+					c.JSON(200, deliveries)
+				})
+
+				// Send a ping event to check the receiver
+				r.POST("/ping", func(c *rux.Context) {
+					traceRoute(c, "API - Ping Webhook")
+
+					hook, ok := handleWebhook(c)
+					if !ok {
+						return
+					}
+					delivery := webhooks.Send(handleWebhookStore(c.Req.Context()), hook, WebhookEventPing, 0, *NewWinLossCounter(hook.Counter))
+					c.JSON(202, map[string]string{"delivery": delivery})
+				})
+			})
+		}, adminAuthMiddleware, jsonBodyMiddleware)
+
+		// The Counter routes. Changes need the API write credentials when API_WRITE_PASSWORD is set.
 		r.Group("/counters", func() {
 			counterLogger := apiLogger.WithFields(logrus.Fields{
 				"path": "/aip/v1/counters",
 			})
 			// List all Counters
 			r.GET("", func(c *rux.Context) {
-				if hub := sentry.GetHubFromContext(c.Req.Context()); hub != nil {
-					hub.Scope().SetTransaction("API - List Counters")
-				}
+				traceRoute(c, "API - List Counters")
 
 				counterLogger.WithFields(logrus.Fields{
 					"method": "GET",
@@ -258,6 +1133,18 @@ func main() {
 				// counter.SetConsulClient(consulClient)
 
 				counterNames := counter.ListAll()
+				if wantsCSV(c) {
+					counters := make([]*WinLossCounter, 0, len(counterNames))
+					for _, counterName := range counterNames {
+						counters = append(counters, handleCounter(c.Req.Context(), counterName))
+					}
+
+					out := startCSVResponse(c, csvFilename("counters", envName))
+					if err := WriteCountersCSV(out, counters); err != nil {
+						counterLogger.WithError(err).Error("Failed to write counters CSV")
+					}
+					return
+				}
 				c.JSON(200, counterNames)
 			})
 
@@ -269,10 +1156,7 @@ func main() {
 				})
 
 				r.GET("", func(c *rux.Context) {
-					if hub := sentry.GetHubFromContext(c.Req.Context()); hub != nil {
-						hub.Scope().SetTransaction("API - Show Counter")
-						hub.Scope().SetExtra("counter_name", c.Param("name"))
-					}
+					traceRoute(c, "API - Show Counter")
 
 					logger.WithFields(logrus.Fields{
 						"name":   c.Param("name"),
@@ -286,10 +1170,7 @@ func main() {
 
 				// Allow deleting the counter
 				r.DELETE("", func(c *rux.Context) {
-					if hub := sentry.GetHubFromContext(c.Req.Context()); hub != nil {
-						hub.Scope().SetTransaction("API - Delete Counter")
-						hub.Scope().SetExtra("counter_name", c.Param("name"))
-					}
+					traceRoute(c, "API - Delete Counter")
 
 					logger.WithFields(logrus.Fields{
 						"name":   c.Param("name"),
@@ -302,12 +1183,87 @@ func main() {
 					c.JSON(200, counter)
 				})
 
+				// Show the counter's recorded results, oldest first
+				r.GET("/history", func(c *rux.Context) {
+					traceRoute(c, "API - Show Counter History")
+
+					logger.WithFields(logrus.Fields{
+						"name":   c.Param("name"),
+						"method": "GET",
+					}).Infof("Handling Show Counter History -> %s", c.Param("name"))
+					counter := handleCounter(c.Req.Context(), c.Param("name"))
+					history := counter.History()
+
+					if wantsCSV(c) {
+						out := startCSVResponse(c, csvFilename(counter.Name, "history"))
+						if err := WriteHistoryCSV(out, history); err != nil {
+							logger.WithError(err).Error("Failed to write history CSV")
+						}
+						return
+					}
+					c.JSON(200, history)
+				})
+
+				// Cumulative results and win rates over time, as drawn on the chart page
+				r.GET("/chart", func(c *rux.Context) {
+					traceRoute(c, "API - Show Counter Chart")
+
+					window, rolling, err := chartQuery(c)
+					if err != nil {
+						c.AbortWithStatus(400, err.Error())
+						return
+					}
+
+					logger.WithFields(logrus.Fields{
+						"name":   c.Param("name"),
+						"method": "GET",
+					}).Infof("Handling Show Counter Chart -> %s", c.Param("name"))
+					counter := handleCounter(c.Req.Context(), c.Param("name"))
+					c.JSON(200, counter.ChartSeries(window, rolling, time.Now()))
+				})
+
+				// Set or clear the counter's default theme
+				r.Group("/theme", func() {
+					r.PUT("", func(c *rux.Context) {
+						traceRoute(c, "API - Set Counter Theme")
+
+						var body struct {
+							Theme string `json:"theme"`
+						}
+						if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+							c.AbortWithStatus(400, "Expected a JSON body like {\"theme\": \"default\"}")
+							return
+						}
+						if _, ok := themes.Get(body.Theme); !ok {
+							c.AbortWithStatus(400, fmt.Sprintf("Unknown theme: %s", body.Theme))
+							return
+						}
+
+						logger.WithFields(logrus.Fields{
+							"name":   c.Param("name"),
+							"method": "PUT",
+							"theme":  body.Theme,
+						}).Infof("Handling Set Counter Theme -> %s", c.Param("name"))
+						counter := handleCounter(c.Req.Context(), c.Param("name"))
+						counter.SetTheme(body.Theme)
+						c.JSON(200, counter)
+					})
+					r.DELETE("", func(c *rux.Context) {
+						traceRoute(c, "API - Clear Counter Theme")
+
+						logger.WithFields(logrus.Fields{
+							"name":   c.Param("name"),
+							"method": "DELETE",
+						}).Infof("Handling Clear Counter Theme -> %s", c.Param("name"))
+						counter := handleCounter(c.Req.Context(), c.Param("name"))
+						counter.SetTheme("")
+						c.JSON(200, counter)
+					})
+				})
+
 				// Allow resetting the counter to ZERO
 				r.POST("/reset", func(c *rux.Context) {
-					if hub := sentry.GetHubFromContext(c.Req.Context()); hub != nil {
-						hub.Scope().SetTransaction("API - Reset Counter")
-						hub.Scope().SetExtra("counter_name", c.Param("name"))
-					}
+					traceRoute(c, "API - Reset Counter")
 
 					logger.WithFields(logrus.Fields{
 						"name":   c.Param("name"),
@@ -318,13 +1274,59 @@ func main() {
 					c.JSON(200, counter)
 				})
 
+				// Revert the most recent change
+				r.POST("/undo", func(c *rux.Context) {
+					traceRoute(c, "API - Undo Counter Change")
+
+					logger.WithFields(logrus.Fields{
+						"name":   c.Param("name"),
+						"method": "POST",
+					}).Infof("Handling Undo Counter Change -> %s", c.Param("name"))
+					counter := handleCounter(c.Req.Context(), c.Param("name"))
+					if !counter.Undo() {
+						c.AbortWithStatus(409, "Nothing to undo")
+						return
+					}
+					c.JSON(200, counter)
+				})
+
+				// Set the counter to arbitrary values; omitted fields keep their current value
+				r.POST("/adjust", func(c *rux.Context) {
+					traceRoute(c, "API - Adjust Counter")
+
+					var body struct {
+						Wins   *int `json:"wins"`
+						Losses *int `json:"losses"`
+						Draws  *int `json:"draws"`
+					}
+					if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+						c.AbortWithStatus(400, "Expected a JSON body like {\"wins\": 1, \"losses\": 2, \"draws\": 0}")
+						return
+					}
+
+					logger.WithFields(logrus.Fields{
+						"name":   c.Param("name"),
+						"method": "POST",
+					}).Infof("Handling Adjust Counter -> %s", c.Param("name"))
+					counter := handleCounter(c.Req.Context(), c.Param("name"))
+					wins, losses, draws := counter.Wins, counter.Losses, counter.Draws
+					if body.Wins != nil {
+						wins = *body.Wins
+					}
+					if body.Losses != nil {
+						losses = *body.Losses
+					}
+					if body.Draws != nil {
+						draws = *body.Draws
+					}
+					counter.Adjust(wins, losses, draws)
+					c.JSON(200, counter)
+				})
+
 				// Increment and Decrement Wins
 				r.Group("/win", func() {
 					r.GET("", func(c *rux.Context) {
-						if hub := sentry.GetHubFromContext(c.Req.Context()); hub != nil {
-							hub.Scope().SetTransaction("API - Show Counter Wins")
-							hub.Scope().SetExtra("counter_name", c.Param("name"))
-						}
+						traceRoute(c, "API - Show Counter Wins")
 
 						counter := handleCounter(c.Req.Context(), c.Param("name"))
 						color, ok := c.QueryParam("color")
@@ -339,10 +1341,7 @@ func main() {
 						c.JSON(200, counter)
 					})
 					r.PUT("", func(c *rux.Context) {
-						if hub := sentry.GetHubFromContext(c.Req.Context()); hub != nil {
-							hub.Scope().SetTransaction("API - Increment Counter Wins")
-							hub.Scope().SetExtra("counter_name", c.Param("name"))
-						}
+						traceRoute(c, "API - Increment Counter Wins")
 						logger.WithFields(logrus.Fields{
 							"name":   c.Param("name"),
 							"method": "PUT",
@@ -352,10 +1351,7 @@ func main() {
 						c.JSON(200, counter)
 					})
 					r.DELETE("", func(c *rux.Context) {
-						if hub := sentry.GetHubFromContext(c.Req.Context()); hub != nil {
-							hub.Scope().SetTransaction("API - Decrement Counter Wins")
-							hub.Scope().SetExtra("counter_name", c.Param("name"))
-						}
+						traceRoute(c, "API - Decrement Counter Wins")
 						logger.WithFields(logrus.Fields{
 							"name":   c.Param("name"),
 							"method": "DELETE",
@@ -369,10 +1365,7 @@ func main() {
 				// Increment and Decrement Losses
 				r.Group("/loss", func() {
 					r.GET("", func(c *rux.Context) {
-						if hub := sentry.GetHubFromContext(c.Req.Context()); hub != nil {
-							hub.Scope().SetTransaction("API - Show Counter Losses")
-							hub.Scope().SetExtra("counter_name", c.Param("name"))
-						}
+						traceRoute(c, "API - Show Counter Losses")
 
 						counter := handleCounter(c.Req.Context(), c.Param("name"))
 						color, ok := c.QueryParam("color")
@@ -387,10 +1380,7 @@ func main() {
 						c.JSON(200, counter)
 					})
 					r.PUT("", func(c *rux.Context) {
-						if hub := sentry.GetHubFromContext(c.Req.Context()); hub != nil {
-							hub.Scope().SetTransaction("API - Increment Counter Losses")
-							hub.Scope().SetExtra("counter_name", c.Param("name"))
-						}
+						traceRoute(c, "API - Increment Counter Losses")
 
 						logger.WithFields(logrus.Fields{
 							"name":   c.Param("name"),
@@ -403,10 +1393,7 @@ func main() {
 						c.JSON(200, counter)
 					})
 					r.DELETE("", func(c *rux.Context) {
-						if hub := sentry.GetHubFromContext(c.Req.Context()); hub != nil {
-							hub.Scope().SetTransaction("API - Decrement Counter Losses")
-							hub.Scope().SetExtra("counter_name", c.Param("name"))
-						}
+						traceRoute(c, "API - Decrement Counter Losses")
 
 						logger.WithFields(logrus.Fields{
 							"name":   c.Param("name"),
@@ -423,10 +1410,7 @@ func main() {
 				// Increment and Decrement Draws
 				r.Group("/draw", func() {
 					r.GET("", func(c *rux.Context) {
-						if hub := sentry.GetHubFromContext(c.Req.Context()); hub != nil {
-							hub.Scope().SetTransaction("API - Show Counter Draws")
-							hub.Scope().SetExtra("counter_name", c.Param("name"))
-						}
+						traceRoute(c, "API - Show Counter Draws")
 
 						counter := handleCounter(c.Req.Context(), c.Param("name"))
 						color, ok := c.QueryParam("color")
@@ -441,10 +1425,7 @@ func main() {
 						c.JSON(200, counter)
 					})
 					r.PUT("", func(c *rux.Context) {
-						if hub := sentry.GetHubFromContext(c.Req.Context()); hub != nil {
-							hub.Scope().SetTransaction("API - Increment Counter Draws")
-							hub.Scope().SetExtra("counter_name", c.Param("name"))
-						}
+						traceRoute(c, "API - Increment Counter Draws")
 
 						logger.WithFields(logrus.Fields{
 							"name":   c.Param("name"),
@@ -457,10 +1438,7 @@ func main() {
 						c.JSON(200, counter)
 					})
 					r.DELETE("", func(c *rux.Context) {
-						if hub := sentry.GetHubFromContext(c.Req.Context()); hub != nil {
-							hub.Scope().SetTransaction("API - Decrement Counter Draws")
-							hub.Scope().SetExtra("counter_name", c.Param("name"))
-						}
+						traceRoute(c, "API - Decrement Counter Draws")
 
 						logger.WithFields(logrus.Fields{
 							"name":   c.Param("name"),
@@ -473,9 +1451,83 @@ func main() {
 						c.JSON(200, counter)
 					})
 				})
+
+				// Any metric as a shields.io endpoint badge, colored by win rate
+				r.GET("/shields", func(c *rux.Context) {
+					traceRoute(c, "API - Shields Endpoint")
+
+					counter := handleCounter(c.Req.Context(), c.Param("name"))
+					endpoint, err := shieldsEndpointFromQuery(c, counter, winRateColors)
+					if err != nil {
+						c.AbortWithStatus(400, err.Error())
+						return
+					}
+					c.JSON(200, endpoint)
+				})
+
+				// Additional Numerics widgets for the counter
+				r.Group("/numerics", func() {
+					// Win rate as a percentage gauge
+					r.GET("/winrate", func(c *rux.Context) {
+						traceRoute(c, "API - Numerics Win Rate")
+
+						counter := handleCounter(c.Req.Context(), c.Param("name"))
+						c.JSON(200, counter.WinRateToNumericsGauge(c.Query("color", "green")))
+					})
+
+					// W/L/D split as a pie chart
+					r.GET("/split", func(c *rux.Context) {
+						traceRoute(c, "API - Numerics Split")
+
+						counter := handleCounter(c.Req.Context(), c.Param("name"))
+						c.JSON(200, counter.ToNumericsPieChart(c.Query("color", "blue")))
+					})
+
+					// Today vs. yesterday for a metric
+					r.GET("/diff", func(c *rux.Context) {
+						traceRoute(c, "API - Numerics Diff")
+
+						metric := c.Query("metric", MetricWins)
+						counter := handleCounter(c.Req.Context(), c.Param("name"))
+						widget, ok := counter.ToNumericsNumberDiff(metric, c.Query("color", "green"), time.Now())
+						if !ok {
+							c.AbortWithStatus(400, fmt.Sprintf("Unsupported metric: %s", metric))
+							return
+						}
+						c.JSON(200, widget)
+					})
+
+					// A metric over time as a line graph
+					r.GET("/graph", func(c *rux.Context) {
+						traceRoute(c, "API - Numerics Graph")
+
+						metric := c.Query("metric", MetricWinRate)
+						points, err := strconv.Atoi(c.Query("points", strconv.Itoa(numericsGraphPoints)))
+						if err != nil {
+							c.AbortWithStatus(400, "points must be a number")
+							return
+						}
+
+						counter := handleCounter(c.Req.Context(), c.Param("name"))
+						widget, ok := counter.ToNumericsLineGraph(metric, c.Query("color", "green"), points)
+						if !ok {
+							c.AbortWithStatus(400, fmt.Sprintf("Unsupported metric: %s", metric))
+							return
+						}
+						c.JSON(200, widget)
+					})
+
+					// Current streak as a label
+					r.GET("/streak", func(c *rux.Context) {
+						traceRoute(c, "API - Numerics Streak")
+
+						counter := handleCounter(c.Req.Context(), c.Param("name"))
+						c.JSON(200, counter.StreakToNumericsLabel(c.Query("color", "gray")))
+					})
+				})
 			})
-		})
+		}, apiWriteAuthMiddleware)
 	})
 
-	r.Listen(":3000")
+	return r
 }
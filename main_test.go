@@ -0,0 +1,18 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !testing.Verbose() {
+		logrus.SetOutput(io.Discard)
+	}
+	os.Exit(m.Run())
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gookit/rux"
+	"github.com/hashicorp/consul/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/r35krag0th/win-loss-rux/version"
+	"github.com/sirupsen/logrus"
+)
+
+// metricsNamespace prefixes the name of every metric of the service.
+const metricsNamespace = "winloss"
+
+// defaultCounterGaugeLimit caps how many counters get gauges unless METRICS_COUNTER_LIMIT says otherwise.
+const defaultCounterGaugeLimit = 50
+
+// counterGaugeTTL is how long the counter values read for a scrape are reused, so frequent
+// scrapes don't list every counter in Consul each time.
+const counterGaugeTTL = 15 * time.Second
+
+// metricsRegistry holds every metric served on /metrics.
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	backendDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "backend_operation_duration_seconds",
+		Help:      "Latency of storage backend (Consul) operations by operation and keyspace.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "keyspace"})
+
+	backendErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "backend_operation_errors_total",
+		Help:      "Failed storage backend (Consul) operations by operation and keyspace.",
+	}, []string{"operation", "keyspace"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpRequestDuration,
+		backendDuration,
+		backendErrors,
+	)
+}
+
+// metricsHandler serves the metrics in the Prometheus exposition format.
+func metricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// metricsMiddleware counts requests and their latency by route. The route is the pattern it was
+// registered with, e.g. /api/v1/counters/{name}, so counter names don't end up in label values.
+func metricsMiddleware(r *rux.Router) rux.HandlerFunc {
+	return func(c *rux.Context) {
+		started := time.Now()
+		c.Next()
+
+		route := routePattern(r, c)
+		httpRequests.WithLabelValues(c.Req.Method, route, strconv.Itoa(c.StatusCode())).Inc()
+		httpRequestDuration.WithLabelValues(c.Req.Method, route).Observe(time.Since(started).Seconds())
+	}
+}
+
+// routePattern returns the pattern of the route matching the request, or "unmatched".
+func routePattern(r *rux.Router, c *rux.Context) string {
+	if matched, _, _ := r.QuickMatch(c.Req.Method, c.Req.URL.Path); matched != nil {
+		return matched.Path()
+	}
+	return "unmatched"
+}
+
+// backendMetricsTransport times the requests of a Consul client.
+type backendMetricsTransport struct {
+	next http.RoundTripper
+}
+
+func (t backendMetricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	operation, keyspace, counter := backendOperation(req)
+	_, span := startChildSpan(req.Context(), "consul."+operation)
+	defer span.Finish()
+	span.SetAttribute("keyspace", keyspace)
+	if counter != "" {
+		span.SetAttribute("counter_name", counter)
+	}
+
+	started := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	took := time.Since(started)
+
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	span.SetAttribute("status", strconv.Itoa(status))
+	if err != nil {
+		span.RecordError(err)
+	} else if status >= 500 {
+		span.RecordError(fmt.Errorf("consul responded with %d", status))
+	}
+	backendDuration.WithLabelValues(operation, keyspace).Observe(took.Seconds())
+	if err != nil || status >= 500 {
+		backendErrors.WithLabelValues(operation, keyspace).Inc()
+	}
+	statsdBackendTiming(operation, keyspace, counter, status, took)
+	return resp, err
+}
+
+// backendOperation names a Consul request for the backend metrics and returns the counter it is
+// about, if any. Blocking queries are told apart because they are expected to take minutes.
+func backendOperation(req *http.Request) (string, string, string) {
+	key := strings.TrimPrefix(req.URL.Path, "/v1/kv/")
+	if key == req.URL.Path {
+		return "other", "other", ""
+	}
+
+	keyspace, counter := "other", ""
+	if rest := strings.TrimPrefix(key, "win-loss-api/"+envName+"/"); rest != key {
+		keyspace, counter, _ = strings.Cut(rest, "/")
+		if keyspace != "counters" && keyspace != "history" {
+			counter = ""
+		}
+	}
+
+	query := req.URL.Query()
+	operation := "get"
+	switch {
+	case req.Method == http.MethodDelete:
+		operation = "delete"
+	case req.Method == http.MethodPut && query.Has("cas"):
+		operation = "cas"
+	case req.Method == http.MethodPut:
+		operation = "put"
+	case query.Has("recurse") || query.Has("keys"):
+		operation = "list"
+	}
+	if index := query.Get("index"); index != "" && index != "0" {
+		operation += "_blocking"
+	}
+	return operation, keyspace, counter
+}
+
+// CounterGauges exports the values of the counters as gauges labelled by name and env. Every
+// counter is a set of series, so they are limited to Names if set and to Limit counters otherwise.
+type CounterGauges struct {
+	Names []string
+	Limit int
+
+	consulClient *api.Client
+	wins         *prometheus.Desc
+	losses       *prometheus.Desc
+	draws        *prometheus.Desc
+	omitted      *prometheus.Desc
+
+	mu      sync.Mutex
+	read    time.Time
+	metrics []prometheus.Metric
+}
+
+// CounterGaugesFromEnv creates the counter gauges if METRICS_COUNTER_GAUGES is true.
+// METRICS_COUNTER_NAMES limits them to a list of counters and METRICS_COUNTER_LIMIT caps their number.
+func CounterGaugesFromEnv() (*CounterGauges, error) {
+	if getenv("METRICS_COUNTER_GAUGES", "false") != "true" {
+		return nil, nil
+	}
+	limit, err := strconv.Atoi(getenv("METRICS_COUNTER_LIMIT", strconv.Itoa(defaultCounterGaugeLimit)))
+	if err != nil || limit < 1 {
+		return nil, errors.New("METRICS_COUNTER_LIMIT must be a positive number")
+	}
+	consulClient, err := newConsulClient()
+	if err != nil {
+		return nil, err
+	}
+
+	labels := []string{"name"}
+	constLabels := prometheus.Labels{"env": envName}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "counter", name), help, labels, constLabels)
+	}
+	return &CounterGauges{
+		Names:        splitList(os.Getenv("METRICS_COUNTER_NAMES")),
+		Limit:        limit,
+		consulClient: consulClient,
+		wins:         desc("wins", "Wins of the counter."),
+		losses:       desc("losses", "Losses of the counter."),
+		draws:        desc("draws", "Draws of the counter."),
+		omitted: prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "counter", "gauges_omitted"),
+			"Counters left out of the counter gauges because of METRICS_COUNTER_LIMIT.", nil, constLabels),
+	}, nil
+}
+
+// Describe implements prometheus.Collector.
+func (g *CounterGauges) Describe(ch chan<- *prometheus.Desc) {
+	ch <- g.wins
+	ch <- g.losses
+	ch <- g.draws
+	ch <- g.omitted
+}
+
+// Collect implements prometheus.Collector.
+func (g *CounterGauges) Collect(ch chan<- prometheus.Metric) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if time.Since(g.read) > counterGaugeTTL {
+		metrics, err := g.readCounters()
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"func":    "Collect",
+				"version": version.Version,
+			}).WithError(err).Error("Failed to read counters for metrics")
+			return
+		}
+		g.metrics, g.read = metrics, time.Now()
+	}
+	for _, metric := range g.metrics {
+		ch <- metric
+	}
+}
+
+func (g *CounterGauges) readCounters() ([]prometheus.Metric, error) {
+	pairs, _, err := g.consulClient.KV().List(consulKeyPrefix+"/", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	counters := map[string]*WinLossCounter{}
+	for _, pair := range pairs {
+		name := strings.TrimPrefix(pair.Key, consulKeyPrefix+"/")
+		if name == "" || strings.Contains(name, "/") || (len(g.Names) > 0 && !containsString(g.Names, name)) {
+			continue
+		}
+		counter := NewWinLossCounter(name)
+		if _, err := counter.decodeRecord(pair.Value); err == nil {
+			counters[name] = counter
+		}
+	}
+
+	names := make([]string, 0, len(counters))
+	for name := range counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	omitted := 0
+	if len(names) > g.Limit {
+		omitted = len(names) - g.Limit
+		names = names[:g.Limit]
+	}
+
+	metrics := []prometheus.Metric{prometheus.MustNewConstMetric(g.omitted, prometheus.GaugeValue, float64(omitted))}
+	for _, name := range names {
+		counter := counters[name]
+		metrics = append(metrics,
+			prometheus.MustNewConstMetric(g.wins, prometheus.GaugeValue, float64(counter.Wins), name),
+			prometheus.MustNewConstMetric(g.losses, prometheus.GaugeValue, float64(counter.Losses), name),
+			prometheus.MustNewConstMetric(g.draws, prometheus.GaugeValue, float64(counter.Draws), name),
+		)
+	}
+	return metrics, nil
+}
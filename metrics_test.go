@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCounterGauges(t *testing.T) {
+	tests := []struct {
+		name    string
+		names   string
+		limit   string
+		omitted int
+		want    []string
+	}{
+		{"every counter", "", "", 0, []string{"alpha", "bravo", "charlie"}},
+		{"named counters", "charlie, alpha, missing", "", 0, []string{"alpha", "charlie"}},
+		{"limited", "", "2", 1, []string{"alpha", "bravo"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			consul := useFakeConsul(t)
+			consul.Put(consulKeyPrefix+"/alpha", `{"schema_version":1,"name":"alpha","wins":3,"losses":1,"draws":0}`)
+			consul.Put(consulKeyPrefix+"/bravo", `{"schema_version":1,"name":"bravo","wins":0,"losses":2,"draws":1}`)
+			consul.Put(consulKeyPrefix+"/charlie", `{"schema_version":1,"name":"charlie","wins":5,"losses":5,"draws":5}`)
+			consul.Put(consulKeyPrefix+"/broken", `not json`)
+			t.Setenv("METRICS_COUNTER_GAUGES", "true")
+			t.Setenv("METRICS_COUNTER_NAMES", tt.names)
+			t.Setenv("METRICS_COUNTER_LIMIT", tt.limit)
+
+			gauges, err := CounterGaugesFromEnv()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			values := map[string][3]int{"alpha": {3, 1, 0}, "bravo": {0, 2, 1}, "charlie": {5, 5, 5}}
+			var expected strings.Builder
+			for i, metric := range []string{"Wins", "Losses", "Draws"} {
+				fmt.Fprintf(&expected, "# HELP winloss_counter_%s %s of the counter.\n# TYPE winloss_counter_%[1]s gauge\n", strings.ToLower(metric), metric)
+				for _, name := range tt.want {
+					fmt.Fprintf(&expected, "winloss_counter_%s{env=%q,name=%q} %d\n", strings.ToLower(metric), envName, name, values[name][i])
+				}
+			}
+			fmt.Fprintf(&expected, "# HELP winloss_counter_gauges_omitted Counters left out of the counter gauges because of METRICS_COUNTER_LIMIT.\n")
+			fmt.Fprintf(&expected, "# TYPE winloss_counter_gauges_omitted gauge\nwinloss_counter_gauges_omitted{env=%q} %d\n", envName, tt.omitted)
+
+			if err := testutil.CollectAndCompare(gauges, strings.NewReader(expected.String())); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCounterGaugesFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled string
+		limit   string
+		wantNil bool
+		wantErr bool
+	}{
+		{"disabled by default", "", "", true, false},
+		{"enabled", "true", "", false, false},
+		{"zero limit", "true", "0", true, true},
+		{"limit that isn't a number", "true", "lots", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useFakeConsul(t)
+			t.Setenv("METRICS_COUNTER_GAUGES", tt.enabled)
+			t.Setenv("METRICS_COUNTER_LIMIT", tt.limit)
+
+			gauges, err := CounterGaugesFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if (gauges == nil) != tt.wantNil {
+				t.Errorf("gauges = %v, want nil %v", gauges, tt.wantNil)
+			}
+			if gauges != nil && gauges.Limit != defaultCounterGaugeLimit {
+				t.Errorf("limit = %d, want %d", gauges.Limit, defaultCounterGaugeLimit)
+			}
+		})
+	}
+}
+
+func TestHTTPMetricsUseRoutePatterns(t *testing.T) {
+	r, consul := apiTestRouter(t, "")
+	consul.Put(consulKeyPrefix+"/team-a", `{"schema_version":1,"name":"team-a","wins":1,"losses":0,"draws":0}`)
+
+	before := testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodPut, "/api/v1/counters/{name}/win", "200"))
+	for _, name := range []string{"team-a", "team-b"} {
+		apiRequest{method: http.MethodPut, path: "/api/v1/counters/" + name + "/win"}.serve(r)
+	}
+	if got := testutil.ToFloat64(httpRequests.WithLabelValues(http.MethodPut, "/api/v1/counters/{name}/win", "200")) - before; got != 2 {
+		t.Errorf("counted %v increments, want 2", got)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, `winloss_http_requests_total{method="PUT",route="/api/v1/counters/{name}/win",status="200"}`) {
+		t.Fatalf("/metrics = %d without the increments:\n%s", w.Code, body)
+	}
+	if strings.Contains(body, "team-a") || strings.Contains(body, "team-b") {
+		t.Error("counter names ended up in the request metrics")
+	}
+	if !strings.Contains(body, `winloss_backend_operation_duration_seconds_count{keyspace="counters",operation="get"}`) {
+		t.Error("no backend metrics for reading the counters")
+	}
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/hashicorp/consul/api"
+	"github.com/r35krag0th/win-loss-rux/version"
+	"github.com/sirupsen/logrus"
+)
+
+// Commands accepted on a counter's command topic.
+const (
+	MQTTCommandWin   = "win"
+	MQTTCommandLoss  = "loss"
+	MQTTCommandDraw  = "draw"
+	MQTTCommandReset = "reset"
+)
+
+// Payloads of the availability topic, which the broker sets to offline when the bridge disconnects.
+const (
+	mqttOnline  = "online"
+	mqttOffline = "offline"
+)
+
+// MQTTConfig configures the bridge. It is read from MQTT_BROKER, MQTT_USERNAME, MQTT_PASSWORD,
+// MQTT_CLIENT_ID, MQTT_TOPIC_PREFIX and MQTT_DISCOVERY_PREFIX.
+type MQTTConfig struct {
+	Broker   string
+	Username string
+	Password string
+	ClientID string
+	// TopicPrefix is the root of the state and command topics, "winloss/<env>" by default.
+	TopicPrefix string
+	// DiscoveryPrefix is Home Assistant's discovery prefix. Empty disables discovery.
+	DiscoveryPrefix string
+}
+
+// MQTTConfigFromEnv reads the bridge configuration. It returns nil if MQTT_BROKER isn't set,
+// which disables the bridge. MQTT_DISCOVERY_PREFIX defaults to "homeassistant"; set it to
+// "none" to turn discovery off.
+func MQTTConfigFromEnv() *MQTTConfig {
+	broker := os.Getenv("MQTT_BROKER")
+	if broker == "" {
+		return nil
+	}
+
+	// Brokers disconnect a client when another one connects with the same ID, so every instance
+	// gets its own unless one is configured.
+	suffix, _ := randomHex(4)
+	config := &MQTTConfig{
+		Broker:          broker,
+		Username:        os.Getenv("MQTT_USERNAME"),
+		Password:        os.Getenv("MQTT_PASSWORD"),
+		ClientID:        getenv("MQTT_CLIENT_ID", "win-loss-"+envName+"-"+suffix),
+		TopicPrefix:     strings.TrimSuffix(getenv("MQTT_TOPIC_PREFIX", "winloss/"+envName), "/"),
+		DiscoveryPrefix: strings.TrimSuffix(getenv("MQTT_DISCOVERY_PREFIX", "homeassistant"), "/"),
+	}
+	if config.DiscoveryPrefix == "none" {
+		config.DiscoveryPrefix = ""
+	}
+	return config
+}
+
+func (c MQTTConfig) availabilityTopic() string {
+	return c.TopicPrefix + "/status"
+}
+
+// StateTopic is the retained topic holding the counter's MQTTState.
+func (c MQTTConfig) StateTopic(name string) string {
+	return c.TopicPrefix + "/" + name + "/state"
+}
+
+// CommandTopic is the topic the bridge takes commands for the counter from.
+func (c MQTTConfig) CommandTopic(name string) string {
+	return c.TopicPrefix + "/" + name + "/cmd"
+}
+
+// MQTTState is the payload of a counter's state topic.
+type MQTTState struct {
+	Name       string     `json:"name"`
+	PrettyName string     `json:"pretty_name"`
+	Wins       int        `json:"wins"`
+	Losses     int        `json:"losses"`
+	Draws      int        `json:"draws"`
+	Games      int        `json:"games"`
+	WinRate    float64    `json:"winrate"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+}
+
+// NewMQTTState collects the state of a counter.
+func NewMQTTState(counter *WinLossCounter) MQTTState {
+	return MQTTState{
+		Name:       counter.Name,
+		PrettyName: counter.PrettyName,
+		Wins:       counter.Wins,
+		Losses:     counter.Losses,
+		Draws:      counter.Draws,
+		Games:      counter.Games(),
+		WinRate:    winRatePercent(counter.Wins, counter.Losses, counter.Draws),
+		UpdatedAt:  counter.UpdatedAt,
+	}
+}
+
+// HADiscoveryMessage is one retained Home Assistant discovery config.
+type HADiscoveryMessage struct {
+	Topic   string
+	Payload map[string]interface{}
+}
+
+// haObjectIDChars matches what Home Assistant doesn't accept in IDs and topics.
+var haObjectIDChars = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// haObjectID turns a counter name into something Home Assistant accepts in IDs and topics.
+func haObjectID(name string) string {
+	return haObjectIDChars.ReplaceAllString(strings.ToLower(name), "_")
+}
+
+// HADiscovery returns the discovery configs that make a counter show up in Home Assistant as a
+// device with wins, losses, draws and win rate sensors and buttons to record results.
+func (c MQTTConfig) HADiscovery(counter *WinLossCounter) []HADiscoveryMessage {
+	if c.DiscoveryPrefix == "" {
+		return nil
+	}
+
+	objectID := "winloss_" + haObjectID(envName) + "_" + haObjectID(counter.Name)
+	device := map[string]interface{}{
+		"identifiers":  []string{objectID},
+		"name":         counter.PrettyName,
+		"manufacturer": "win-loss",
+		"sw_version":   version.Version,
+	}
+
+	var messages []HADiscoveryMessage
+	sensors := []struct{ key, name, unit string }{
+		{"wins", "Wins", ""},
+		{"losses", "Losses", ""},
+		{"draws", "Draws", ""},
+		{"winrate", "Win rate", "%"},
+	}
+	for _, sensor := range sensors {
+		payload := map[string]interface{}{
+			"name":               sensor.name,
+			"unique_id":          objectID + "_" + sensor.key,
+			"state_topic":        c.StateTopic(counter.Name),
+			"value_template":     "{{ value_json." + sensor.key + " }}",
+			"state_class":        "measurement",
+			"availability_topic": c.availabilityTopic(),
+			"device":             device,
+		}
+		if sensor.unit != "" {
+			payload["unit_of_measurement"] = sensor.unit
+		}
+		messages = append(messages, HADiscoveryMessage{
+			Topic:   fmt.Sprintf("%s/sensor/%s_%s/config", c.DiscoveryPrefix, objectID, sensor.key),
+			Payload: payload,
+		})
+	}
+
+	for _, command := range []string{MQTTCommandWin, MQTTCommandLoss, MQTTCommandDraw} {
+		messages = append(messages, HADiscoveryMessage{
+			Topic: fmt.Sprintf("%s/button/%s_%s/config", c.DiscoveryPrefix, objectID, command),
+			Payload: map[string]interface{}{
+				"name":               "Add " + command,
+				"unique_id":          objectID + "_" + command,
+				"command_topic":      c.CommandTopic(counter.Name),
+				"payload_press":      command,
+				"availability_topic": c.availabilityTopic(),
+				"device":             device,
+			},
+		})
+	}
+	return messages
+}
+
+// MQTTBridge publishes counter changes to MQTT and applies commands received from it.
+type MQTTBridge struct {
+	config       *MQTTConfig
+	consulClient *api.Client
+	client       mqtt.Client
+	logger       *logrus.Entry
+
+	// published holds the modify index last published for every counter.
+	published map[string]uint64
+}
+
+// NewMQTTBridge creates a bridge for the configuration.
+func NewMQTTBridge(config *MQTTConfig, consulClient *api.Client) *MQTTBridge {
+	b := &MQTTBridge{
+		config:       config,
+		consulClient: consulClient,
+		published:    map[string]uint64{},
+		logger: logrus.WithFields(logrus.Fields{
+			"func":    "MQTTBridge",
+			"broker":  config.Broker,
+			"version": version.Version,
+		}),
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(config.Broker).
+		SetClientID(config.ClientID).
+		SetUsername(config.Username).
+		SetPassword(config.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetWill(config.availabilityTopic(), mqttOffline, 1, true).
+		SetOnConnectHandler(b.onConnect).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			b.logger.WithError(err).Warn("Lost connection to MQTT broker")
+		})
+	b.client = mqtt.NewClient(opts)
+	return b
+}
+
+// onConnect runs after every (re)connect to mark the bridge online and renew the subscription.
+func (b *MQTTBridge) onConnect(client mqtt.Client) {
+	b.logger.Info("Connected to MQTT broker")
+	client.Publish(b.config.availabilityTopic(), 1, true, mqttOnline)
+	client.Subscribe(b.config.CommandTopic("+"), 1, b.onCommand)
+}
+
+// onCommand applies a command to an existing counter. The watch loop publishes the new state.
+func (b *MQTTBridge) onCommand(_ mqtt.Client, msg mqtt.Message) {
+	name := strings.TrimSuffix(strings.TrimPrefix(msg.Topic(), b.config.TopicPrefix+"/"), "/cmd")
+	command := strings.ToLower(strings.TrimSpace(string(msg.Payload())))
+	logger := b.logger.WithFields(logrus.Fields{
+		"name":    name,
+		"command": command,
+	})
+
+	if !ValidCounterName(name) {
+		logger.Warn("Ignoring command for invalid counter name")
+		return
+	}
+	counter := handleCounter(context.Background(), name)
+	if exists, err := counter.Exists(); err != nil || !exists {
+		logger.Warn("Ignoring command for unknown counter")
+		return
+	}
+
+	logger.Info("Handling MQTT command")
+	switch command {
+	case MQTTCommandWin:
+		counter.AddWin()
+	case MQTTCommandLoss:
+		counter.AddLoss()
+	case MQTTCommandDraw:
+		counter.AddDraw()
+	case MQTTCommandReset:
+		counter.Reset()
+	default:
+		logger.Warn("Ignoring unknown MQTT command")
+	}
+}
+
+// Run connects to the broker and publishes every change to the counters, watching them with
+// Consul blocking queries so changes made by any instance of the service are picked up. It runs
+// until stop is closed, or forever if stop is nil.
+func (b *MQTTBridge) Run(stop <-chan struct{}) {
+	b.client.Connect()
+	defer func() {
+		b.client.Publish(b.config.availabilityTopic(), 1, true, mqttOffline).WaitTimeout(time.Second)
+		b.client.Disconnect(250)
+	}()
+
+	// Closing stop cancels the blocking query in flight instead of waiting for it to time out
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	kv := b.consulClient.KV()
+	var waitIndex uint64
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		pairs, meta, err := kv.List(consulKeyPrefix+"/", (&api.QueryOptions{WaitIndex: waitIndex, WaitTime: 5 * time.Minute}).WithContext(ctx))
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			b.logger.WithError(err).Error("Failed to watch counters; retrying")
+			sleepOrStop(ctx, 5*time.Second)
+			continue
+		}
+
+		changed := meta.LastIndex != waitIndex
+		if meta.LastIndex < waitIndex {
+			waitIndex = 0
+		} else {
+			waitIndex = meta.LastIndex
+		}
+		if !changed {
+			sleepOrStop(ctx, time.Second)
+			continue
+		}
+		b.publishChanges(pairs)
+	}
+}
+
+// sleepOrStop waits for d, or until ctx is done.
+func sleepOrStop(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// publishChanges publishes the counters whose modify index changed since the last call and
+// clears the retained topics of deleted counters.
+func (b *MQTTBridge) publishChanges(pairs api.KVPairs) {
+	seen := map[string]bool{}
+	for _, pair := range pairs {
+		// Names from before they were validated may not be usable in topics
+		name := strings.TrimPrefix(pair.Key, consulKeyPrefix+"/")
+		if !ValidCounterName(name) {
+			continue
+		}
+		seen[name] = true
+		if b.published[name] == pair.ModifyIndex {
+			continue
+		}
+
+		counter := NewWinLossCounter(name)
+		if _, err := counter.decodeRecord(pair.Value); err != nil {
+			continue
+		}
+		if err := b.publish(counter); err != nil {
+			b.logger.WithError(err).WithField("name", name).Error("Failed to publish counter")
+			continue
+		}
+		b.published[name] = pair.ModifyIndex
+	}
+
+	for name := range b.published {
+		if !seen[name] {
+			b.unpublish(NewWinLossCounter(name))
+			delete(b.published, name)
+		}
+	}
+}
+
+// publish sends the counter's retained state, and its discovery configs the first time.
+func (b *MQTTBridge) publish(counter *WinLossCounter) error {
+	state, err := json.Marshal(NewMQTTState(counter))
+	if err != nil {
+		return err
+	}
+	if _, ok := b.published[counter.Name]; !ok {
+		for _, message := range b.config.HADiscovery(counter) {
+			payload, err := json.Marshal(message.Payload)
+			if err != nil {
+				return err
+			}
+			b.client.Publish(message.Topic, 1, true, payload)
+		}
+	}
+
+	token := b.client.Publish(b.config.StateTopic(counter.Name), 1, true, state)
+	if !token.WaitTimeout(10 * time.Second) {
+		return fmt.Errorf("timed out publishing to %s", b.config.StateTopic(counter.Name))
+	}
+	return token.Error()
+}
+
+// unpublish clears the retained state and discovery configs of a deleted counter.
+func (b *MQTTBridge) unpublish(counter *WinLossCounter) {
+	b.logger.WithField("name", counter.Name).Info("Removing deleted counter from MQTT")
+	for _, message := range b.config.HADiscovery(counter) {
+		b.client.Publish(message.Topic, 1, true, "")
+	}
+	b.client.Publish(b.config.StateTopic(counter.Name), 1, true, "")
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// mqttBroker is a small in-process MQTT 3.1.1 broker: QoS 0 and 1, retained messages, wildcard
+// subscriptions and last wills. The bridge talks to it over TCP with its real paho client.
+type mqttBroker struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	retained map[string][]byte
+	sessions map[*mqttSession]bool
+}
+
+// mqttSession is one connected client.
+type mqttSession struct {
+	conn    net.Conn
+	writeMu sync.Mutex
+	filters []string
+	will    *packets.PublishPacket
+}
+
+func newMQTTBroker(t *testing.T) *mqttBroker {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &mqttBroker{listener: listener, retained: map[string][]byte{}, sessions: map[*mqttSession]bool{}}
+	t.Cleanup(func() {
+		listener.Close()
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for session := range b.sessions {
+			session.conn.Close()
+		}
+	})
+	go b.serve()
+	return b
+}
+
+// URL is the broker address in the form paho expects.
+func (b *mqttBroker) URL() string {
+	return "tcp://" + b.listener.Addr().String()
+}
+
+// Retained returns the retained payload of a topic.
+func (b *mqttBroker) Retained(topic string) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	payload, ok := b.retained[topic]
+	return string(payload), ok
+}
+
+func (b *mqttBroker) serve() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(&mqttSession{conn: conn})
+	}
+}
+
+func (b *mqttBroker) handle(s *mqttSession) {
+	defer func() {
+		s.conn.Close()
+		b.mu.Lock()
+		delete(b.sessions, s)
+		b.mu.Unlock()
+		// A client that goes away without DISCONNECT leaves its will behind
+		if s.will != nil {
+			b.route(s.will)
+		}
+	}()
+
+	for {
+		packet, err := packets.ReadPacket(s.conn)
+		if err != nil {
+			return
+		}
+		switch p := packet.(type) {
+		case *packets.ConnectPacket:
+			if p.WillFlag {
+				will := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+				will.TopicName, will.Payload, will.Retain = p.WillTopic, p.WillMessage, p.WillRetain
+				s.will = will
+			}
+			b.mu.Lock()
+			b.sessions[s] = true
+			b.mu.Unlock()
+			s.write(packets.NewControlPacket(packets.Connack))
+		case *packets.SubscribePacket:
+			suback := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			suback.MessageID = p.MessageID
+			suback.ReturnCodes = make([]byte, len(p.Topics))
+			s.write(suback)
+
+			b.mu.Lock()
+			s.filters = append(s.filters, p.Topics...)
+			var retained []*packets.PublishPacket
+			for topic, payload := range b.retained {
+				for _, filter := range p.Topics {
+					if mqttTopicMatches(filter, topic) {
+						message := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+						message.TopicName, message.Payload, message.Retain = topic, payload, true
+						retained = append(retained, message)
+						break
+					}
+				}
+			}
+			b.mu.Unlock()
+			for _, message := range retained {
+				s.write(message)
+			}
+		case *packets.PublishPacket:
+			if p.Qos > 0 {
+				puback := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				puback.MessageID = p.MessageID
+				s.write(puback)
+			}
+			b.route(p)
+		case *packets.PingreqPacket:
+			s.write(packets.NewControlPacket(packets.Pingresp))
+		case *packets.DisconnectPacket:
+			s.will = nil
+			return
+		}
+	}
+}
+
+// route stores a retained message and delivers it to every matching subscription.
+func (b *mqttBroker) route(p *packets.PublishPacket) {
+	b.mu.Lock()
+	if p.Retain {
+		if len(p.Payload) == 0 {
+			delete(b.retained, p.TopicName)
+		} else {
+			b.retained[p.TopicName] = p.Payload
+		}
+	}
+	var subscribers []*mqttSession
+	for session := range b.sessions {
+		for _, filter := range session.filters {
+			if mqttTopicMatches(filter, p.TopicName) {
+				subscribers = append(subscribers, session)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	for _, session := range subscribers {
+		message := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+		message.TopicName, message.Payload = p.TopicName, p.Payload
+		session.write(message)
+	}
+}
+
+func (s *mqttSession) write(packet packets.ControlPacket) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	packet.Write(s.conn)
+}
+
+// mqttTopicMatches reports whether a topic matches a subscription filter with + and # wildcards.
+func mqttTopicMatches(filter, topic string) bool {
+	filterLevels, topicLevels := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) || (level != "+" && level != topicLevels[i]) {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
+
+// mqttPublish is one message received by an mqttObserver.
+type mqttPublish struct {
+	Topic    string
+	Retained bool
+	Payload  string
+}
+
+// mqttObserver is a second client on the broker, subscribed to every topic.
+type mqttObserver struct {
+	client   mqtt.Client
+	received chan mqttPublish
+}
+
+func newMQTTObserver(t *testing.T, broker *mqttBroker) *mqttObserver {
+	t.Helper()
+	o := &mqttObserver{received: make(chan mqttPublish, 1000)}
+	o.client = mqtt.NewClient(mqtt.NewClientOptions().AddBroker(broker.URL()).SetClientID("observer"))
+	if token := o.client.Connect(); !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+		t.Fatalf("observer didn't connect: %v", token.Error())
+	}
+	t.Cleanup(func() { o.client.Disconnect(0) })
+
+	token := o.client.Subscribe("#", 0, func(_ mqtt.Client, msg mqtt.Message) {
+		o.received <- mqttPublish{Topic: msg.Topic(), Retained: msg.Retained(), Payload: string(msg.Payload())}
+	})
+	if !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+		t.Fatalf("observer didn't subscribe: %v", token.Error())
+	}
+	return o
+}
+
+// publish sends a message as another client would.
+func (o *mqttObserver) publish(t *testing.T, topic, payload string) {
+	t.Helper()
+	if token := o.client.Publish(topic, 1, false, payload); !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+		t.Fatalf("publishing to %s: %v", topic, token.Error())
+	}
+}
+
+// waitFor collects received messages until one matches done or the wait expires.
+func (o *mqttObserver) waitFor(t *testing.T, done func(mqttPublish) bool) []mqttPublish {
+	t.Helper()
+	var all []mqttPublish
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case p := <-o.received:
+			all = append(all, p)
+			if done(p) {
+				return all
+			}
+		case <-timeout:
+			t.Fatalf("gave up waiting for MQTT messages; got %+v", all)
+			return nil
+		}
+	}
+}
+
+// waitForRetained waits until the broker holds a retained message for topic.
+func waitForRetained(t *testing.T, broker *mqttBroker, topic string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, ok := broker.Retained(topic); ok {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("nothing was retained on %s", topic)
+}
+
+func decodeMQTTState(t *testing.T, p mqttPublish) MQTTState {
+	t.Helper()
+	var state MQTTState
+	if err := json.Unmarshal([]byte(p.Payload), &state); err != nil {
+		t.Fatalf("%s: %s", p.Topic, err)
+	}
+	return state
+}
+
+func TestMQTTTopicMatches(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{"winloss/+/cmd", "winloss/team-a/cmd", true},
+		{"winloss/+/cmd", "winloss/team-a/state", false},
+		{"winloss/#", "winloss/team-a/state", true},
+		{"#", "homeassistant/sensor/x/config", true},
+		{"winloss/status", "winloss/status", true},
+		{"winloss/status", "winloss/status/x", false},
+	}
+	for _, tt := range tests {
+		if got := mqttTopicMatches(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("mqttTopicMatches(%q, %q) = %t, want %t", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestMQTTBridge(t *testing.T) {
+	consul := useFakeConsul(t)
+	consul.Put(consulKeyPrefix+"/team-a", `{"schema_version":1,"name":"team-a","pretty_name":"Team A","wins":2,"losses":1,"draws":0}`)
+	consulClient, err := newConsulClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker := newMQTTBroker(t)
+
+	config := &MQTTConfig{
+		Broker:          broker.URL(),
+		ClientID:        "test",
+		TopicPrefix:     "winloss/test",
+		DiscoveryPrefix: "homeassistant",
+	}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		NewMQTTBridge(config, consulClient).Run(stop)
+		close(stopped)
+	}()
+
+	stateTopic := config.StateTopic("team-a")
+	isState := func(p mqttPublish) bool { return p.Topic == stateTopic }
+	waitForRetained(t, broker, stateTopic)
+
+	// A client that subscribes later gets the status, discovery and state from the broker's
+	// retained messages
+	observer := newMQTTObserver(t, broker)
+	received := map[string]mqttPublish{}
+	expected := len(config.HADiscovery(NewWinLossCounter("team-a"))) + 2
+	observer.waitFor(t, func(p mqttPublish) bool {
+		received[p.Topic] = p
+		return len(received) == expected
+	})
+	for topic, p := range received {
+		if !p.Retained {
+			t.Errorf("%s was not delivered as a retained message", topic)
+		}
+	}
+	if status := received["winloss/test/status"]; status.Payload != mqttOnline {
+		t.Errorf("status = %+v, want online", status)
+	}
+	var discovery []HADiscoveryMessage
+	for _, message := range config.HADiscovery(NewWinLossCounter("team-a")) {
+		var payload map[string]interface{}
+		if err := json.Unmarshal([]byte(received[message.Topic].Payload), &payload); err != nil {
+			t.Fatalf("discovery config %s: %s", message.Topic, err)
+		}
+		discovery = append(discovery, HADiscoveryMessage{Topic: message.Topic, Payload: payload})
+	}
+	checkGoldenJSON(t, "mqtt/discovery.golden", discovery)
+	if state := decodeMQTTState(t, received[stateTopic]); state.Wins != 2 || state.Losses != 1 || state.Games != 3 {
+		t.Errorf("initial state = %+v", state)
+	}
+
+	// A change made elsewhere is published without repeating discovery
+	consul.Put(consulKeyPrefix+"/team-a", `{"schema_version":1,"name":"team-a","pretty_name":"Team A","wins":2,"losses":2,"draws":0}`)
+	published := observer.waitFor(t, isState)
+	if len(published) != 1 {
+		t.Errorf("a change published %+v, want only the state", published)
+	}
+	if state := decodeMQTTState(t, published[0]); state.Losses != 2 || state.WinRate != 50 {
+		t.Errorf("state after the change = %+v", state)
+	}
+
+	// Commands change existing counters; the watch publishes the result
+	observer.publish(t, config.CommandTopic("team-a"), " WIN ")
+	published = observer.waitFor(t, isState)
+	if state := decodeMQTTState(t, published[len(published)-1]); state.Wins != 3 {
+		t.Errorf("state after the win command = %+v", state)
+	}
+	observer.publish(t, config.CommandTopic("team-b"), "win")
+	observer.publish(t, config.CommandTopic("team-a"), "forfeit")
+	observer.publish(t, config.CommandTopic("team-a"), MQTTCommandReset)
+	published = observer.waitFor(t, isState)
+	if state := decodeMQTTState(t, published[len(published)-1]); state.Games != 0 {
+		t.Errorf("state after the reset command = %+v", state)
+	}
+	if _, ok := consul.Get(consulKeyPrefix + "/team-b"); ok {
+		t.Error("a command created an unknown counter")
+	}
+	if retained, _ := broker.Retained(stateTopic); !strings.Contains(retained, `"games":0`) {
+		t.Errorf("retained state = %s, want the reset counter", retained)
+	}
+
+	// Deleting the counter clears its retained state and discovery configs
+	consul.Delete(consulKeyPrefix + "/team-a")
+	observer.waitFor(t, isState)
+	if _, ok := broker.Retained(stateTopic); ok {
+		t.Error("the state of the deleted counter is still retained")
+	}
+	for _, message := range discovery {
+		if _, ok := broker.Retained(message.Topic); ok {
+			t.Errorf("%s is still retained", message.Topic)
+		}
+	}
+
+	// Closing stop ends the blocking watch right away and marks the bridge offline
+	close(stop)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the bridge didn't stop")
+	}
+	if status, _ := broker.Retained("winloss/test/status"); status != mqttOffline {
+		t.Errorf("status after stopping = %q, want offline", status)
+	}
+}
+
+func TestMQTTDiscoveryDisabled(t *testing.T) {
+	t.Setenv("MQTT_BROKER", "tcp://localhost:1883")
+	t.Setenv("MQTT_DISCOVERY_PREFIX", "none")
+	config := MQTTConfigFromEnv()
+	if config.DiscoveryPrefix != "" {
+		t.Fatalf("discovery prefix = %q", config.DiscoveryPrefix)
+	}
+	if messages := config.HADiscovery(NewWinLossCounter("team-a")); messages != nil {
+		t.Errorf("discovery without a prefix = %+v", messages)
+	}
+	if !strings.HasPrefix(config.ClientID, "win-loss-") {
+		t.Errorf("client ID = %q", config.ClientID)
+	}
+}
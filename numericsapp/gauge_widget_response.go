@@ -0,0 +1,23 @@
+package numericsapp
+
+// GaugeWidgetResponse is the response for the Numerics iOS App gauge and percentage widgets.
+// The value is drawn between Min and Max.
+type GaugeWidgetResponse struct {
+	WidgetResponse
+	Data *NDataFloat `json:"data"`
+	Min  *NDataFloat `json:"min"`
+	Max  *NDataFloat `json:"max"`
+}
+
+// NewPercentageWidgetResponse creates a gauge spanning 0 to 100 for a percentage.
+func NewPercentageWidgetResponse(postfix, color string, percent float64) *GaugeWidgetResponse {
+	return &GaugeWidgetResponse{
+		WidgetResponse: WidgetResponse{
+			Postfix: postfix,
+			Color:   color,
+		},
+		Data: NewNDataFloat(percent),
+		Min:  NewNDataFloat(0),
+		Max:  NewNDataFloat(100),
+	}
+}
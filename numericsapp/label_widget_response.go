@@ -0,0 +1,18 @@
+package numericsapp
+
+// LabelWidgetResponse is the response for the Numerics iOS App label widget, which shows text.
+type LabelWidgetResponse struct {
+	WidgetResponse
+	Data *NDataString `json:"data"`
+}
+
+// NewLabelWidgetResponse creates a label widget showing text.
+func NewLabelWidgetResponse(postfix, color, text string) *LabelWidgetResponse {
+	return &LabelWidgetResponse{
+		WidgetResponse: WidgetResponse{
+			Postfix: postfix,
+			Color:   color,
+		},
+		Data: NewNDataString(text),
+	}
+}
@@ -0,0 +1,8 @@
+package numericsapp
+
+// LineGraphWidgetResponse is the response for the Numerics iOS App line graph widget.
+// Data points are drawn in order, oldest first.
+type LineGraphWidgetResponse struct {
+	WidgetResponse
+	Data []*NDataFloat `json:"data"`
+}
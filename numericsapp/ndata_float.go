@@ -0,0 +1,12 @@
+package numericsapp
+
+// NDataFloat is a data structure that represents a decimal number for the Numerics iOS App
+type NDataFloat struct {
+	Value float64 `json:"value"`
+}
+
+func NewNDataFloat(v float64) *NDataFloat {
+	return &NDataFloat{
+		Value: v,
+	}
+}
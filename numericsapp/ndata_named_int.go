@@ -0,0 +1,14 @@
+package numericsapp
+
+// NDataNamedInt is a data structure that represents a labelled integer for the Numerics iOS App
+type NDataNamedInt struct {
+	Name  string `json:"name"`
+	Value int    `json:"value"`
+}
+
+func NewNDataNamedInt(name string, v int) *NDataNamedInt {
+	return &NDataNamedInt{
+		Name:  name,
+		Value: v,
+	}
+}
@@ -0,0 +1,12 @@
+package numericsapp
+
+// NDataString is a data structure that represents text for the Numerics iOS App
+type NDataString struct {
+	Value string `json:"value"`
+}
+
+func NewNDataString(v string) *NDataString {
+	return &NDataString{
+		Value: v,
+	}
+}
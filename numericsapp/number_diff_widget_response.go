@@ -0,0 +1,19 @@
+package numericsapp
+
+// NumberDiffWidgetResponse is the response for the Numerics iOS App number diff widget.
+// Data holds exactly two values: the current value followed by the value it is compared against.
+type NumberDiffWidgetResponse struct {
+	WidgetResponse
+	Data []*NDataInt `json:"data"`
+}
+
+// NewNumberDiffWidgetResponse creates a number diff widget comparing current against previous.
+func NewNumberDiffWidgetResponse(postfix, color string, current, previous int) *NumberDiffWidgetResponse {
+	return &NumberDiffWidgetResponse{
+		WidgetResponse: WidgetResponse{
+			Postfix: postfix,
+			Color:   color,
+		},
+		Data: []*NDataInt{NewNDataInt(current), NewNDataInt(previous)},
+	}
+}
@@ -0,0 +1,8 @@
+package numericsapp
+
+// PieChartWidgetResponse is the response for the Numerics iOS App pie chart widget.
+// Every slice is a named value.
+type PieChartWidgetResponse struct {
+	WidgetResponse
+	Data []*NDataNamedInt `json:"data"`
+}
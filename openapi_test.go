@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gookit/rux"
+	"github.com/sirupsen/logrus"
+)
+
+// specOperations returns every "METHOD /path" described by the embedded OpenAPI spec.
+func specOperations(t *testing.T) map[string]bool {
+	t.Helper()
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(embedOpenAPISpec, &spec); err != nil {
+		t.Fatalf("api/openapi.json is not valid JSON: %s", err)
+	}
+
+	operations := map[string]bool{}
+	for path, item := range spec.Paths {
+		for method := range item {
+			switch method {
+			case "get", "put", "post", "patch", "delete", "head", "options":
+				operations[strings.ToUpper(method)+" "+path] = true
+			}
+		}
+	}
+	return operations
+}
+
+// routerOperations returns every "METHOD /path" registered on the router.
+func routerOperations(r *rux.Router) map[string]bool {
+	operations := map[string]bool{}
+	r.IterateRoutes(func(route *rux.Route) {
+		for _, method := range route.Methods() {
+			operations[method+" "+route.Path()] = true
+		}
+	})
+	return operations
+}
+
+// documented reports whether a registered route belongs in the spec: the JSON API and the
+// health endpoints do, the HTML pages and integrations with their own contracts don't.
+func documented(operation string) bool {
+	path := operation[strings.Index(operation, " ")+1:]
+	switch path {
+	case "/healthz", "/readyz", "/version":
+		return true
+	}
+	return strings.HasPrefix(path, "/api/v1/")
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestOpenAPISpecMatchesRouter(t *testing.T) {
+	spec := specOperations(t)
+	routes := routerOperations(newRouter(logrus.NewEntry(logrus.StandardLogger()), &ReadinessCheck{}))
+
+	for _, operation := range sortedKeys(routes) {
+		if documented(operation) && !spec[operation] {
+			t.Errorf("%s is registered but missing from api/openapi.json", operation)
+		}
+	}
+	for _, operation := range sortedKeys(spec) {
+		if !routes[operation] {
+			t.Errorf("%s is in api/openapi.json but no route is registered for it", operation)
+		}
+	}
+}
+
+func TestOpenAPISpecIsServed(t *testing.T) {
+	r := newRouter(logrus.NewEntry(logrus.StandardLogger()), nil)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/v1/openapi.json = %d", w.Code)
+	}
+	if !json.Valid(w.Body.Bytes()) {
+		t.Error("the served spec is not valid JSON")
+	}
+}
@@ -0,0 +1,80 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// CurrentVersion is the schema_version written by Encode.
+// Adding a version means bumping this constant and registering a Migration from the previous version.
+// New optional fields that older documents can simply omit don't need a new version.
+const CurrentVersion = 1
+
+// CounterRecord is the document persisted in the storage backend for a single counter.
+// It is deliberately separate from the API response types so that changes to those
+// don't silently change what is stored.
+type CounterRecord struct {
+	SchemaVersion int        `json:"schema_version"`
+	Name          string     `json:"name"`
+	PrettyName    string     `json:"pretty_name,omitempty"`
+	Wins          int        `json:"wins"`
+	Losses        int        `json:"losses"`
+	Draws         int        `json:"draws"`
+	Theme         string     `json:"theme,omitempty"`
+	UpdatedAt     *time.Time `json:"updated_at,omitempty"`
+}
+
+// Encode marshals the record at CurrentVersion.
+func Encode(record CounterRecord) ([]byte, error) {
+	record.SchemaVersion = CurrentVersion
+	return json.Marshal(record)
+}
+
+// Decode unmarshals a stored document of any known version, migrating it to CurrentVersion.
+// The returned version is the schema_version the document was stored with, so callers
+// can tell whether it needs to be written back.
+func Decode(data []byte) (*CounterRecord, int, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, 0, err
+	}
+
+	storedVersion, err := documentVersion(doc)
+	if err != nil {
+		return nil, 0, err
+	}
+	if storedVersion > CurrentVersion {
+		return nil, storedVersion, fmt.Errorf("schema_version %d is newer than supported version %d", storedVersion, CurrentVersion)
+	}
+
+	if err = Migrate(doc, storedVersion); err != nil {
+		return nil, storedVersion, err
+	}
+
+	migrated, err := json.Marshal(doc)
+	if err != nil {
+		return nil, storedVersion, err
+	}
+
+	var record CounterRecord
+	if err = json.Unmarshal(migrated, &record); err != nil {
+		return nil, storedVersion, err
+	}
+	return &record, storedVersion, nil
+}
+
+// documentVersion reads schema_version from a raw document. Documents written before
+// versioning existed have no schema_version and are version 0.
+func documentVersion(doc map[string]json.RawMessage) (int, error) {
+	raw, ok := doc["schema_version"]
+	if !ok {
+		return 0, nil
+	}
+
+	var v int
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return 0, fmt.Errorf("invalid schema_version: %w", err)
+	}
+	return v, nil
+}
@@ -0,0 +1,150 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// decodeResult is what the golden files of TestDecode record for each stored document.
+type decodeResult struct {
+	StoredVersion int             `json:"stored_version"`
+	Record        *CounterRecord  `json:"record,omitempty"`
+	Encoded       json.RawMessage `json:"encoded,omitempty"`
+	Error         string          `json:"error,omitempty"`
+}
+
+// fixtures returns the names of the stored documents in testdata, without their extension.
+func fixtures(t *testing.T) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no fixtures in testdata")
+	}
+	names := make([]string, len(paths))
+	for i, path := range paths {
+		names[i] = strings.TrimSuffix(filepath.Base(path), ".json")
+	}
+	return names
+}
+
+// checkGolden compares got with testdata/<name>, or rewrites it with -update.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%s (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s does not match\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+func marshalGolden(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(b, '\n')
+}
+
+func TestDecode(t *testing.T) {
+	for _, name := range fixtures(t) {
+		t.Run(name, func(t *testing.T) {
+			stored, err := os.ReadFile(filepath.Join("testdata", name+".json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			record, storedVersion, err := Decode(stored)
+			result := decodeResult{StoredVersion: storedVersion, Record: record}
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				// What a migrated counter is written back as
+				encoded, err := Encode(*record)
+				if err != nil {
+					t.Fatal(err)
+				}
+				result.Encoded = encoded
+			}
+			checkGolden(t, name+".decode.golden", marshalGolden(t, result))
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	for _, name := range fixtures(t) {
+		t.Run(name, func(t *testing.T) {
+			stored, err := os.ReadFile(filepath.Join("testdata", name+".json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var doc map[string]json.RawMessage
+			if err := json.Unmarshal(stored, &doc); err != nil {
+				t.Fatal(err)
+			}
+			from, err := documentVersion(doc)
+			if err != nil {
+				t.Skipf("not a migratable document: %s", err)
+			}
+
+			if err := Migrate(doc, from); err != nil {
+				checkGolden(t, name+".migrate.golden", []byte("error: "+err.Error()+"\n"))
+				return
+			}
+			checkGolden(t, name+".migrate.golden", marshalGolden(t, doc))
+		})
+	}
+}
+
+func TestMigrateIsIdempotent(t *testing.T) {
+	stored, err := os.ReadFile(filepath.Join("testdata", "v0_legacy.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, _, err := Decode(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := Encode(*record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	again, storedVersion, err := Decode(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if storedVersion != CurrentVersion {
+		t.Errorf("re-decoded schema_version = %d, want %d", storedVersion, CurrentVersion)
+	}
+	if !reflect.DeepEqual(again, record) {
+		t.Errorf("re-decoded record = %+v, want %+v", *again, *record)
+	}
+}
+
+func TestMigrateWithoutRegisteredMigration(t *testing.T) {
+	doc := map[string]json.RawMessage{"name": json.RawMessage(`"x"`)}
+	if err := Migrate(doc, -1); err == nil {
+		t.Fatal("Migrate from an unknown version succeeded")
+	}
+}
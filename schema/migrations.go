@@ -0,0 +1,48 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Migration upgrades a raw stored document by exactly one schema version, in place.
+type Migration func(doc map[string]json.RawMessage) error
+
+// migrations maps the version a Migration upgrades from to the Migration itself.
+var migrations = map[int]Migration{
+	0: migrateV0ToV1,
+}
+
+// Migrate runs every Migration needed to bring a document at version from up to CurrentVersion,
+// updating its schema_version as it goes.
+func Migrate(doc map[string]json.RawMessage, from int) error {
+	for v := from; v < CurrentVersion; v++ {
+		migration, ok := migrations[v]
+		if !ok {
+			return fmt.Errorf("no migration registered from schema_version %d", v)
+		}
+		if err := migration(doc); err != nil {
+			return fmt.Errorf("migrating from schema_version %d: %w", v, err)
+		}
+
+		raw, err := json.Marshal(v + 1)
+		if err != nil {
+			return err
+		}
+		doc["schema_version"] = raw
+	}
+	return nil
+}
+
+// migrateV0ToV1 upgrades the unversioned documents produced by marshalling the API type directly.
+// Those carried the untagged, always empty, Urls block which is not part of the stored state.
+func migrateV0ToV1(doc map[string]json.RawMessage) error {
+	delete(doc, "Urls")
+
+	for _, key := range []string{"wins", "losses", "draws"} {
+		if _, ok := doc[key]; !ok {
+			doc[key] = json.RawMessage("0")
+		}
+	}
+	return nil
+}
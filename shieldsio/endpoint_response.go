@@ -0,0 +1,26 @@
+package shieldsio
+
+// SchemaVersion is the version of the endpoint badge schema implemented by EndpointResponse.
+const SchemaVersion = 1
+
+// EndpointResponse is a data structure that serves JSON data for shields.io endpoint badges
+// (https://shields.io/badges/endpoint-badge).
+type EndpointResponse struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Label         string `json:"label"`
+	Message       string `json:"message"`
+	Color         string `json:"color,omitempty"`
+	LabelColor    string `json:"labelColor,omitempty"`
+	IsError       bool   `json:"isError,omitempty"`
+	CacheSeconds  int    `json:"cacheSeconds,omitempty"`
+}
+
+// NewEndpointResponse creates an endpoint badge showing label and message on a background of color.
+func NewEndpointResponse(label, message, color string) *EndpointResponse {
+	return &EndpointResponse{
+		SchemaVersion: SchemaVersion,
+		Label:         label,
+		Message:       message,
+		Color:         color,
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/r35krag0th/win-loss-rux/version"
+	"github.com/sirupsen/logrus"
+)
+
+// Headers Slack signs every request with, see https://api.slack.com/authentication/verifying-requests-from-slack
+const (
+	SlackSignatureHeader = "X-Slack-Signature"
+	SlackTimestampHeader = "X-Slack-Request-Timestamp"
+)
+
+// maxSlackSkew is how old a signed request may be before it is refused as a possible replay.
+const maxSlackSkew = 5 * time.Minute
+
+// maxSlackBody caps the size of requests read from Slack.
+const maxSlackBody = 64 << 10
+
+// Operations of the slash command, as in "/wl win team-a". The buttons use the same names.
+const (
+	SlackOperationWin    = "win"
+	SlackOperationLoss   = "loss"
+	SlackOperationDraw   = "draw"
+	SlackOperationUndo   = "undo"
+	SlackOperationRecord = "record"
+
+	SlackOperationRemoveWin  = "remove-win"
+	SlackOperationRemoveLoss = "remove-loss"
+	SlackOperationRemoveDraw = "remove-draw"
+)
+
+// slackActionPrefix marks the action IDs of the buttons this service renders.
+const slackActionPrefix = "wl_"
+
+// slackUsage is shown for "/wl help" and for commands that can't be parsed.
+const slackUsage = "Usage: `/wl win|loss|draw|remove-win|remove-loss|remove-draw|undo|record <counter>`"
+
+// slackResponses tracks the button presses still being answered, so shutdown can wait for them.
+var slackResponses sync.WaitGroup
+
+// SlackVerifier checks the signature of requests from Slack.
+type SlackVerifier struct {
+	SigningSecret string
+	now           func() time.Time
+}
+
+// NewSlackVerifier creates a verifier for the signing secret of a Slack app.
+func NewSlackVerifier(signingSecret string) *SlackVerifier {
+	return &SlackVerifier{SigningSecret: signingSecret, now: time.Now}
+}
+
+// Verify checks the "v0=" HMAC-SHA256 signature of "v0:<timestamp>:<body>" and that the request
+// isn't older than maxSlackSkew.
+func (v SlackVerifier) Verify(signature, timestamp string, body []byte) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if skew := v.now().Sub(time.Unix(ts, 0)); skew > maxSlackSkew || skew < -maxSlackSkew {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(v.SigningSecret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+// ParseSlackCommand splits the text of a slash command into an operation and a counter name.
+// A bare counter name shows its record.
+func ParseSlackCommand(text string) (string, string, bool) {
+	fields := strings.Fields(text)
+	switch len(fields) {
+	case 1:
+		if fields[0] == "help" {
+			return "", "", false
+		}
+		return SlackOperationRecord, fields[0], true
+	case 2:
+		switch fields[0] {
+		case SlackOperationWin, SlackOperationLoss, SlackOperationDraw, SlackOperationUndo, SlackOperationRecord,
+			SlackOperationRemoveWin, SlackOperationRemoveLoss, SlackOperationRemoveDraw:
+			return fields[0], fields[1], true
+		}
+	}
+	return "", "", false
+}
+
+// RunSlackOperation applies an operation to an existing counter and returns the message to show.
+func RunSlackOperation(ctx context.Context, operation, name string) SlackMessage {
+	if !ValidCounterName(name) {
+		return slackEphemeral("There is no counter called %s.", name)
+	}
+	counter := handleCounter(ctx, name)
+	exists, err := counter.Exists()
+	if err != nil {
+		return slackEphemeral("Something bad happened, try again later.")
+	}
+	if !exists {
+		return slackEphemeral("There is no counter called %s.", name)
+	}
+
+	note := ""
+	switch operation {
+	case SlackOperationWin:
+		counter.AddWin()
+	case SlackOperationLoss:
+		counter.AddLoss()
+	case SlackOperationDraw:
+		counter.AddDraw()
+	case SlackOperationRemoveWin:
+		counter.RemoveWin()
+	case SlackOperationRemoveLoss:
+		counter.RemoveLoss()
+	case SlackOperationRemoveDraw:
+		counter.RemoveDraw()
+	case SlackOperationUndo:
+		if !counter.Undo() {
+			note = "Nothing to undo."
+		}
+	case SlackOperationRecord:
+	default:
+		return slackEphemeral(slackUsage)
+	}
+	return SlackCounterMessage(counter, note)
+}
+
+// SlackMessage is a Block Kit message, used both as the reply to a slash command and to replace
+// the message whose button was pressed.
+type SlackMessage struct {
+	ResponseType    string       `json:"response_type,omitempty"`
+	ReplaceOriginal bool         `json:"replace_original,omitempty"`
+	Text            string       `json:"text"`
+	Blocks          []SlackBlock `json:"blocks,omitempty"`
+}
+
+// SlackBlock is a layout block of a message.
+type SlackBlock struct {
+	Type     string        `json:"type"`
+	Text     *SlackText    `json:"text,omitempty"`
+	Elements []interface{} `json:"elements,omitempty"`
+}
+
+// SlackText is a text object.
+type SlackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// SlackButton is a button element of an actions block.
+type SlackButton struct {
+	Type     string    `json:"type"`
+	Text     SlackText `json:"text"`
+	ActionID string    `json:"action_id"`
+	Value    string    `json:"value"`
+	Style    string    `json:"style,omitempty"`
+}
+
+func slackEphemeral(format string, args ...interface{}) SlackMessage {
+	return SlackMessage{ResponseType: "ephemeral", Text: fmt.Sprintf(format, args...)}
+}
+
+// SlackCounterMessage shows the record of a counter with buttons to change it.
+func SlackCounterMessage(counter *WinLossCounter, note string) SlackMessage {
+	winRate, _ := metricMessage(counter, MetricWinRate)
+	summary := fmt.Sprintf("%s: %d-%d-%d", counter.PrettyName, counter.Wins, counter.Losses, counter.Draws)
+
+	title := "*" + slackEscape(counter.PrettyName) + "*"
+	if counter.Links != nil {
+		title = fmt.Sprintf("*<%s|%s>*", counter.Links.Html, slackEscape(counter.PrettyName))
+	}
+	details := fmt.Sprintf("Wins *%d*   Losses *%d*   Draws *%d*   Win rate *%s*", counter.Wins, counter.Losses, counter.Draws, winRate)
+
+	notes := []string{"Streak: " + counter.StreakLabel()}
+	if note != "" {
+		notes = append(notes, note)
+	}
+
+	button := func(label, operation, style string) SlackButton {
+		return SlackButton{
+			Type:     "button",
+			Text:     SlackText{Type: "plain_text", Text: label},
+			ActionID: slackActionPrefix + operation,
+			Value:    counter.Name,
+			Style:    style,
+		}
+	}
+
+	return SlackMessage{
+		ResponseType: "in_channel",
+		Text:         summary,
+		Blocks: []SlackBlock{
+			{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: title + "\n" + details}},
+			{Type: "context", Elements: []interface{}{SlackText{Type: "mrkdwn", Text: slackEscape(strings.Join(notes, "   "))}}},
+			{Type: "actions", Elements: []interface{}{
+				button("+ Win", SlackOperationWin, "primary"),
+				button("+ Loss", SlackOperationLoss, "danger"),
+				button("+ Draw", SlackOperationDraw, ""),
+				button("− Win", SlackOperationRemoveWin, ""),
+				button("− Loss", SlackOperationRemoveLoss, ""),
+				button("− Draw", SlackOperationRemoveDraw, ""),
+				button("Undo", SlackOperationUndo, ""),
+			}},
+		},
+	}
+}
+
+// slackEscape escapes the characters Slack's mrkdwn treats as control characters.
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// SlackInteraction is the part of an interactivity payload the endpoint uses.
+type SlackInteraction struct {
+	Type        string `json:"type"`
+	ResponseURL string `json:"response_url"`
+	User        struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	Actions []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+}
+
+// validSlackResponseURL makes sure updates are only posted back to Slack.
+func validSlackResponseURL(responseURL string) bool {
+	u, err := url.Parse(responseURL)
+	return err == nil && u.Scheme == "https" && u.Host == "hooks.slack.com"
+}
+
+// RespondToSlackInteraction runs the operation of a pressed button and replaces the original
+// message through the response URL. Slack ignores the body of the interactivity response itself.
+func RespondToSlackInteraction(interaction *SlackInteraction) {
+	logger := logrus.WithFields(logrus.Fields{
+		"func":    "RespondToSlackInteraction",
+		"user":    interaction.User.ID,
+		"version": version.Version,
+	})
+
+	if !validSlackResponseURL(interaction.ResponseURL) {
+		logger.Warnf("Ignoring interaction with response URL %q", interaction.ResponseURL)
+		return
+	}
+	for _, action := range interaction.Actions {
+		operation := strings.TrimPrefix(action.ActionID, slackActionPrefix)
+		if operation == action.ActionID {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		message := RunSlackOperation(ctx, operation, action.Value)
+		if message.ResponseType == "in_channel" {
+			message.ReplaceOriginal = true
+			message.ResponseType = ""
+		}
+		if err := postSlackMessage(ctx, interaction.ResponseURL, message); err != nil {
+			logger.WithError(err).Error("Failed to update Slack message")
+		}
+		cancel()
+	}
+}
+
+func postSlackMessage(ctx context.Context, responseURL string, message SlackMessage) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, responseURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack answered %s", resp.Status)
+	}
+	return nil
+}
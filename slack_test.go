@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// signSlack returns the signature Slack would send for body at timestamp.
+func signSlack(secret, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + body))
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestSlackVerify(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	verifier := NewSlackVerifier("signing-secret")
+	verifier.now = func() time.Time { return now }
+
+	body := "command=%2Fwl&text=win+team-a"
+	at := func(d time.Duration) string { return strconv.FormatInt(now.Add(d).Unix(), 10) }
+
+	tests := []struct {
+		name      string
+		signature string
+		timestamp string
+		body      string
+		want      bool
+	}{
+		{"valid", signSlack("signing-secret", at(0), body), at(0), body, true},
+		{"slightly old", signSlack("signing-secret", at(-4*time.Minute), body), at(-4 * time.Minute), body, true},
+		{"slightly ahead", signSlack("signing-secret", at(4*time.Minute), body), at(4 * time.Minute), body, true},
+		{"too old", signSlack("signing-secret", at(-6*time.Minute), body), at(-6 * time.Minute), body, false},
+		{"too far ahead", signSlack("signing-secret", at(6*time.Minute), body), at(6 * time.Minute), body, false},
+		{"wrong secret", signSlack("other-secret", at(0), body), at(0), body, false},
+		{"tampered body", signSlack("signing-secret", at(0), body), at(0), body + "&x=1", false},
+		{"timestamp swapped", signSlack("signing-secret", at(-time.Minute), body), at(0), body, false},
+		{"missing signature", "", at(0), body, false},
+		{"missing timestamp", signSlack("signing-secret", "", body), "", body, false},
+		{"timestamp not a number", signSlack("signing-secret", "soon", body), "soon", body, false},
+		{"signature without version", strings.TrimPrefix(signSlack("signing-secret", at(0), body), "v0="), at(0), body, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifier.Verify(tt.signature, tt.timestamp, []byte(tt.body)); got != tt.want {
+				t.Errorf("Verify = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSlackCommand(t *testing.T) {
+	tests := []struct {
+		text      string
+		operation string
+		name      string
+		ok        bool
+	}{
+		{"team-a", SlackOperationRecord, "team-a", true},
+		{"win team-a", SlackOperationWin, "team-a", true},
+		{"  loss   team-a ", SlackOperationLoss, "team-a", true},
+		{"draw team-a", SlackOperationDraw, "team-a", true},
+		{"undo team-a", SlackOperationUndo, "team-a", true},
+		{"record team-a", SlackOperationRecord, "team-a", true},
+		{"remove-win team-a", SlackOperationRemoveWin, "team-a", true},
+		{"remove-loss team-a", SlackOperationRemoveLoss, "team-a", true},
+		{"remove-draw team-a", SlackOperationRemoveDraw, "team-a", true},
+		{"help", "", "", false},
+		{"", "", "", false},
+		{"forfeit team-a", "", "", false},
+		{"win team-a now", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			operation, name, ok := ParseSlackCommand(tt.text)
+			if operation != tt.operation || name != tt.name || ok != tt.ok {
+				t.Errorf("ParseSlackCommand(%q) = %q, %q, %t, want %q, %q, %t", tt.text, operation, name, ok, tt.operation, tt.name, tt.ok)
+			}
+		})
+	}
+}
+
+func TestValidSlackResponseURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://hooks.slack.com/actions/T1/1/abc", true},
+		{"http://hooks.slack.com/actions/T1/1/abc", false},
+		{"https://hooks.slack.com.example.com/actions", false},
+		{"https://example.com/hooks.slack.com", false},
+		{"https://user@evil.example/@hooks.slack.com", false},
+		{"https://hooks.slack.com:8443/actions", false},
+		{"hooks.slack.com/actions", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if got := validSlackResponseURL(tt.url); got != tt.want {
+				t.Errorf("validSlackResponseURL(%q) = %t, want %t", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunSlackOperation(t *testing.T) {
+	consul := useFakeConsul(t)
+	consul.Put(consulKeyPrefix+"/team-a", `{"schema_version":1,"name":"team-a","pretty_name":"Team A","wins":2,"losses":1,"draws":0}`)
+	ctx := context.Background()
+
+	tests := []struct {
+		operation string
+		name      string
+		text      string
+	}{
+		{SlackOperationRecord, "team-a", "Team A: 2-1-0"},
+		{SlackOperationWin, "team-a", "Team A: 3-1-0"},
+		{SlackOperationLoss, "team-a", "Team A: 3-2-0"},
+		{SlackOperationDraw, "team-a", "Team A: 3-2-1"},
+		{SlackOperationUndo, "team-a", "Team A: 3-2-0"},
+		{SlackOperationRemoveWin, "team-a", "Team A: 2-2-0"},
+		{SlackOperationRemoveLoss, "team-a", "Team A: 2-1-0"},
+		{SlackOperationDraw, "team-a", "Team A: 2-1-1"},
+		{SlackOperationRemoveDraw, "team-a", "Team A: 2-1-0"},
+		{SlackOperationWin, "team-b", "There is no counter called team-b."},
+		{SlackOperationWin, "../etc", "There is no counter called ../etc."},
+		{"forfeit", "team-a", slackUsage},
+	}
+	for _, tt := range tests {
+		message := RunSlackOperation(ctx, tt.operation, tt.name)
+		if message.Text != tt.text {
+			t.Errorf("%s %s = %q, want %q", tt.operation, tt.name, message.Text, tt.text)
+		}
+		if strings.HasPrefix(tt.text, "Team A") && (message.ResponseType != "in_channel" || len(message.Blocks) != 3) {
+			t.Errorf("%s %s is not a counter message: %+v", tt.operation, tt.name, message)
+		}
+	}
+}
+
+func TestSlackCounterMessageButtons(t *testing.T) {
+	_, client := newFakeConsul(t)
+	counter := NewWinLossCounter("team-a")
+	counter.SetConsulClient(client)
+	counter.PrettyName = "Team A"
+
+	message := SlackCounterMessage(counter, "")
+	var got []string
+	for _, element := range message.Blocks[2].Elements {
+		button := element.(SlackButton)
+		if button.Value != "team-a" {
+			t.Errorf("%s button value = %q", button.Text.Text, button.Value)
+		}
+		got = append(got, button.Text.Text+"="+strings.TrimPrefix(button.ActionID, slackActionPrefix))
+	}
+	want := []string{"+ Win=win", "+ Loss=loss", "+ Draw=draw", "− Win=remove-win", "− Loss=remove-loss", "− Draw=remove-draw", "Undo=undo"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("buttons = %v, want %v", got, want)
+	}
+}
+
+func TestSlackInteractionOutsideSlackIsIgnored(t *testing.T) {
+	consul := useFakeConsul(t)
+	consul.Put(consulKeyPrefix+"/team-a", `{"schema_version":1,"name":"team-a","wins":2,"losses":1,"draws":0}`)
+
+	posted := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { posted = true }))
+	defer receiver.Close()
+
+	var interaction SlackInteraction
+	interaction.Type = "block_actions"
+	interaction.ResponseURL = receiver.URL
+	interaction.Actions = append(interaction.Actions, struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	}{slackActionPrefix + SlackOperationWin, "team-a"})
+	RespondToSlackInteraction(&interaction)
+
+	if posted {
+		t.Error("the update was posted outside hooks.slack.com")
+	}
+	if stored, _ := consul.Get(consulKeyPrefix + "/team-a"); !strings.Contains(stored, `"wins":2`) {
+		t.Errorf("the counter changed: %s", stored)
+	}
+}
+
+func TestPostSlackMessage(t *testing.T) {
+	var got SlackMessage
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &got)
+	}))
+	defer receiver.Close()
+
+	message := SlackMessage{ReplaceOriginal: true, Text: "Team A: 3-1-0"}
+	if err := postSlackMessage(context.Background(), receiver.URL, message); err != nil {
+		t.Fatal(err)
+	}
+	if !got.ReplaceOriginal || got.Text != message.Text {
+		t.Errorf("posted %+v", got)
+	}
+}
+
+func TestSlackCommandRoute(t *testing.T) {
+	consul := useFakeConsul(t)
+	consul.Put(consulKeyPrefix+"/team-a", `{"schema_version":1,"name":"team-a","pretty_name":"Team A","wins":2,"losses":1,"draws":0}`)
+	t.Setenv("SLACK_SIGNING_SECRET", "signing-secret")
+	r := newRouter(logrus.NewEntry(logrus.StandardLogger()), nil)
+
+	post := func(text, secret string) *httptest.ResponseRecorder {
+		body := url.Values{"command": {"/wl"}, "text": {text}}.Encode()
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req := httptest.NewRequest(http.MethodPost, "/slack/commands", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set(SlackTimestampHeader, timestamp)
+		req.Header.Set(SlackSignatureHeader, signSlack(secret, timestamp, body))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post("win team-a", "other-secret"); w.Code != http.StatusUnauthorized {
+		t.Errorf("badly signed command = %d, want 401", w.Code)
+	}
+
+	w := post("win team-a", "signing-secret")
+	var message SlackMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &message); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("win = %d: %s", w.Code, w.Body.String())
+	}
+	if message.Text != "Team A: 3-1-0" {
+		t.Errorf("win = %q", message.Text)
+	}
+
+	w = post("help", "signing-secret")
+	if err := json.Unmarshal(w.Body.Bytes(), &message); err != nil || message.Text != slackUsage {
+		t.Errorf("help = %s", w.Body.String())
+	}
+}
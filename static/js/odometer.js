@@ -0,0 +1,118 @@
+/*
+ * Rolling odometer digits for the overlays, without any dependencies.
+ *
+ * Supports the same usage as HubSpot's odometer that the templates were written against:
+ * configure window.odometerOptions ({selector, format}) before loading this file, and every
+ * matching element animates whenever its text is replaced (e.g. with jQuery's .text()).
+ * The format is "(,ddd)" for grouped integers, or "(,ddd).d" with one digit per decimal place.
+ */
+(function () {
+    'use strict';
+
+    var options = window.odometerOptions || {};
+    var selector = options.selector || '.odometer';
+    var defaultFormat = options.format || '(,ddd)';
+
+    function decimalsOf(format) {
+        var dot = format.lastIndexOf('.');
+        return dot === -1 ? 0 : format.length - dot - 1;
+    }
+
+    function formatValue(value, format) {
+        var decimals = decimalsOf(format);
+        var parts = Math.abs(value).toFixed(decimals).split('.');
+        if (format.indexOf(',') !== -1) {
+            parts[0] = parts[0].replace(/\B(?=(\d{3})+(?!\d))/g, ',');
+        }
+        return (value < 0 ? '-' : '') + parts.join('.');
+    }
+
+    function Odometer(el) {
+        this.el = el;
+        this.format = el.getAttribute('data-format') || defaultFormat;
+        this.value = parseFloat(el.textContent.replace(/,/g, '')) || 0;
+
+        var self = this;
+        this.observer = new MutationObserver(function () {
+            self.changed();
+        });
+        this.render(this.value);
+    }
+
+    // changed handles the page replacing the text of the element. The observer is disconnected
+    // while the odometer renders, so the element only ever holds text written by the page here.
+    Odometer.prototype.changed = function () {
+        var next = parseFloat(this.el.textContent.replace(/,/g, ''));
+        if (isNaN(next)) {
+            return;
+        }
+        if (next === this.value) {
+            this.render(next);
+            return;
+        }
+        this.update(next);
+    };
+
+    Odometer.prototype.render = function (value) {
+        this.observer.disconnect();
+
+        var text = formatValue(value, this.format);
+        var html = '';
+        for (var i = 0; i < text.length; i++) {
+            var ch = text.charAt(i);
+            if (ch >= '0' && ch <= '9') {
+                html += '<span class="odometer-digit"><span class="odometer-ribbon" style="transform: translateY(-' +
+                    (parseInt(ch, 10) * 1.1) + 'em)">';
+                for (var d = 0; d <= 9; d++) {
+                    html += '<span class="odometer-value">' + d + '</span>';
+                }
+                html += '</span></span>';
+            } else {
+                html += '<span class="odometer-formatting-mark">' + ch + '</span>';
+            }
+        }
+        this.el.innerHTML = html;
+        this.el.offsetHeight; // apply the starting position before any transition
+
+        this.observer.observe(this.el, {childList: true, characterData: true, subtree: true});
+    };
+
+    Odometer.prototype.update = function (next) {
+        var previous = this.value;
+        var nextText = formatValue(next, this.format);
+        var previousText = formatValue(previous, this.format);
+        this.value = next;
+
+        // Start from the previous value, padded to the new width, then roll every digit to its new place.
+        var start = previousText.length === nextText.length ? previous : next;
+        this.render(start);
+        if (start === next) {
+            return;
+        }
+
+        // Only the style attributes of the ribbons change, which the observer doesn't watch.
+        var ribbons = this.el.querySelectorAll('.odometer-ribbon');
+        var digits = nextText.replace(/[^0-9]/g, '');
+        window.requestAnimationFrame(function () {
+            for (var i = 0; i < ribbons.length; i++) {
+                ribbons[i].style.transform = 'translateY(-' + (parseInt(digits.charAt(i), 10) * 1.1) + 'em)';
+            }
+        });
+    };
+
+    function init() {
+        var elements = document.querySelectorAll(selector);
+        for (var i = 0; i < elements.length; i++) {
+            if (!elements[i].odometer) {
+                elements[i].odometer = new Odometer(elements[i]);
+            }
+        }
+    }
+
+    window.Odometer = Odometer;
+    if (document.readyState === 'loading') {
+        document.addEventListener('DOMContentLoaded', init);
+    } else {
+        init();
+    }
+})();
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gookit/rux"
+)
+
+//go:embed static
+var embedStatic embed.FS
+
+// staticPrefix is the route all embedded assets are served below.
+const staticPrefix = "/static/"
+
+// cssURL matches relative url(...) references in stylesheets so they can point at hashed file names.
+var cssURL = regexp.MustCompile(`url\(([A-Za-z0-9._-]+)\)`)
+
+// staticStartTime is used as the modification time of every embedded asset.
+var staticStartTime = time.Now()
+
+type staticAsset struct {
+	name        string
+	content     []byte
+	contentType string
+	etag        string
+	immutable   bool
+}
+
+// StaticAssets serves the JS, CSS and font files embedded in the binary.
+// Every file is available under a content hashed name (e.g. js/jquery.min.0a1b2c3d.js) that is
+// cached forever, and under its plain name with a short cache lifetime.
+type StaticAssets struct {
+	files  map[string]*staticAsset
+	hashed map[string]string
+}
+
+// NewStaticAssets indexes and hashes every file below static/ in fsys.
+func NewStaticAssets(fsys fs.FS) (*StaticAssets, error) {
+	s := &StaticAssets{
+		files:  map[string]*staticAsset{},
+		hashed: map[string]string{},
+	}
+
+	var names []string
+	err := fs.WalkDir(fsys, "static", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		names = append(names, strings.TrimPrefix(p, "static/"))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Stylesheets reference other assets, so they are hashed after everything else.
+	sort.SliceStable(names, func(i, j int) bool {
+		return path.Ext(names[i]) != ".css" && path.Ext(names[j]) == ".css"
+	})
+
+	for _, name := range names {
+		content, err := fs.ReadFile(fsys, "static/"+name)
+		if err != nil {
+			return nil, err
+		}
+		if path.Ext(name) == ".css" {
+			content = s.rewriteCSS(name, content)
+		}
+		s.add(name, content)
+	}
+	return s, nil
+}
+
+func (s *StaticAssets) add(name string, content []byte) {
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])[:12]
+
+	ext := path.Ext(name)
+	hashedName := strings.TrimSuffix(name, ext) + "." + hash + ext
+
+	contentType := mime.TypeByExtension(ext)
+	switch ext {
+	case ".woff2":
+		contentType = "font/woff2"
+	case ".txt", ".md":
+		contentType = "text/plain; charset=utf-8"
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(content)
+	}
+
+	s.files[name] = &staticAsset{name: name, content: content, contentType: contentType, etag: `"` + hash + `"`}
+	s.files[hashedName] = &staticAsset{name: name, content: content, contentType: contentType, etag: `"` + hash + `"`, immutable: true}
+	s.hashed[name] = hashedName
+}
+
+// rewriteCSS points relative url(...) references at the hashed names of assets in the same directory.
+func (s *StaticAssets) rewriteCSS(name string, content []byte) []byte {
+	dir := path.Dir(name)
+	return cssURL.ReplaceAllFunc(content, func(match []byte) []byte {
+		ref := string(cssURL.FindSubmatch(match)[1])
+		if hashed, ok := s.hashed[path.Join(dir, ref)]; ok {
+			return []byte(fmt.Sprintf("url(%s)", path.Base(hashed)))
+		}
+		return match
+	})
+}
+
+// URL returns the cache busting URL of an embedded asset, given as "js/jquery.min.js" or
+// "/static/js/jquery.min.js". Anything that isn't an embedded asset is returned unchanged.
+func (s *StaticAssets) URL(name string) string {
+	if hashed, ok := s.hashed[strings.TrimPrefix(name, staticPrefix)]; ok {
+		return staticPrefix + hashed
+	}
+	return name
+}
+
+// Serve is the route handler for /static/{file:.+}.
+func (s *StaticAssets) Serve(c *rux.Context) {
+	asset, ok := s.files[c.Param("file")]
+	if !ok {
+		c.AbortWithStatus(404, "Not Found")
+		return
+	}
+
+	c.SetHeader("Content-Type", asset.contentType)
+	c.SetHeader("ETag", asset.etag)
+	if asset.immutable {
+		c.SetHeader("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		c.SetHeader("Cache-Control", "public, max-age=300")
+	}
+	http.ServeContent(c.Resp, c.Req, asset.name, staticStartTime, bytes.NewReader(asset.content))
+}
+
+// staticAssets holds the assets embedded below static/.
+var staticAssets = mustStaticAssets(NewStaticAssets(embedStatic))
+
+func mustStaticAssets(s *StaticAssets, err error) *StaticAssets {
+	if err != nil {
+		panic(fmt.Sprintf("embedded static assets are invalid: %s", err))
+	}
+	return s
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/r35krag0th/win-loss-rux/version"
+	"github.com/sirupsen/logrus"
+)
+
+//go:embed templates/*.gohtml
+var embedTemplates embed.FS
+
+// templateFuncs are the functions available to every page template.
+var templateFuncs = template.FuncMap{
+	"asset": staticAssets.URL,
+}
+
+// TemplateStore parses the page templates once and caches them.
+// Any template can be overridden by a file of the same name in an override directory (TEMPLATE_DIR).
+// An override that fails to parse is logged and the embedded copy is used instead.
+type TemplateStore struct {
+	mu       sync.RWMutex
+	embedded fs.FS
+	dir      string
+	parsed   map[string]*template.Template
+	modTimes map[string]time.Time
+}
+
+// NewTemplateStore creates a store for every *.gohtml file in the embedded templates directory.
+func NewTemplateStore(embedded fs.FS) *TemplateStore {
+	return &TemplateStore{
+		embedded: embedded,
+		parsed:   map[string]*template.Template{},
+		modTimes: map[string]time.Time{},
+	}
+}
+
+// SetDir sets the override directory and (re)parses every template.
+func (s *TemplateStore) SetDir(dir string) error {
+	s.mu.Lock()
+	s.dir = dir
+	s.mu.Unlock()
+	return s.Reload()
+}
+
+// Names returns the file names of every embedded template.
+func (s *TemplateStore) Names() []string {
+	names, _ := fs.Glob(s.embedded, "templates/*.gohtml")
+	for i, name := range names {
+		names[i] = filepath.Base(name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Reload parses every template again. It returns an error only if an embedded template fails to parse.
+func (s *TemplateStore) Reload() error {
+	for _, name := range s.Names() {
+		if err := s.load(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns the parsed template with the given file name, such as "counter.gohtml".
+func (s *TemplateStore) Get(name string) (*template.Template, error) {
+	s.mu.RLock()
+	tmpl, ok := s.parsed[name]
+	s.mu.RUnlock()
+	if ok {
+		return tmpl, nil
+	}
+
+	if err := s.load(name); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.parsed[name], nil
+}
+
+// Parsed reports whether every embedded template has been parsed.
+func (s *TemplateStore) Parsed() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, name := range s.Names() {
+		if _, ok := s.parsed[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Watch polls the override directory every interval and reparses templates whose override file
+// was added, changed or removed. Polling keeps working on bind mounts where file events don't.
+// It is meant for development and runs until stop is closed, or forever if stop is nil.
+func (s *TemplateStore) Watch(interval time.Duration, stop <-chan struct{}) {
+	logger := logrus.WithFields(logrus.Fields{
+		"func":    "Watch",
+		"dir":     s.dir,
+		"version": version.Version,
+	})
+	logger.Info("Watching template overrides for changes")
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			for _, name := range s.Names() {
+				modTime, _ := s.overrideModTime(name)
+
+				s.mu.RLock()
+				changed := !modTime.Equal(s.modTimes[name])
+				s.mu.RUnlock()
+
+				if changed {
+					logger.WithField("template", name).Info("Template override changed; reloading")
+					if err := s.load(name); err != nil {
+						logger.WithError(err).Error("Failed to reload template")
+					}
+				}
+			}
+		}
+	}
+}
+
+// overrideModTime returns the modification time of the override for name, or the zero time if there is none.
+func (s *TemplateStore) overrideModTime(name string) (time.Time, string) {
+	s.mu.RLock()
+	dir := s.dir
+	s.mu.RUnlock()
+
+	if dir == "" {
+		return time.Time{}, ""
+	}
+
+	path := filepath.Join(dir, name)
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return time.Time{}, ""
+	}
+	return info.ModTime(), path
+}
+
+func (s *TemplateStore) load(name string) error {
+	logger := logrus.WithFields(logrus.Fields{
+		"func":     "load",
+		"template": name,
+		"version":  version.Version,
+	})
+
+	modTime, path := s.overrideModTime(name)
+
+	var tmpl *template.Template
+	if path != "" {
+		source, err := os.ReadFile(path)
+		if err == nil {
+			tmpl, err = template.New(name).Funcs(templateFuncs).Parse(string(source))
+		}
+		if err != nil {
+			logger.WithError(err).WithField("override", path).Error("Failed to parse template override; using the embedded template")
+			tmpl = nil
+		} else {
+			logger.WithField("override", path).Info("Using template override")
+		}
+	}
+
+	if tmpl == nil {
+		source, err := fs.ReadFile(s.embedded, "templates/"+name)
+		if err != nil {
+			return fmt.Errorf("unknown template %s: %w", name, err)
+		}
+		tmpl, err = template.New(name).Funcs(templateFuncs).Parse(string(source))
+		if err != nil {
+			return fmt.Errorf("embedded template %s: %w", name, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.parsed[name] = tmpl
+	s.modTimes[name] = modTime
+	return nil
+}
+
+// pageTemplates holds the templates used by the HTML routes. The override directory is set in main.
+var pageTemplates = NewTemplateStore(embedTemplates)
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var testEmbeddedTemplates = fstest.MapFS{
+	"templates/page.gohtml": {Data: []byte("embedded {{.}}")},
+}
+
+func renderStoreTemplate(t *testing.T, store *TemplateStore, name string) string {
+	t.Helper()
+	tmpl, err := store.Get(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, "page"); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestTemplateStoreOverrides(t *testing.T) {
+	tests := []struct {
+		name     string
+		override string
+		want     string
+	}{
+		{"without an override", "", "embedded page"},
+		{"override", "override {{.}}", "override page"},
+		{"override that fails to parse", "override {{.", "embedded page"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.override != "" {
+				if err := os.WriteFile(filepath.Join(dir, "page.gohtml"), []byte(tt.override), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			store := NewTemplateStore(testEmbeddedTemplates)
+			if err := store.SetDir(dir); err != nil {
+				t.Fatal(err)
+			}
+			if !store.Parsed() {
+				t.Error("not every template was parsed")
+			}
+			if got := renderStoreTemplate(t, store, "page.gohtml"); got != tt.want {
+				t.Errorf("rendered %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateStoreUnknownTemplate(t *testing.T) {
+	store := NewTemplateStore(testEmbeddedTemplates)
+	if _, err := store.Get("missing.gohtml"); err == nil || !strings.Contains(err.Error(), "unknown template missing.gohtml") {
+		t.Errorf("err = %v, want an unknown template error", err)
+	}
+}
+
+func TestTemplateStoreWatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "page.gohtml")
+	store := NewTemplateStore(testEmbeddedTemplates)
+	if err := store.SetDir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		store.Watch(5*time.Millisecond, stop)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	// Every step gets its own modification time, so the change is seen even on coarse file systems
+	modTime := time.Now().Add(-time.Hour)
+	steps := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"added", "first {{.}}", "first page"},
+		{"changed", "second {{.}}", "second page"},
+		{"removed", "", "embedded page"},
+	}
+	for _, step := range steps {
+		if step.source == "" {
+			if err := os.Remove(path); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			if err := os.WriteFile(path, []byte(step.source), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			modTime = modTime.Add(time.Minute)
+			if err := os.Chtimes(path, modTime, modTime); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		deadline := time.Now().Add(2 * time.Second)
+		for renderStoreTemplate(t, store, "page.gohtml") != step.want {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: the override was not reloaded", step.name)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+}
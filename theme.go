@@ -0,0 +1,207 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/r35krag0th/win-loss-rux/version"
+	"github.com/sirupsen/logrus"
+)
+
+//go:embed themes/*.json
+var embedThemes embed.FS
+
+// DefaultThemeName is used when neither the request nor the counter select a theme.
+const DefaultThemeName = "default"
+
+// Layouts a theme can use for the counter name relative to the numbers.
+const (
+	ThemeLayoutInline  = "inline"
+	ThemeLayoutStacked = "stacked"
+)
+
+// cssValue only allows characters needed for colors and font lists, so theme values can't
+// break out of the declaration they are written into.
+var cssValue = regexp.MustCompile(`^[A-Za-z0-9#(),.%' -]+$`)
+
+var themeName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Theme sets the colors, font and layout of the HTML pages and overlays.
+type Theme struct {
+	Name           string `json:"name"`
+	DisplayName    string `json:"display_name"`
+	Background     string `json:"background"`
+	PrimaryColor   string `json:"primary_color"`
+	SecondaryColor string `json:"secondary_color"`
+	LinkColor      string `json:"link_color"`
+	FontFamily     string `json:"font_family"`
+	FontURL        string `json:"font_url,omitempty"`
+	Transparent    bool   `json:"transparent"`
+	Layout         string `json:"layout"`
+}
+
+// Validate checks that the theme is complete and that its values are safe to render.
+func (t *Theme) Validate() error {
+	if !themeName.MatchString(t.Name) {
+		return fmt.Errorf("invalid theme name: %q", t.Name)
+	}
+
+	values := map[string]string{
+		"background":      t.Background,
+		"primary_color":   t.PrimaryColor,
+		"secondary_color": t.SecondaryColor,
+		"link_color":      t.LinkColor,
+		"font_family":     t.FontFamily,
+	}
+	for key, value := range values {
+		if !cssValue.MatchString(value) {
+			return fmt.Errorf("theme %s: invalid %s: %q", t.Name, key, value)
+		}
+	}
+
+	if t.FontURL != "" && !strings.HasPrefix(t.FontURL, "https://") && !strings.HasPrefix(t.FontURL, "/") {
+		return fmt.Errorf("theme %s: font_url must be https or a local path", t.Name)
+	}
+
+	switch t.Layout {
+	case "":
+		t.Layout = ThemeLayoutInline
+	case ThemeLayoutInline, ThemeLayoutStacked:
+	default:
+		return fmt.Errorf("theme %s: unknown layout %q", t.Name, t.Layout)
+	}
+
+	if t.DisplayName == "" {
+		t.DisplayName = t.Name
+	}
+	return nil
+}
+
+// PageBackground is the CSS background of the page, honoring Transparent.
+func (t Theme) PageBackground() string {
+	if t.Transparent {
+		return "transparent"
+	}
+	return t.Background
+}
+
+// CSSVariables returns the theme as CSS custom properties for use in the templates' stylesheets.
+func (t Theme) CSSVariables() template.CSS {
+	return template.CSS(fmt.Sprintf(
+		"--wl-background: %s; --wl-primary: %s; --wl-secondary: %s; --wl-link: %s; --wl-font: %s;",
+		t.PageBackground(), t.PrimaryColor, t.SecondaryColor, t.LinkColor, t.FontFamily,
+	))
+}
+
+// ThemeRegistry holds every theme that can be selected by name.
+type ThemeRegistry struct {
+	mu     sync.RWMutex
+	themes map[string]*Theme
+}
+
+// NewThemeRegistry creates a registry containing the themes bundled into the binary.
+func NewThemeRegistry() *ThemeRegistry {
+	registry := &ThemeRegistry{themes: map[string]*Theme{}}
+	if err := registry.loadFS(embedThemes, "themes"); err != nil {
+		panic(fmt.Sprintf("bundled themes are invalid: %s", err))
+	}
+	return registry
+}
+
+// LoadDir adds every *.json theme in dir to the registry, replacing bundled themes of the same name.
+func (r *ThemeRegistry) LoadDir(dir string) error {
+	return r.loadFS(os.DirFS(dir), ".")
+}
+
+func (r *ThemeRegistry) loadFS(fsys fs.FS, dir string) error {
+	logger := logrus.WithFields(logrus.Fields{
+		"func":    "loadFS",
+		"dir":     dir,
+		"version": version.Version,
+	})
+
+	matches, err := fs.Glob(fsys, filepath.ToSlash(filepath.Join(dir, "*.json")))
+	if err != nil {
+		return err
+	}
+
+	for _, match := range matches {
+		b, err := fs.ReadFile(fsys, match)
+		if err != nil {
+			return err
+		}
+
+		var theme Theme
+		if err = json.Unmarshal(b, &theme); err != nil {
+			return fmt.Errorf("%s: %w", match, err)
+		}
+		if err = theme.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", match, err)
+		}
+
+		logger.Debugf("Registering theme %s from %s", theme.Name, match)
+		r.Register(&theme)
+	}
+	return nil
+}
+
+// Register adds or replaces a theme.
+func (r *ThemeRegistry) Register(theme *Theme) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.themes[theme.Name] = theme
+}
+
+// Get returns the named theme.
+func (r *ThemeRegistry) Get(name string) (*Theme, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	theme, ok := r.themes[name]
+	return theme, ok
+}
+
+// Resolve returns the first of the given names that is a known theme, falling back to the default theme.
+func (r *ThemeRegistry) Resolve(names ...string) *Theme {
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if theme, ok := r.Get(name); ok {
+			return theme
+		}
+		logrus.WithField("theme", name).Warn("Unknown theme requested; falling back")
+	}
+
+	theme, _ := r.Get(DefaultThemeName)
+	return theme
+}
+
+// All returns every registered theme sorted by name, with the default theme first.
+func (r *ThemeRegistry) All() []*Theme {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	all := make([]*Theme, 0, len(r.themes))
+	for _, theme := range r.themes {
+		all = append(all, theme)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Name == DefaultThemeName || all[j].Name == DefaultThemeName {
+			return all[i].Name == DefaultThemeName
+		}
+		return all[i].Name < all[j].Name
+	})
+	return all
+}
+
+// themes is the registry used by the HTML routes. Custom themes are added from THEME_DIR in main.
+var themes = NewThemeRegistry()
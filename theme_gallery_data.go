@@ -0,0 +1,10 @@
+package main
+
+// ThemeGalleryData is the data structure handed off to the theme preview gallery.
+// When Counter is set, every theme links to that counter's pages.
+type ThemeGalleryData struct {
+	Title   string
+	Label   string
+	Counter string
+	Themes  []*Theme
+}
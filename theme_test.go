@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io/fs"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var fontFaceFamily = regexp.MustCompile(`font-family:\s*'([^']+)'`)
+
+// TestBundledThemesUseEmbeddedFonts makes sure the pages render as designed without internet
+// access: the first font of every bundled theme must be declared in the embedded fonts.css,
+// and every font file it references must be embedded.
+func TestBundledThemesUseEmbeddedFonts(t *testing.T) {
+	css, err := fs.ReadFile(embedStatic, "static/fonts/fonts.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	declared := map[string]bool{}
+	for _, match := range fontFaceFamily.FindAllStringSubmatch(string(css), -1) {
+		declared[match[1]] = true
+	}
+	for _, match := range regexp.MustCompile(`url\(([^)]+)\)`).FindAllStringSubmatch(string(css), -1) {
+		if _, err := fs.Stat(embedStatic, "static/fonts/"+match[1]); err != nil {
+			t.Errorf("fonts.css references %s, which is not embedded", match[1])
+		}
+	}
+
+	registry := NewThemeRegistry()
+	for _, theme := range registry.All() {
+		t.Run(theme.Name, func(t *testing.T) {
+			primary := strings.Trim(strings.TrimSpace(strings.Split(theme.FontFamily, ",")[0]), "'\"")
+			if !declared[primary] {
+				t.Errorf("font %q is not declared in static/fonts/fonts.css", primary)
+			}
+			if want := staticPrefix + "fonts/fonts.css"; theme.FontURL != want {
+				t.Errorf("font_url = %q, want the embedded %s", theme.FontURL, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gookit/rux"
+	"github.com/hashicorp/consul/api"
+	"github.com/r35krag0th/win-loss-rux/version"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing backends, selected with TRACING.
+const (
+	TracingSentry = "sentry"
+	TracingOTLP   = "otlp"
+	TracingBoth   = "both"
+	TracingNone   = "none"
+)
+
+// tracerName identifies the spans of this service to OpenTelemetry.
+const tracerName = "github.com/r35krag0th/win-loss-rux"
+
+// tracers holds which backends spans are sent to. It is set once by SetupTracing.
+var tracers struct {
+	sentry bool
+	otlp   bool
+}
+
+// SetupTracing enables the backends selected by TRACING, "sentry" by default. The OTLP exporter is
+// configured with the standard OTEL_EXPORTER_OTLP_* variables and the service with
+// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES. The returned function flushes pending spans.
+func SetupTracing(ctx context.Context) (func(context.Context) error, error) {
+	mode := getenv("TRACING", TracingSentry)
+	switch mode {
+	case TracingSentry, TracingOTLP, TracingBoth, TracingNone:
+	default:
+		return nil, fmt.Errorf("TRACING must be one of sentry, otlp, both or none, got %q", mode)
+	}
+	tracers.sentry = mode == TracingSentry || mode == TracingBoth
+	tracers.otlp = mode == TracingOTLP || mode == TracingBoth
+
+	if !tracers.otlp {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			semconv.ServiceName("win-loss"),
+			semconv.ServiceVersion(version.Version),
+			semconv.DeploymentEnvironment(envName),
+		),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// Span is a span in every enabled tracing backend. Its methods do nothing for backends that are off.
+type Span struct {
+	sentry *sentry.Span
+	otel   trace.Span
+}
+
+// StartSpan starts a span as a child of the one in ctx and returns a context carrying it.
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	span := &Span{}
+	if tracers.sentry {
+		span.sentry = sentry.StartSpan(ctx, name)
+		ctx = span.sentry.Context()
+	}
+	if tracers.otlp {
+		ctx, span.otel = otel.Tracer(tracerName).Start(ctx, name)
+	}
+	return ctx, span
+}
+
+// startChildSpan is StartSpan for work that is only worth tracing as part of a larger trace, such
+// as storage operations. It doesn't start new traces for background work.
+func startChildSpan(ctx context.Context, name string) (context.Context, *Span) {
+	if sentry.TransactionFromContext(ctx) == nil && !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, &Span{}
+	}
+	return StartSpan(ctx, name)
+}
+
+// SetAttribute adds a tag to the span.
+func (s *Span) SetAttribute(key, value string) {
+	if s.sentry != nil {
+		s.sentry.SetTag(key, value)
+	}
+	if s.otel != nil {
+		s.otel.SetAttributes(attribute.String(key, value))
+	}
+}
+
+// RecordError marks the span as failed.
+func (s *Span) RecordError(err error) {
+	if s.sentry != nil {
+		s.sentry.Status = sentry.SpanStatusInternalError
+	}
+	if s.otel != nil {
+		s.otel.RecordError(err)
+		s.otel.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// Finish ends the span.
+func (s *Span) Finish() {
+	if s.sentry != nil {
+		s.sentry.Finish()
+	}
+	if s.otel != nil {
+		s.otel.End()
+	}
+}
+
+// tracingMiddleware traces every request, continuing traces started by the caller: sentry-trace
+// headers for Sentry and W3C traceparent headers for OpenTelemetry.
+func tracingMiddleware(r *rux.Router) rux.HandlerFunc {
+	return func(c *rux.Context) {
+		ctx := c.Req.Context()
+		name := c.Req.Method + " " + routePattern(r, c)
+
+		// A hub per request keeps scope data such as the transaction name from leaking between requests
+		hub := sentry.GetHubFromContext(ctx)
+		if hub == nil {
+			hub = sentry.CurrentHub().Clone()
+			ctx = sentry.SetHubOnContext(ctx, hub)
+		}
+		hub.Scope().SetRequest(c.Req)
+
+		var sentrySpan *sentry.Span
+		if tracers.sentry {
+			sentrySpan = sentry.StartSpan(ctx, "http.server", sentry.TransactionName(name), sentry.ContinueFromRequest(c.Req))
+			ctx = sentrySpan.Context()
+		}
+		var otelSpan trace.Span
+		if tracers.otlp {
+			ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(c.Req.Header))
+			ctx, otelSpan = otel.Tracer(tracerName).Start(ctx, name,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPMethod(c.Req.Method),
+					semconv.HTTPRoute(routePattern(r, c)),
+					semconv.HTTPTarget(c.Req.URL.RequestURI()),
+				),
+			)
+		}
+
+		finish := func(status int) {
+			if sentrySpan != nil {
+				sentrySpan.Status = sentrySpanStatus(status)
+				sentrySpan.Finish()
+			}
+			if otelSpan != nil {
+				otelSpan.SetAttributes(semconv.HTTPStatusCode(status))
+				if status >= 500 {
+					otelSpan.SetStatus(codes.Error, "")
+				}
+				otelSpan.End()
+			}
+		}
+
+		// A panicking handler is reported to Sentry and answered with a 500 instead of taking the
+		// spans down with it
+		defer func() {
+			if err := recover(); err != nil {
+				hub.RecoverWithContext(ctx, err)
+				if otelSpan != nil {
+					otelSpan.RecordError(fmt.Errorf("panic: %v", err))
+				}
+				c.AbortWithStatus(500, "Internal Server Error")
+				finish(500)
+			}
+		}()
+
+		c.Req = c.Req.WithContext(ctx)
+		c.Next()
+		finish(c.StatusCode())
+	}
+}
+
+// sentrySpanStatus maps an HTTP status code to the status of a Sentry span.
+func sentrySpanStatus(status int) sentry.SpanStatus {
+	switch {
+	case status < 400:
+		return sentry.SpanStatusOK
+	case status == 401:
+		return sentry.SpanStatusUnauthenticated
+	case status == 403:
+		return sentry.SpanStatusPermissionDenied
+	case status == 404:
+		return sentry.SpanStatusNotFound
+	case status == 409:
+		return sentry.SpanStatusAlreadyExists
+	case status == 429:
+		return sentry.SpanStatusResourceExhausted
+	case status < 500:
+		return sentry.SpanStatusInvalidArgument
+	}
+	return sentry.SpanStatusInternalError
+}
+
+// traceRoute names the trace of a request after the route handling it, e.g. "API - Show Counter".
+func traceRoute(c *rux.Context, name string) {
+	ctx := c.Req.Context()
+	counter := c.Param("name")
+
+	if hub := sentry.GetHubFromContext(ctx); hub != nil {
+		hub.Scope().SetTransaction(name)
+		if counter != "" {
+			hub.Scope().SetExtra("counter_name", counter)
+		}
+	}
+	if span := trace.SpanFromContext(ctx); span.IsRecording() {
+		span.SetAttributes(attribute.String("transaction", name))
+		if counter != "" {
+			span.SetAttributes(attribute.String("counter_name", counter))
+		}
+	}
+}
+
+// renderTemplate executes a page template in a span of its own.
+func renderTemplate(ctx context.Context, tmpl *template.Template, out io.Writer, data interface{}) error {
+	_, span := startChildSpan(ctx, "template.render")
+	defer span.Finish()
+	span.SetAttribute("template", tmpl.Name())
+
+	err := tmpl.Execute(out, data)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+// consulQueryOptions carries the context of a request into a Consul read, so it is traced as part of it.
+func consulQueryOptions(ctx context.Context) *api.QueryOptions {
+	if ctx == nil {
+		return nil
+	}
+	return (&api.QueryOptions{}).WithContext(detachedContext{ctx})
+}
+
+// consulWriteOptions carries the context of a request into a Consul write, so it is traced as part of it.
+func consulWriteOptions(ctx context.Context) *api.WriteOptions {
+	if ctx == nil {
+		return nil
+	}
+	return (&api.WriteOptions{}).WithContext(detachedContext{ctx})
+}
+
+// detachedContext keeps the values of a context, such as the current span, but not its deadline
+// or cancellation. Storage writes use it so they aren't cut short when a client disconnects.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (d detachedContext) Value(key interface{}) interface{} { return d.parent.Value(key) }
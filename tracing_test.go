@@ -0,0 +1,173 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/gookit/rux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+)
+
+// sentryTransport records the events a Sentry client would send.
+type sentryTransport struct {
+	mu     sync.Mutex
+	events []*sentry.Event
+}
+
+func (t *sentryTransport) Configure(sentry.ClientOptions) {}
+func (t *sentryTransport) Flush(time.Duration) bool       { return true }
+func (t *sentryTransport) SendEvent(event *sentry.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, event)
+}
+
+// tracingTest serves a router traced by both backends into recorders.
+type tracingTest struct {
+	router    *rux.Router
+	spans     *tracetest.SpanRecorder
+	transport *sentryTransport
+	hub       *sentry.Hub
+}
+
+func newTracingTest(t *testing.T) *tracingTest {
+	t.Helper()
+	spans := tracetest.NewSpanRecorder()
+	previousProvider, previousTracers := otel.GetTracerProvider(), tracers
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	tracers.sentry, tracers.otlp = true, true
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		tracers = previousTracers
+	})
+
+	transport := &sentryTransport{}
+	client, err := sentry.NewClient(sentry.ClientOptions{
+		Dsn:              "https://key@sentry.invalid/1",
+		Transport:        transport,
+		EnableTracing:    true,
+		TracesSampleRate: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := rux.New()
+	r.Use(tracingMiddleware(r))
+	r.GET("/counters/{name}", func(c *rux.Context) { c.Text(200, c.Param("name")) })
+	r.GET("/counters/{name}/broken", func(c *rux.Context) { panic("broken counter") })
+	return &tracingTest{router: r, spans: spans, transport: transport, hub: sentry.NewHub(client, sentry.NewScope())}
+}
+
+// get serves a request carrying the test's Sentry hub.
+func (tt *tracingTest) get(path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req = req.WithContext(sentry.SetHubOnContext(req.Context(), tt.hub))
+	w := httptest.NewRecorder()
+	tt.router.ServeHTTP(w, req)
+	return w
+}
+
+// serverSpan returns the only span recorded, failing unless there is exactly one.
+func (tt *tracingTest) serverSpan(t *testing.T) sdktrace.ReadOnlySpan {
+	t.Helper()
+	ended := tt.spans.Ended()
+	if len(ended) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(ended))
+	}
+	return ended[0]
+}
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		route  string
+		code   codes.Code
+		sentry sentry.SpanStatus
+	}{
+		{"counter", "/counters/team-a", 200, "/counters/{name}", codes.Unset, sentry.SpanStatusOK},
+		{"panic", "/counters/team-a/broken", 500, "/counters/{name}/broken", codes.Error, sentry.SpanStatusInternalError},
+		{"unmatched", "/nowhere", 404, "unmatched", codes.Unset, sentry.SpanStatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			test := newTracingTest(t)
+			if w := test.get(tt.path); w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+
+			span := test.serverSpan(t)
+			if want := "GET " + tt.route; span.Name() != want {
+				t.Errorf("span name = %q, want %q", span.Name(), want)
+			}
+			if got := spanAttribute(span, semconv.HTTPRouteKey).AsString(); got != tt.route {
+				t.Errorf("http.route = %q, want %q", got, tt.route)
+			}
+			if got := spanAttribute(span, semconv.HTTPStatusCodeKey).AsInt64(); got != int64(tt.status) {
+				t.Errorf("http.status_code = %d, want %d", got, tt.status)
+			}
+			if span.Status().Code != tt.code {
+				t.Errorf("span status = %v, want %v", span.Status().Code, tt.code)
+			}
+
+			var transaction *sentry.Event
+			for _, event := range test.transport.events {
+				if event.Type == "transaction" {
+					transaction = event
+				}
+			}
+			if transaction == nil {
+				t.Fatal("no Sentry transaction was sent")
+			}
+			if transaction.Transaction != "GET "+tt.route {
+				t.Errorf("transaction = %q", transaction.Transaction)
+			}
+			if got := transaction.Contexts["trace"]["status"]; got != tt.sentry {
+				t.Errorf("transaction status = %v, want %v", got, tt.sentry)
+			}
+		})
+	}
+}
+
+func TestTracingMiddlewareReportsPanics(t *testing.T) {
+	test := newTracingTest(t)
+	test.get("/counters/team-a/broken")
+
+	var reported *sentry.Event
+	for _, event := range test.transport.events {
+		if event.Type != "transaction" {
+			reported = event
+		}
+	}
+	if reported == nil || reported.Level != sentry.LevelFatal || reported.Message != "broken counter" {
+		t.Fatalf("the panic was not reported to Sentry: %+v", reported)
+	}
+	if events := test.serverSpan(t).Events(); len(events) == 0 || events[0].Name != "exception" {
+		t.Errorf("the panic was not recorded on the span: %+v", events)
+	}
+
+	// The router keeps serving after a panic
+	if w := test.get("/counters/team-a"); w.Code != 200 {
+		t.Errorf("status after a panic = %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/r35krag0th/win-loss-rux/version"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultTwitchAddr is Twitch's IRC server (TMI) with TLS.
+const defaultTwitchAddr = "irc.chat.twitch.tv:6697"
+
+// Permission levels of chat commands, lowest first. Each level includes the ones above it.
+const (
+	TwitchLevelEveryone    = "everyone"
+	TwitchLevelVIP         = "vip"
+	TwitchLevelMod         = "mod"
+	TwitchLevelBroadcaster = "broadcaster"
+)
+
+var twitchLevels = map[string]int{
+	TwitchLevelEveryone:    0,
+	TwitchLevelVIP:         1,
+	TwitchLevelMod:         2,
+	TwitchLevelBroadcaster: 3,
+}
+
+// TwitchCommand is the permission level and cooldown of one chat command. The cooldown is kept
+// per channel, so a command answers at most once per cooldown in every channel.
+type TwitchCommand struct {
+	Level    string
+	Cooldown time.Duration
+}
+
+// defaultTwitchCommands are the chat commands, without the leading "!".
+func defaultTwitchCommands() map[string]TwitchCommand {
+	return map[string]TwitchCommand{
+		"win":    {Level: TwitchLevelMod, Cooldown: 5 * time.Second},
+		"loss":   {Level: TwitchLevelMod, Cooldown: 5 * time.Second},
+		"draw":   {Level: TwitchLevelMod, Cooldown: 5 * time.Second},
+		"undo":   {Level: TwitchLevelMod, Cooldown: 5 * time.Second},
+		"record": {Level: TwitchLevelEveryone, Cooldown: 30 * time.Second},
+	}
+}
+
+// TwitchConfig configures the chat bot. It is read from TWITCH_BOT_USERNAME, TWITCH_OAUTH_TOKEN,
+// TWITCH_CHANNELS, TWITCH_COMMANDS, TWITCH_IRC_ADDR and TWITCH_IRC_TLS.
+type TwitchConfig struct {
+	Addr     string
+	TLS      bool
+	Username string
+	Token    string
+	// Channels maps every joined channel, without the "#", to the counter its commands change.
+	Channels map[string]string
+	Commands map[string]TwitchCommand
+}
+
+// TwitchConfigFromEnv reads the bot configuration. It returns nil without an error if
+// TWITCH_CHANNELS isn't set, which disables the bot.
+//
+// TWITCH_CHANNELS lists channel:counter pairs, e.g. "streamer:team-a,other:team-b". TWITCH_COMMANDS
+// overrides the defaults of individual commands as command:level:cooldown, e.g. "record:everyone:1m,win:broadcaster:5s".
+func TwitchConfigFromEnv() (*TwitchConfig, error) {
+	channels := splitList(os.Getenv("TWITCH_CHANNELS"))
+	if len(channels) == 0 {
+		return nil, nil
+	}
+
+	config := &TwitchConfig{
+		Addr:     getenv("TWITCH_IRC_ADDR", defaultTwitchAddr),
+		TLS:      getenv("TWITCH_IRC_TLS", "true") == "true",
+		Username: strings.ToLower(os.Getenv("TWITCH_BOT_USERNAME")),
+		Token:    os.Getenv("TWITCH_OAUTH_TOKEN"),
+		Channels: map[string]string{},
+		Commands: defaultTwitchCommands(),
+	}
+	if config.Username == "" || config.Token == "" {
+		return nil, errors.New("TWITCH_BOT_USERNAME and TWITCH_OAUTH_TOKEN must be set")
+	}
+	if !strings.HasPrefix(config.Token, "oauth:") {
+		config.Token = "oauth:" + config.Token
+	}
+
+	for _, item := range channels {
+		channel, counter, ok := strings.Cut(item, ":")
+		channel = strings.ToLower(strings.TrimPrefix(channel, "#"))
+		if !ok || channel == "" || !ValidCounterName(counter) {
+			return nil, fmt.Errorf("TWITCH_CHANNELS: expected channel:counter, got %q", item)
+		}
+		config.Channels[channel] = counter
+	}
+
+	for _, item := range splitList(os.Getenv("TWITCH_COMMANDS")) {
+		parts := strings.Split(item, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("TWITCH_COMMANDS: expected command:level:cooldown, got %q", item)
+		}
+		if _, ok := config.Commands[parts[0]]; !ok {
+			return nil, fmt.Errorf("TWITCH_COMMANDS: unknown command %q", parts[0])
+		}
+		if _, ok := twitchLevels[parts[1]]; !ok {
+			return nil, fmt.Errorf("TWITCH_COMMANDS: unknown level %q", parts[1])
+		}
+		cooldown, err := time.ParseDuration(parts[2])
+		if err != nil || cooldown < 0 {
+			return nil, fmt.Errorf("TWITCH_COMMANDS: invalid cooldown %q", parts[2])
+		}
+		config.Commands[parts[0]] = TwitchCommand{Level: parts[1], Cooldown: cooldown}
+	}
+	return config, nil
+}
+
+// IRCMessage is one line of IRC with Twitch's IRCv3 tags.
+type IRCMessage struct {
+	Tags    map[string]string
+	Prefix  string
+	Command string
+	Params  []string
+}
+
+// Nick returns the nickname of the sender from the prefix.
+func (m IRCMessage) Nick() string {
+	nick, _, _ := strings.Cut(m.Prefix, "!")
+	return nick
+}
+
+// ParseIRCMessage parses a line such as
+// "@badges=moderator/1;mod=1 :nick!nick@nick.tmi.twitch.tv PRIVMSG #channel :!win".
+func ParseIRCMessage(line string) (IRCMessage, bool) {
+	line = strings.TrimRight(line, "\r\n")
+	msg := IRCMessage{Tags: map[string]string{}}
+
+	if strings.HasPrefix(line, "@") {
+		var tags string
+		tags, line, _ = strings.Cut(line[1:], " ")
+		for _, tag := range strings.Split(tags, ";") {
+			key, value, _ := strings.Cut(tag, "=")
+			msg.Tags[key] = value
+		}
+	}
+	if strings.HasPrefix(line, ":") {
+		msg.Prefix, line, _ = strings.Cut(line[1:], " ")
+	}
+
+	var trailing string
+	hasTrailing := false
+	if i := strings.Index(line, " :"); i >= 0 {
+		line, trailing, hasTrailing = line[:i], line[i+2:], true
+	} else if strings.HasPrefix(line, ":") {
+		line, trailing, hasTrailing = "", line[1:], true
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return msg, false
+	}
+	msg.Command, msg.Params = fields[0], fields[1:]
+	if hasTrailing {
+		msg.Params = append(msg.Params, trailing)
+	}
+	return msg, true
+}
+
+// TwitchLevel returns the highest permission level of the sender of a chat message.
+func TwitchLevel(msg IRCMessage) string {
+	badges := map[string]bool{}
+	for _, badge := range strings.Split(msg.Tags["badges"], ",") {
+		name, _, _ := strings.Cut(badge, "/")
+		badges[name] = true
+	}
+	switch {
+	case badges["broadcaster"]:
+		return TwitchLevelBroadcaster
+	case badges["moderator"] || msg.Tags["mod"] == "1":
+		return TwitchLevelMod
+	case badges["vip"] || msg.Tags["vip"] == "1":
+		return TwitchLevelVIP
+	}
+	return TwitchLevelEveryone
+}
+
+// TwitchBot answers chat commands in the configured channels.
+type TwitchBot struct {
+	config *TwitchConfig
+	logger *logrus.Entry
+
+	mu       sync.Mutex
+	lastUsed map[string]time.Time
+	now      func() time.Time
+}
+
+// NewTwitchBot creates a bot for the configuration.
+func NewTwitchBot(config *TwitchConfig) *TwitchBot {
+	return &TwitchBot{
+		config: config,
+		logger: logrus.WithFields(logrus.Fields{
+			"func":    "TwitchBot",
+			"addr":    config.Addr,
+			"version": version.Version,
+		}),
+		lastUsed: map[string]time.Time{},
+		now:      time.Now,
+	}
+}
+
+// Run keeps the bot connected, reconnecting with a growing delay, until stop is closed or
+// forever if stop is nil.
+func (b *TwitchBot) Run(stop <-chan struct{}) {
+	backoff := time.Second
+	for {
+		started := time.Now()
+		err := b.connect(stop)
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		if time.Since(started) > time.Minute {
+			backoff = time.Second
+		}
+		b.logger.WithError(err).Warnf("Disconnected from Twitch; reconnecting in %s", backoff)
+		select {
+		case <-stop:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > 2*time.Minute {
+			backoff = 2 * time.Minute
+		}
+	}
+}
+
+// connect runs one IRC session until the connection fails or stop is closed.
+func (b *TwitchBot) connect(stop <-chan struct{}) error {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	var err error
+	if b.config.TLS {
+		host, _, _ := net.SplitHostPort(b.config.Addr)
+		conn, err = tls.DialWithDialer(dialer, "tcp", b.config.Addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", b.config.Addr)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if stop != nil {
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			select {
+			case <-stop:
+				conn.Close()
+			case <-done:
+			}
+		}()
+	}
+
+	session := &twitchSession{conn: conn}
+	session.send("CAP REQ :twitch.tv/tags twitch.tv/commands")
+	session.send("PASS " + b.config.Token)
+	session.send("NICK " + b.config.Username)
+	for channel := range b.config.Channels {
+		session.send("JOIN #" + channel)
+	}
+	if session.err != nil {
+		return session.err
+	}
+	b.logger.Info("Connected to Twitch chat")
+
+	reader := bufio.NewReader(conn)
+	for {
+		// Twitch sends a PING about every five minutes
+		conn.SetReadDeadline(time.Now().Add(10 * time.Minute))
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return errors.New("connection closed by server")
+			}
+			return err
+		}
+
+		msg, ok := ParseIRCMessage(line)
+		if !ok {
+			continue
+		}
+		switch msg.Command {
+		case "PING":
+			session.send("PONG :" + strings.Join(msg.Params, " "))
+		case "RECONNECT":
+			return errors.New("server asked to reconnect")
+		case "NOTICE":
+			b.logger.Warnf("Twitch notice: %s", strings.Join(msg.Params, " "))
+		case "PRIVMSG":
+			if reply, ok := b.Handle(msg); ok {
+				session.send(reply)
+			}
+		}
+		if session.err != nil {
+			return session.err
+		}
+	}
+}
+
+// twitchSession writes lines to the connection and remembers the first error.
+type twitchSession struct {
+	conn net.Conn
+	err  error
+}
+
+func (s *twitchSession) send(line string) {
+	if s.err != nil {
+		return
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, s.err = io.WriteString(s.conn, line+"\r\n")
+}
+
+// Handle runs the command of a chat message and returns the raw IRC reply, if any. Commands the
+// sender isn't allowed to use or that are cooling down are ignored silently to keep chat quiet.
+func (b *TwitchBot) Handle(msg IRCMessage) (string, bool) {
+	if len(msg.Params) < 2 {
+		return "", false
+	}
+	channel := strings.TrimPrefix(msg.Params[0], "#")
+	name, ok := b.config.Channels[channel]
+	if !ok {
+		return "", false
+	}
+
+	fields := strings.Fields(msg.Params[1])
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "!") {
+		return "", false
+	}
+	commandName := strings.ToLower(strings.TrimPrefix(fields[0], "!"))
+	command, ok := b.config.Commands[commandName]
+	if !ok {
+		return "", false
+	}
+	if twitchLevels[TwitchLevel(msg)] < twitchLevels[command.Level] {
+		return "", false
+	}
+	if !b.takeCooldown(channel, commandName, command.Cooldown) {
+		return "", false
+	}
+
+	logger := b.logger.WithFields(logrus.Fields{
+		"channel": channel,
+		"user":    msg.Nick(),
+		"command": commandName,
+		"name":    name,
+	})
+	logger.Info("Handling Twitch command")
+
+	counter := handleCounter(context.Background(), name)
+	text := ""
+	switch commandName {
+	case "win":
+		counter.AddWin()
+	case "loss":
+		counter.AddLoss()
+	case "draw":
+		counter.AddDraw()
+	case "undo":
+		if !counter.Undo() {
+			text = "Nothing to undo. "
+		}
+	}
+	winRate, _ := metricMessage(counter, MetricWinRate)
+	text += fmt.Sprintf("%s: %d-%d-%d (%s)", counter.PrettyName, counter.Wins, counter.Losses, counter.Draws, winRate)
+
+	reply := fmt.Sprintf("PRIVMSG #%s :%s", channel, text)
+	if id := msg.Tags["id"]; id != "" {
+		reply = "@reply-parent-msg-id=" + id + " " + reply
+	}
+	return reply, true
+}
+
+// takeCooldown reports whether the command may run in the channel now and starts its cooldown if so.
+func (b *TwitchBot) takeCooldown(channel, command string, cooldown time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key := channel + "/" + command
+	now := b.now()
+	if last, ok := b.lastUsed[key]; ok && now.Sub(last) < cooldown {
+		return false
+	}
+	b.lastUsed[key] = now
+	return true
+}
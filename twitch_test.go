@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeIRCServer accepts one connection from the bot and lets the test talk IRC over it.
+type fakeIRCServer struct {
+	t        *testing.T
+	listener net.Listener
+	conn     net.Conn
+	reader   *bufio.Reader
+}
+
+func newFakeIRCServer(t *testing.T) *fakeIRCServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	return &fakeIRCServer{t: t, listener: listener}
+}
+
+func (s *fakeIRCServer) accept() {
+	s.t.Helper()
+	s.listener.(*net.TCPListener).SetDeadline(time.Now().Add(5 * time.Second))
+	conn, err := s.listener.Accept()
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.t.Cleanup(func() { conn.Close() })
+	s.conn, s.reader = conn, bufio.NewReader(conn)
+}
+
+// expect reads the next line from the bot and fails unless it is want.
+func (s *fakeIRCServer) expect(want string) {
+	s.t.Helper()
+	s.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := s.reader.ReadString('\n')
+	if err != nil {
+		s.t.Fatalf("waiting for %q: %s", want, err)
+	}
+	if line = strings.TrimRight(line, "\r\n"); line != want {
+		s.t.Fatalf("bot sent %q, want %q", line, want)
+	}
+}
+
+func (s *fakeIRCServer) send(line string) {
+	s.t.Helper()
+	if _, err := s.conn.Write([]byte(line + "\r\n")); err != nil {
+		s.t.Fatal(err)
+	}
+}
+
+func TestTwitchBotSession(t *testing.T) {
+	consul := useFakeConsul(t)
+	consul.Put(consulKeyPrefix+"/team-a", `{"schema_version":1,"name":"team-a","pretty_name":"Team A","wins":2,"losses":1,"draws":0}`)
+	server := newFakeIRCServer(t)
+
+	config := &TwitchConfig{
+		Addr:     server.listener.Addr().String(),
+		Username: "winlossbot",
+		Token:    "oauth:token",
+		Channels: map[string]string{"streamer": "team-a"},
+		Commands: defaultTwitchCommands(),
+	}
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		NewTwitchBot(config).Run(stop)
+		close(stopped)
+	}()
+
+	server.accept()
+	server.expect("CAP REQ :twitch.tv/tags twitch.tv/commands")
+	server.expect("PASS oauth:token")
+	server.expect("NICK winlossbot")
+	server.expect("JOIN #streamer")
+
+	server.send("PING :tmi.twitch.tv")
+	server.expect("PONG :tmi.twitch.tv")
+
+	server.send("@badges=moderator/1;id=m1;mod=1 :amod!amod@amod.tmi.twitch.tv PRIVMSG #streamer :!win")
+	server.expect("@reply-parent-msg-id=m1 PRIVMSG #streamer :Team A: 3-1-0 (75.0%)")
+
+	// Viewers can't change the counter and the win is cooling down; neither gets an answer
+	server.send("@badges=;id=m2 :viewer!viewer@viewer.tmi.twitch.tv PRIVMSG #streamer :!loss")
+	server.send("@badges=broadcaster/1;id=m3 :streamer!streamer@streamer.tmi.twitch.tv PRIVMSG #streamer :!win")
+	server.send(":viewer!viewer@viewer.tmi.twitch.tv PRIVMSG #streamer :gg")
+	server.send("@badges=;id=m4 :viewer!viewer@viewer.tmi.twitch.tv PRIVMSG #streamer :!record")
+	server.expect("@reply-parent-msg-id=m4 PRIVMSG #streamer :Team A: 3-1-0 (75.0%)")
+
+	server.send("@badges=broadcaster/1 :streamer!streamer@streamer.tmi.twitch.tv PRIVMSG #streamer :!undo")
+	server.expect("PRIVMSG #streamer :Team A: 2-1-0 (66.7%)")
+
+	close(stop)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the bot didn't stop")
+	}
+	if stored, _ := consul.Get(consulKeyPrefix + "/team-a"); !strings.Contains(stored, `"wins":2`) || !strings.Contains(stored, `"losses":1`) {
+		t.Errorf("stored counter = %s, want 2 wins and 1 loss", stored)
+	}
+}
+
+func TestTwitchBotStopsWhileReconnecting(t *testing.T) {
+	// Nothing listens on the address, so the bot keeps failing to connect and backs off
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		NewTwitchBot(&TwitchConfig{Addr: addr, Commands: defaultTwitchCommands()}).Run(stop)
+		close(stopped)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("the bot didn't stop during its reconnect backoff")
+	}
+}
+
+func TestTwitchCooldown(t *testing.T) {
+	useFakeConsul(t)
+	now := time.Date(2026, 10, 19, 20, 0, 0, 0, time.UTC)
+	bot := NewTwitchBot(&TwitchConfig{
+		Channels: map[string]string{"streamer": "team-a", "other": "team-b"},
+		Commands: defaultTwitchCommands(),
+	})
+	bot.now = func() time.Time { return now }
+
+	record := func(channel string) bool {
+		msg, _ := ParseIRCMessage(":viewer!viewer@viewer PRIVMSG #" + channel + " :!record")
+		_, ok := bot.Handle(msg)
+		return ok
+	}
+	if !record("streamer") {
+		t.Fatal("the first !record was ignored")
+	}
+	if record("streamer") {
+		t.Error("!record answered during its cooldown")
+	}
+	if !record("other") {
+		t.Error("the cooldown of one channel held back another")
+	}
+	now = now.Add(30 * time.Second)
+	if !record("streamer") {
+		t.Error("!record was ignored after its cooldown")
+	}
+}
+
+func TestParseIRCMessage(t *testing.T) {
+	tests := []struct {
+		line string
+		want IRCMessage
+		ok   bool
+	}{
+		{
+			"PING :tmi.twitch.tv\r\n",
+			IRCMessage{Tags: map[string]string{}, Command: "PING", Params: []string{"tmi.twitch.tv"}},
+			true,
+		},
+		{
+			"@badges=moderator/1,subscriber/12;mod=1 :nick!nick@nick.tmi.twitch.tv PRIVMSG #channel :!win now",
+			IRCMessage{
+				Tags:    map[string]string{"badges": "moderator/1,subscriber/12", "mod": "1"},
+				Prefix:  "nick!nick@nick.tmi.twitch.tv",
+				Command: "PRIVMSG",
+				Params:  []string{"#channel", "!win now"},
+			},
+			true,
+		},
+		{
+			":tmi.twitch.tv 001 winlossbot :Welcome, GLHF!",
+			IRCMessage{Tags: map[string]string{}, Prefix: "tmi.twitch.tv", Command: "001", Params: []string{"winlossbot", "Welcome, GLHF!"}},
+			true,
+		},
+		{"", IRCMessage{Tags: map[string]string{}}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseIRCMessage(tt.line)
+		if ok != tt.ok || (ok && !reflect.DeepEqual(got, tt.want)) {
+			t.Errorf("ParseIRCMessage(%q) = %+v, %t, want %+v, %t", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+	if msg, _ := ParseIRCMessage(":nick!nick@host PRIVMSG #c :hi"); msg.Nick() != "nick" {
+		t.Errorf("Nick = %q", msg.Nick())
+	}
+}
+
+func TestTwitchLevel(t *testing.T) {
+	tests := []struct {
+		tags string
+		want string
+	}{
+		{"@badges=broadcaster/1,subscriber/0", TwitchLevelBroadcaster},
+		{"@badges=moderator/1", TwitchLevelMod},
+		{"@badges=;mod=1", TwitchLevelMod},
+		{"@badges=vip/1", TwitchLevelVIP},
+		{"@badges=subscriber/3", TwitchLevelEveryone},
+	}
+	for _, tt := range tests {
+		msg, _ := ParseIRCMessage(tt.tags + " :nick!nick@host PRIVMSG #c :hi")
+		if got := TwitchLevel(msg); got != tt.want {
+			t.Errorf("TwitchLevel(%s) = %s, want %s", tt.tags, got, tt.want)
+		}
+	}
+}
+
+func TestTwitchConfigFromEnv(t *testing.T) {
+	t.Setenv("TWITCH_CHANNELS", "#Streamer:team-a, other:team-b")
+	t.Setenv("TWITCH_BOT_USERNAME", "WinLossBot")
+	t.Setenv("TWITCH_OAUTH_TOKEN", "token")
+	t.Setenv("TWITCH_COMMANDS", "record:vip:1m")
+	t.Setenv("TWITCH_IRC_ADDR", "127.0.0.1:6667")
+	t.Setenv("TWITCH_IRC_TLS", "false")
+
+	config, err := TwitchConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Addr != "127.0.0.1:6667" || config.TLS {
+		t.Errorf("server = %s, TLS %t", config.Addr, config.TLS)
+	}
+	if config.Username != "winlossbot" || config.Token != "oauth:token" {
+		t.Errorf("login = %s, %s", config.Username, config.Token)
+	}
+	if want := map[string]string{"streamer": "team-a", "other": "team-b"}; !reflect.DeepEqual(config.Channels, want) {
+		t.Errorf("channels = %v, want %v", config.Channels, want)
+	}
+	if got := config.Commands["record"]; got.Level != TwitchLevelVIP || got.Cooldown != time.Minute {
+		t.Errorf("record = %+v", got)
+	}
+
+	t.Setenv("TWITCH_IRC_ADDR", "")
+	t.Setenv("TWITCH_IRC_TLS", "")
+	if config, _ = TwitchConfigFromEnv(); config.Addr != defaultTwitchAddr || !config.TLS {
+		t.Errorf("default server = %s, TLS %t", config.Addr, config.TLS)
+	}
+
+	bad := []struct {
+		commands string
+		err      string
+	}{
+		{"record:owner:1m", `unknown level "owner"`},
+		{"dance:everyone:1m", `unknown command "dance"`},
+		{"foo:everyone:1s", `unknown command "foo"`},
+		{"record:vip:1m,foo:everyone:1s", `unknown command "foo"`},
+		{"record:everyone", "expected command:level:cooldown"},
+		{"record:everyone:soon", `invalid cooldown "soon"`},
+	}
+	for _, tt := range bad {
+		t.Setenv("TWITCH_COMMANDS", tt.commands)
+		if _, err := TwitchConfigFromEnv(); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("TWITCH_COMMANDS=%s = %v, want an error about %s", tt.commands, err, tt.err)
+		}
+	}
+
+	t.Setenv("TWITCH_CHANNELS", "")
+	if config, err := TwitchConfigFromEnv(); config != nil || err != nil {
+		t.Errorf("without channels = %+v, %v, want the bot disabled", config, err)
+	}
+}
@@ -1,5 +1,8 @@
 package version
 
+// Build information, set at build time with -ldflags "-X=github.com/r35krag0th/win-loss-rux/version.Version=...".
 var (
-	Version = "0.0.0-dev"
+	Version   = "0.0.0-dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
 )
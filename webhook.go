@@ -0,0 +1,520 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/r35krag0th/win-loss-rux/version"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	webhookKeyPrefix  = fmt.Sprintf("win-loss-api/%s/webhooks", envName)
+	deliveryKeyPrefix = fmt.Sprintf("win-loss-api/%s/webhook-deliveries", envName)
+)
+
+// Events a webhook can subscribe to. Win, loss and draw fire for increments and decrements alike.
+const (
+	WebhookEventWin    = HistoryEventWin
+	WebhookEventLoss   = HistoryEventLoss
+	WebhookEventDraw   = HistoryEventDraw
+	WebhookEventReset  = HistoryEventReset
+	WebhookEventAdjust = HistoryEventAdjust
+	WebhookEventUndo   = "undo"
+	WebhookEventDelete = "delete"
+	WebhookEventPing   = "ping"
+)
+
+var webhookEvents = []string{WebhookEventWin, WebhookEventLoss, WebhookEventDraw, WebhookEventReset, WebhookEventAdjust, WebhookEventUndo, WebhookEventDelete}
+
+// Payload formats a webhook can be delivered in.
+const (
+	WebhookFormatJSON    = "json"
+	WebhookFormatDiscord = "discord"
+)
+
+// Headers sent with every delivery. The signature is "sha256=" followed by the hex HMAC-SHA256
+// of the request body, keyed with the webhook's secret.
+const (
+	WebhookSignatureHeader = "X-WinLoss-Signature"
+	WebhookEventHeader     = "X-WinLoss-Event"
+	WebhookDeliveryHeader  = "X-WinLoss-Delivery"
+)
+
+// maxWebhookDeliveries caps the delivery log kept per webhook. The oldest entries are dropped first.
+const maxWebhookDeliveries = 50
+
+var webhookID = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// ErrWebhookNotFound is returned for unknown webhook IDs.
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// Webhook is a subscription to counter changes. Without a Counter it receives the events of every counter.
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Counter   string    `json:"counter,omitempty"`
+	Events    []string  `json:"events,omitempty"`
+	Format    string    `json:"format"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Validate checks the subscription and fills in defaults.
+func (h *Webhook) Validate() error {
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	for _, event := range h.Events {
+		if !h.knownEvent(event) {
+			return fmt.Errorf("unknown event: %s", event)
+		}
+	}
+	switch h.Format {
+	case "":
+		h.Format = WebhookFormatJSON
+	case WebhookFormatJSON, WebhookFormatDiscord:
+	default:
+		return fmt.Errorf("unknown format: %s", h.Format)
+	}
+	return nil
+}
+
+func (h *Webhook) knownEvent(event string) bool {
+	for _, known := range webhookEvents {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Wants reports whether the webhook subscribed to event on the named counter.
+func (h *Webhook) Wants(event, counter string) bool {
+	if event == WebhookEventPing {
+		return true
+	}
+	if h.Counter != "" && h.Counter != counter {
+		return false
+	}
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted returns a copy of the webhook without its secret, for listing.
+func (h Webhook) Redacted() Webhook {
+	h.Secret = ""
+	return h
+}
+
+// WebhookPayload is the JSON body delivered for an event.
+type WebhookPayload struct {
+	Delivery string          `json:"delivery"`
+	Event    string          `json:"event"`
+	Delta    int             `json:"delta"`
+	Env      string          `json:"env"`
+	Time     time.Time       `json:"time"`
+	Counter  *WinLossCounter `json:"counter"`
+}
+
+// WebhookDelivery is one attempt to deliver an event, as kept in the delivery log.
+type WebhookDelivery struct {
+	Delivery   string    `json:"delivery"`
+	Event      string    `json:"event"`
+	Counter    string    `json:"counter"`
+	Time       time.Time `json:"time"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Success    bool      `json:"success"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// WebhookStore keeps webhooks and their delivery logs in the storage backend (Consul).
+type WebhookStore struct {
+	consulClient *api.Client
+	// ctx is the request the store is used for, so its storage operations are traced as part of it
+	ctx context.Context
+}
+
+// NewWebhookStore creates a store using the given Consul client.
+func NewWebhookStore(consulClient *api.Client) *WebhookStore {
+	return &WebhookStore{consulClient: consulClient}
+}
+
+func webhookKey(id string) string {
+	return webhookKeyPrefix + "/" + id
+}
+
+func deliveryKey(id string) string {
+	return deliveryKeyPrefix + "/" + id
+}
+
+// Create validates and stores a new webhook, generating its ID and, unless given, its secret.
+func (s *WebhookStore) Create(hook *Webhook) error {
+	if err := hook.Validate(); err != nil {
+		return err
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return err
+	}
+	hook.ID = id
+	if hook.Secret == "" {
+		if hook.Secret, err = randomHex(32); err != nil {
+			return err
+		}
+	}
+	hook.CreatedAt = time.Now().UTC()
+
+	b, err := json.Marshal(hook)
+	if err != nil {
+		return err
+	}
+	_, err = s.consulClient.KV().Put(&api.KVPair{Key: webhookKey(hook.ID), Value: b}, consulWriteOptions(s.ctx))
+	return err
+}
+
+// Get returns the webhook with the given ID.
+func (s *WebhookStore) Get(id string) (*Webhook, error) {
+	if !webhookID.MatchString(id) {
+		return nil, ErrWebhookNotFound
+	}
+	p, _, err := s.consulClient.KV().Get(webhookKey(id), consulQueryOptions(s.ctx))
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, ErrWebhookNotFound
+	}
+
+	var hook Webhook
+	if err = json.Unmarshal(p.Value, &hook); err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+// List returns every webhook, oldest first.
+func (s *WebhookStore) List() ([]*Webhook, error) {
+	pairs, _, err := s.consulClient.KV().List(webhookKeyPrefix+"/", consulQueryOptions(s.ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	hooks := []*Webhook{}
+	for _, p := range pairs {
+		var hook Webhook
+		if err = json.Unmarshal(p.Value, &hook); err != nil {
+			logrus.WithError(err).WithField("key", p.Key).Warn("Skipping invalid webhook")
+			continue
+		}
+		hooks = append(hooks, &hook)
+	}
+	sort.Slice(hooks, func(i, j int) bool { return hooks[i].CreatedAt.Before(hooks[j].CreatedAt) })
+	return hooks, nil
+}
+
+// Delete removes a webhook and its delivery log.
+func (s *WebhookStore) Delete(id string) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	kv := s.consulClient.KV()
+	if _, err := kv.Delete(webhookKey(id), consulWriteOptions(s.ctx)); err != nil {
+		return err
+	}
+	_, err := kv.Delete(deliveryKey(id), consulWriteOptions(s.ctx))
+	return err
+}
+
+// Deliveries returns the delivery log of a webhook, newest first.
+func (s *WebhookStore) Deliveries(id string) ([]WebhookDelivery, error) {
+	deliveries := []WebhookDelivery{}
+	p, _, err := s.consulClient.KV().Get(deliveryKey(id), consulQueryOptions(s.ctx))
+	if err != nil || p == nil {
+		return deliveries, err
+	}
+	err = json.Unmarshal(p.Value, &deliveries)
+	return deliveries, err
+}
+
+// logDelivery prepends an attempt to the delivery log of a webhook. Deliveries run concurrently,
+// so the log is updated with check-and-set.
+func (s *WebhookStore) logDelivery(id string, delivery WebhookDelivery) error {
+	kv := s.consulClient.KV()
+	for attempt := 0; attempt < 10; attempt++ {
+		p, _, err := kv.Get(deliveryKey(id), consulQueryOptions(s.ctx))
+		if err != nil {
+			return err
+		}
+
+		deliveries := []WebhookDelivery{}
+		var modifyIndex uint64
+		if p != nil {
+			modifyIndex = p.ModifyIndex
+			if err = json.Unmarshal(p.Value, &deliveries); err != nil {
+				deliveries = []WebhookDelivery{}
+			}
+		}
+
+		deliveries = append([]WebhookDelivery{delivery}, deliveries...)
+		if len(deliveries) > maxWebhookDeliveries {
+			deliveries = deliveries[:maxWebhookDeliveries]
+		}
+		b, err := json.Marshal(deliveries)
+		if err != nil {
+			return err
+		}
+
+		ok, _, err := kv.CAS(&api.KVPair{Key: deliveryKey(id), Value: b, ModifyIndex: modifyIndex}, consulWriteOptions(s.ctx))
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+	}
+	return errors.New("delivery log kept changing; giving up")
+}
+
+// WebhookDispatcher delivers events to the subscribed webhooks in the background.
+type WebhookDispatcher struct {
+	Client      *http.Client
+	MaxAttempts int
+	// Backoff is the delay before the first retry. It doubles with every further retry up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	wg sync.WaitGroup
+}
+
+// NewWebhookDispatcher creates a dispatcher configured by WEBHOOK_MAX_ATTEMPTS (default 5) and
+// WEBHOOK_BACKOFF (default 1s).
+func NewWebhookDispatcher() *WebhookDispatcher {
+	attempts, err := strconv.Atoi(getenv("WEBHOOK_MAX_ATTEMPTS", "5"))
+	if err != nil || attempts < 1 {
+		attempts = 5
+	}
+	backoff, err := time.ParseDuration(getenv("WEBHOOK_BACKOFF", "1s"))
+	if err != nil || backoff <= 0 {
+		backoff = time.Second
+	}
+	return &WebhookDispatcher{
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: attempts,
+		Backoff:     backoff,
+		MaxBackoff:  5 * time.Minute,
+	}
+}
+
+// Dispatch sends event for counter to every webhook subscribed to it. It returns once the
+// deliveries are started; they and their retries happen in the background.
+func (d *WebhookDispatcher) Dispatch(store *WebhookStore, event string, delta int, counter WinLossCounter) {
+	logger := logrus.WithFields(logrus.Fields{
+		"func":    "Dispatch",
+		"name":    counter.Name,
+		"event":   event,
+		"version": version.Version,
+	})
+
+	hooks, err := store.List()
+	if err != nil {
+		logger.WithError(err).Error("Failed to list webhooks")
+		return
+	}
+	for _, hook := range hooks {
+		if hook.Wants(event, counter.Name) {
+			d.Send(store, hook, event, delta, counter)
+		}
+	}
+}
+
+// Send delivers one event to one webhook in the background and returns the delivery ID.
+func (d *WebhookDispatcher) Send(store *WebhookStore, hook *Webhook, event string, delta int, counter WinLossCounter) string {
+	delivery, err := randomHex(8)
+	if err != nil {
+		delivery = strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	counter.consulClient = nil
+	counter.Links = nil
+	counter.Urls = nil
+
+	payload := WebhookPayload{
+		Delivery: delivery,
+		Event:    event,
+		Delta:    delta,
+		Env:      envName,
+		Time:     time.Now().UTC(),
+		Counter:  &counter,
+	}
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.deliver(store, hook, payload)
+	}()
+	return delivery
+}
+
+// Wait blocks until every delivery in flight has finished, including retries.
+func (d *WebhookDispatcher) Wait() {
+	d.wg.Wait()
+}
+
+func (d *WebhookDispatcher) deliver(store *WebhookStore, hook *Webhook, payload WebhookPayload) {
+	logger := logrus.WithFields(logrus.Fields{
+		"func":     "deliver",
+		"webhook":  hook.ID,
+		"delivery": payload.Delivery,
+		"event":    payload.Event,
+		"version":  version.Version,
+	})
+
+	body, err := webhookBody(hook, payload)
+	if err != nil {
+		logger.WithError(err).Error("Failed to marshal webhook payload")
+		return
+	}
+
+	backoff := d.Backoff
+	for attempt := 1; attempt <= d.MaxAttempts; attempt++ {
+		record := WebhookDelivery{
+			Delivery: payload.Delivery,
+			Event:    payload.Event,
+			Counter:  payload.Counter.Name,
+			Time:     time.Now().UTC(),
+			Attempt:  attempt,
+		}
+
+		started := time.Now()
+		record.StatusCode, err = d.post(hook, payload, body)
+		record.DurationMs = time.Since(started).Milliseconds()
+		record.Success = err == nil
+		if err != nil {
+			record.Error = err.Error()
+		}
+		if logErr := store.logDelivery(hook.ID, record); logErr != nil {
+			logger.WithError(logErr).Warn("Failed to write delivery log")
+		}
+
+		if err == nil {
+			logger.Debugf("Delivered on attempt %d", attempt)
+			return
+		}
+		if attempt == d.MaxAttempts {
+			logger.WithError(err).Errorf("Giving up after %d attempts", attempt)
+			return
+		}
+
+		logger.WithError(err).Warnf("Delivery attempt %d failed; retrying in %s", attempt, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > d.MaxBackoff {
+			backoff = d.MaxBackoff
+		}
+	}
+}
+
+// post sends one attempt. Any status outside 2xx counts as a failure.
+func (d *WebhookDispatcher) post(hook *Webhook, payload WebhookPayload, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "win-loss-rux/"+version.Version)
+	req.Header.Set(WebhookEventHeader, payload.Event)
+	req.Header.Set(WebhookDeliveryHeader, payload.Delivery)
+	req.Header.Set(WebhookSignatureHeader, SignWebhookBody(hook.Secret, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhookBody returns the signature header value for body: "sha256=<hex HMAC-SHA256>".
+func SignWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookBody renders the payload in the webhook's format. Discord webhook URLs expect a message
+// instead of arbitrary JSON.
+func webhookBody(hook *Webhook, payload WebhookPayload) ([]byte, error) {
+	if hook.Format != WebhookFormatDiscord {
+		return json.Marshal(payload)
+	}
+
+	counter := payload.Counter
+	var change string
+	switch {
+	case payload.Event == WebhookEventPing:
+		change = "webhook test"
+	case payload.Delta > 0:
+		change = fmt.Sprintf("+1 %s", payload.Event)
+	case payload.Delta < 0:
+		change = fmt.Sprintf("-1 %s", payload.Event)
+	default:
+		change = payload.Event
+	}
+	return json.Marshal(map[string]string{
+		"content": fmt.Sprintf("**%s**: %s → %d-%d-%d", strings.TrimSpace(counter.PrettyName), change, counter.Wins, counter.Losses, counter.Draws),
+	})
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// webhooks delivers the events of counter changes made by this process.
+var webhooks = NewWebhookDispatcher()
+
+// notifyWebhooks hands a counter change to the webhook dispatcher.
+func notifyWebhooks(counter WinLossCounter, event string, delta int) {
+	if counter.consulClient == nil || counter.Name == "" {
+		return
+	}
+	webhooks.wg.Add(1)
+	go func() {
+		defer webhooks.wg.Done()
+		webhooks.Dispatch(NewWebhookStore(counter.consulClient), event, delta, counter)
+	}()
+}
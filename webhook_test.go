@@ -0,0 +1,293 @@
+package main
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receivedWebhook is one request seen by a webhookReceiver.
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+	at     time.Time
+}
+
+// webhookReceiver is an httptest server that answers the first failures requests with a 500
+// and everything after that with a 204.
+type webhookReceiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	failures int
+	received []receivedWebhook
+}
+
+func newWebhookReceiver(t *testing.T, failures int) *webhookReceiver {
+	t.Helper()
+	receiver := &webhookReceiver{failures: failures}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		receiver.mu.Lock()
+		defer receiver.mu.Unlock()
+		receiver.received = append(receiver.received, receivedWebhook{header: r.Header.Clone(), body: body, at: time.Now()})
+		if len(receiver.received) <= receiver.failures {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver
+}
+
+func (r *webhookReceiver) Received() []receivedWebhook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedWebhook(nil), r.received...)
+}
+
+// webhookTest creates a webhook for receiver in a fake Consul and a dispatcher with short backoffs.
+func webhookTest(t *testing.T, receiver *webhookReceiver, hook Webhook) (*WebhookStore, *Webhook, *WebhookDispatcher) {
+	t.Helper()
+	_, client := newFakeConsul(t)
+	store := NewWebhookStore(client)
+	hook.URL = receiver.URL
+	if err := store.Create(&hook); err != nil {
+		t.Fatal(err)
+	}
+	dispatcher := &WebhookDispatcher{
+		Client:      receiver.Client(),
+		MaxAttempts: 4,
+		Backoff:     20 * time.Millisecond,
+		MaxBackoff:  30 * time.Millisecond,
+	}
+	return store, &hook, dispatcher
+}
+
+func webhookTestCounter() WinLossCounter {
+	counter := NewWinLossCounter("hooked")
+	counter.PrettyName = "Hooked"
+	counter.Wins, counter.Losses, counter.Draws = 3, 2, 1
+	return *counter
+}
+
+func TestWebhookDeliverySignature(t *testing.T) {
+	receiver := newWebhookReceiver(t, 0)
+	store, hook, dispatcher := webhookTest(t, receiver, Webhook{Secret: "shh"})
+
+	delivery := dispatcher.Send(store, hook, WebhookEventWin, 1, webhookTestCounter())
+	dispatcher.Wait()
+
+	received := receiver.Received()
+	if len(received) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(received))
+	}
+	got := received[0]
+	if signature := got.header.Get(WebhookSignatureHeader); !hmac.Equal([]byte(signature), []byte(SignWebhookBody("shh", got.body))) {
+		t.Errorf("%s = %q does not match the body", WebhookSignatureHeader, signature)
+	}
+	if SignWebhookBody("other", got.body) == got.header.Get(WebhookSignatureHeader) {
+		t.Error("the signature does not depend on the secret")
+	}
+	if event := got.header.Get(WebhookEventHeader); event != WebhookEventWin {
+		t.Errorf("%s = %q, want %q", WebhookEventHeader, event, WebhookEventWin)
+	}
+	if id := got.header.Get(WebhookDeliveryHeader); id != delivery {
+		t.Errorf("%s = %q, want %q", WebhookDeliveryHeader, id, delivery)
+	}
+
+	var payload WebhookPayload
+	if err := json.Unmarshal(got.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Delivery != delivery || payload.Event != WebhookEventWin || payload.Delta != 1 {
+		t.Errorf("payload = %+v", payload)
+	}
+	if payload.Counter == nil || payload.Counter.Name != "hooked" || payload.Counter.Wins != 3 {
+		t.Errorf("payload counter = %+v", payload.Counter)
+	}
+}
+
+func TestWebhookRetriesWithBackoff(t *testing.T) {
+	receiver := newWebhookReceiver(t, 3)
+	store, hook, dispatcher := webhookTest(t, receiver, Webhook{})
+
+	dispatcher.Send(store, hook, WebhookEventLoss, 1, webhookTestCounter())
+	dispatcher.Wait()
+
+	received := receiver.Received()
+	if len(received) != 4 {
+		t.Fatalf("receiver got %d requests, want 4", len(received))
+	}
+	// 20ms, then doubled to 40ms but capped at 30ms
+	for i, want := range []time.Duration{20 * time.Millisecond, 30 * time.Millisecond, 30 * time.Millisecond} {
+		if gap := received[i+1].at.Sub(received[i].at); gap < want {
+			t.Errorf("retry %d came after %s, want at least %s", i+1, gap, want)
+		}
+	}
+	for _, r := range received[1:] {
+		if r.header.Get(WebhookDeliveryHeader) != received[0].header.Get(WebhookDeliveryHeader) {
+			t.Error("a retry changed the delivery ID")
+		}
+	}
+
+	deliveries, err := store.Deliveries(hook.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 4 {
+		t.Fatalf("delivery log has %d entries, want 4", len(deliveries))
+	}
+	// The log is newest first
+	for i, d := range deliveries {
+		attempt := 4 - i
+		if d.Attempt != attempt || d.Event != WebhookEventLoss || d.Counter != "hooked" {
+			t.Errorf("log entry %d = %+v, want attempt %d", i, d, attempt)
+		}
+		success := attempt == 4
+		if d.Success != success {
+			t.Errorf("attempt %d success = %t, want %t", attempt, d.Success, success)
+		}
+		if success && (d.StatusCode != http.StatusNoContent || d.Error != "") {
+			t.Errorf("successful attempt logged as %+v", d)
+		}
+		if !success && (d.StatusCode != http.StatusInternalServerError || d.Error == "") {
+			t.Errorf("failed attempt logged as %+v", d)
+		}
+	}
+}
+
+func TestWebhookGivesUp(t *testing.T) {
+	receiver := newWebhookReceiver(t, 100)
+	store, hook, dispatcher := webhookTest(t, receiver, Webhook{})
+
+	dispatcher.Send(store, hook, WebhookEventDraw, 1, webhookTestCounter())
+	dispatcher.Wait()
+
+	if got := len(receiver.Received()); got != dispatcher.MaxAttempts {
+		t.Errorf("receiver got %d requests, want %d", got, dispatcher.MaxAttempts)
+	}
+	deliveries, err := store.Deliveries(hook.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range deliveries {
+		if d.Success {
+			t.Errorf("attempt %d logged as a success", d.Attempt)
+		}
+	}
+}
+
+func TestWebhookDispatchFilters(t *testing.T) {
+	receiver := newWebhookReceiver(t, 0)
+	store, _, dispatcher := webhookTest(t, receiver, Webhook{Counter: "hooked", Events: []string{WebhookEventWin}})
+
+	counter := webhookTestCounter()
+	dispatcher.Dispatch(store, WebhookEventLoss, 1, counter)
+	other := counter
+	other.Name = "other"
+	dispatcher.Dispatch(store, WebhookEventWin, 1, other)
+	dispatcher.Dispatch(store, WebhookEventWin, 1, counter)
+	dispatcher.Wait()
+
+	received := receiver.Received()
+	if len(received) != 1 || received[0].header.Get(WebhookEventHeader) != WebhookEventWin {
+		t.Fatalf("receiver got %d requests, want only the win on hooked", len(received))
+	}
+}
+
+func TestWebhookDiscordFormat(t *testing.T) {
+	receiver := newWebhookReceiver(t, 0)
+	store, hook, dispatcher := webhookTest(t, receiver, Webhook{Format: WebhookFormatDiscord})
+
+	dispatcher.Send(store, hook, WebhookEventWin, -1, webhookTestCounter())
+	dispatcher.Wait()
+
+	received := receiver.Received()
+	if len(received) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(received))
+	}
+	var message map[string]string
+	if err := json.Unmarshal(received[0].body, &message); err != nil {
+		t.Fatal(err)
+	}
+	if want := "**Hooked**: -1 win → 3-2-1"; message["content"] != want {
+		t.Errorf("content = %q, want %q", message["content"], want)
+	}
+}
+
+func TestWebhookValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		hook Webhook
+		ok   bool
+	}{
+		{"defaults", Webhook{URL: "https://example.com/hook"}, true},
+		{"discord", Webhook{URL: "https://discord.com/api/webhooks/1/x", Format: WebhookFormatDiscord}, true},
+		{"events", Webhook{URL: "http://example.com", Events: []string{WebhookEventWin, WebhookEventDelete}}, true},
+		{"relative url", Webhook{URL: "/hook"}, false},
+		{"other scheme", Webhook{URL: "ftp://example.com/hook"}, false},
+		{"unknown event", Webhook{URL: "https://example.com/hook", Events: []string{"ping"}}, false},
+		{"unknown format", Webhook{URL: "https://example.com/hook", Format: "xml"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.hook.Validate()
+			if tt.ok && err != nil {
+				t.Errorf("Validate = %s", err)
+			}
+			if !tt.ok && err == nil {
+				t.Error("Validate accepted the webhook")
+			}
+			if tt.ok && tt.hook.Format == "" {
+				t.Error("Validate left the format empty")
+			}
+		})
+	}
+}
+
+func TestCounterChangesNotifyWebhooks(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(counter *WinLossCounter)
+		want []string
+	}{
+		{"win", func(counter *WinLossCounter) { counter.AddWin() }, []string{WebhookEventWin}},
+		{"undo", func(counter *WinLossCounter) {
+			counter.AddLoss()
+			webhooks.Wait()
+			counter.Undo()
+		}, []string{WebhookEventLoss, WebhookEventUndo}},
+		{"nothing to undo", func(counter *WinLossCounter) { counter.Undo() }, nil},
+		{"destroy", func(counter *WinLossCounter) { counter.Destroy() }, []string{WebhookEventDelete}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := newWebhookReceiver(t, 0)
+			store, _, dispatcher := webhookTest(t, receiver, Webhook{Counter: "hooked"})
+			previous := webhooks
+			webhooks = dispatcher
+			t.Cleanup(func() { webhooks = previous })
+
+			counter := NewWinLossCounter("hooked")
+			counter.SetConsulClient(store.consulClient)
+			tt.run(counter)
+			webhooks.Wait()
+
+			var got []string
+			for _, request := range receiver.Received() {
+				got = append(got, request.header.Get(WebhookEventHeader))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
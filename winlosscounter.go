@@ -1,33 +1,56 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/consul/api"
 	"github.com/r35krag0th/win-loss-rux/numericsapp"
+	"github.com/r35krag0th/win-loss-rux/schema"
 	"github.com/r35krag0th/win-loss-rux/version"
 	"github.com/sirupsen/logrus"
 )
 
 var (
-	envName         = getenv("APP_ENV", "dev")
-	consulKeyPrefix = fmt.Sprintf("win-loss-api/%s/counters", envName)
+	envName          = getenv("APP_ENV", "dev")
+	consulKeyPrefix  = fmt.Sprintf("win-loss-api/%s/counters", envName)
+	historyKeyPrefix = fmt.Sprintf("win-loss-api/%s/history", envName)
 )
 
+// counterName is what the admin area accepts for new counter names. Slashes would split the
+// Consul key, so only URL friendly characters are allowed.
+var counterName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// ErrCounterExists is returned when creating or renaming would replace an existing counter.
+var ErrCounterExists = errors.New("counter already exists")
+
+// ErrCounterChanged is returned when renaming a counter that was written since it was loaded.
+var ErrCounterChanged = errors.New("counter changed while it was being renamed; try again")
+
+// ValidCounterName reports whether name can be used for a new counter.
+func ValidCounterName(name string) bool {
+	return len(name) <= 128 && counterName.MatchString(name)
+}
+
 // WinLossCounter represents a counter and is used to persist data in the storage backend.
 type WinLossCounter struct {
 	consulClient *api.Client
-	Name         string `json:"name"`
-	PrettyName   string `json:"pretty_name,omitempty"`
-	Wins         int    `json:"wins"`
-	Losses       int    `json:"losses"`
-	Draws        int    `json:"draws"`
-	Urls         struct {
-		Html string `json:"html"`
-		Api  string `json:"api"`
-	}
+	ctx          context.Context
+	modifyIndex  uint64
+	Name         string        `json:"name"`
+	PrettyName   string        `json:"pretty_name,omitempty"`
+	Wins         int           `json:"wins"`
+	Losses       int           `json:"losses"`
+	Draws        int           `json:"draws"`
+	Theme        string        `json:"theme,omitempty"`
+	UpdatedAt    *time.Time    `json:"updated_at,omitempty"`
+	Links        *CounterLinks `json:"links,omitempty"`
+	Urls         *CounterUrls  `json:"Urls,omitempty"`
 }
 
 // NewWinLossCounter creates a new WinLossCounter with default values.
@@ -58,11 +81,24 @@ func (w WinLossCounter) consulKey() string {
 	return fmt.Sprintf(strings.Join([]string{consulKeyPrefix, "%s"}, "/"), w.Name)
 }
 
-// ListAll returns a list of all known counter names.
+// ListAll returns a list of all known counter names. Failures are logged and yield no names.
 func (w WinLossCounter) ListAll() []string {
+	names, err := w.listAll()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"name":    w.Name,
+			"func":    "ListAll",
+			"version": version.Version,
+		}).WithError(err).Error("Failed to list keys")
+	}
+	return names
+}
+
+// listAll is ListAll for callers that must not mistake a failure for an empty list.
+func (w WinLossCounter) listAll() ([]string, error) {
 	logger := logrus.WithFields(logrus.Fields{
 		"name":    w.Name,
-		"func":    "ListAll",
+		"func":    "listAll",
 		"version": version.Version,
 	})
 	// Consul
@@ -71,9 +107,9 @@ func (w WinLossCounter) ListAll() []string {
 	kv := w.consulClient.KV()
 
 	logger.Debugf("Listing keys with prefix: %s", consulKeyPrefix)
-	matchedKeys, _, err := kv.List(consulKeyPrefix, nil)
+	matchedKeys, _, err := kv.List(consulKeyPrefix, consulQueryOptions(w.ctx))
 	if err != nil {
-		logger.WithError(err).Error("Failed to list keys")
+		return nil, err
 	}
 
 	var returnedKeys []string
@@ -99,7 +135,16 @@ func (w WinLossCounter) ListAll() []string {
 			splitBySlash[3],
 		)
 	}
-	return returnedKeys
+	return returnedKeys, nil
+}
+
+// SetLinks fills in the counter's self links, and the deprecated Urls pair, below the given public base URL.
+func (w *WinLossCounter) SetLinks(baseURL string) {
+	if w.Name == "" {
+		return
+	}
+	w.Links = NewCounterLinks(baseURL, w.Name)
+	w.Urls = &CounterUrls{Html: w.Links.Html, Api: w.Links.Api}
 }
 
 // SetConsulClient will set the Hashicorp Consul client this counter will use to access the storage backend.
@@ -107,6 +152,12 @@ func (w *WinLossCounter) SetConsulClient(c *api.Client) {
 	w.consulClient = c
 }
 
+// SetContext sets the context of the request the counter is used for, so its storage operations
+// are traced as part of that request.
+func (w *WinLossCounter) SetContext(ctx context.Context) {
+	w.ctx = ctx
+}
+
 // ValidateAndFix ensures that Wins, Losses, and Draws are greater than or equal to zero.
 func (w *WinLossCounter) ValidateAndFix() {
 	logger := logrus.WithFields(logrus.Fields{
@@ -155,6 +206,7 @@ func (w *WinLossCounter) AddWin() {
 	w.Wins += 1
 	logger.Infof("Incrementing Wins to %d", w.Wins)
 	w.Save()
+	w.recordHistory(HistoryEventWin, 1)
 }
 
 // RemoveWin will attempt to decrement the current value of Wins by 1.
@@ -166,9 +218,13 @@ func (w *WinLossCounter) RemoveWin() {
 		"version": version.Version,
 	})
 
+	before := w.Wins
 	w.Wins -= 1
 	logger.Infof("Decrementing Wins to %d", w.Wins)
 	w.Save()
+	if w.Wins != before {
+		w.recordHistory(HistoryEventWin, -1)
+	}
 }
 
 // AddLoss will to increment the current value of Losses by 1.
@@ -182,6 +238,7 @@ func (w *WinLossCounter) AddLoss() {
 	w.Losses += 1
 	logger.Infof("Incrementing Losses to %d", w.Losses)
 	w.Save()
+	w.recordHistory(HistoryEventLoss, 1)
 }
 
 // RemoveLoss will attempt to decrement the current value of Losses by 1.
@@ -192,9 +249,14 @@ func (w *WinLossCounter) RemoveLoss() {
 		"func":    "RemoveLoss",
 		"version": version.Version,
 	})
+
+	before := w.Losses
 	w.Losses -= 1
 	logger.Infof("Decrementing Losses to %d", w.Losses)
 	w.Save()
+	if w.Losses != before {
+		w.recordHistory(HistoryEventLoss, -1)
+	}
 }
 
 // AddDraw will to increment the current value of Draws by 1.
@@ -208,6 +270,7 @@ func (w *WinLossCounter) AddDraw() {
 	w.Draws += 1
 	logger.Infof("Incrementing Draws to %d", w.Draws)
 	w.Save()
+	w.recordHistory(HistoryEventDraw, 1)
 }
 
 // RemoveDraw will attempt to decrement the current value of Draws by 1.
@@ -218,9 +281,14 @@ func (w *WinLossCounter) RemoveDraw() {
 		"func":    "RemoveDraw",
 		"version": version.Version,
 	})
+
+	before := w.Draws
 	w.Draws -= 1
 	logger.Infof("Decrementing Draws to %d", w.Draws)
 	w.Save()
+	if w.Draws != before {
+		w.recordHistory(HistoryEventDraw, -1)
+	}
 }
 
 // Reset will reset the current counter's values to zero and persist the changes
@@ -236,6 +304,173 @@ func (w *WinLossCounter) Reset() {
 	w.Draws = 0
 	logger.Info("Counter has been reset")
 	w.Save()
+	w.recordHistory(HistoryEventReset, 0)
+}
+
+// Adjust sets Wins, Losses, and Draws to the given values and persists the changes
+// in the storage backend (Consul). Negative values are set to zero.
+func (w *WinLossCounter) Adjust(wins, losses, draws int) {
+	logger := logrus.WithFields(logrus.Fields{
+		"name":    w.Name,
+		"func":    "Adjust",
+		"version": version.Version,
+	})
+	w.Wins = wins
+	w.Losses = losses
+	w.Draws = draws
+	w.ValidateAndFix()
+	logger.Infof("Adjusting counter to %d-%d-%d", w.Wins, w.Losses, w.Draws)
+	w.Save()
+	w.recordHistory(HistoryEventAdjust, 0)
+}
+
+// Undo reverts the most recent change recorded in the counter's history, restoring the values
+// from before it and removing it from the history. It returns false when there is nothing that
+// can be undone.
+func (w *WinLossCounter) Undo() bool {
+	logger := logrus.WithFields(logrus.Fields{
+		"name":    w.Name,
+		"func":    "Undo",
+		"version": version.Version,
+	})
+
+	history := w.History()
+	previous, ok := valuesBefore(history)
+	if !ok {
+		logger.Info("Nothing to undo")
+		return false
+	}
+
+	last := history[len(history)-1]
+	logger.Infof("Undoing %s (%+d)", last.Event, last.Delta)
+	w.Wins = previous.Wins
+	w.Losses = previous.Losses
+	w.Draws = previous.Draws
+	w.Save()
+	w.SetHistory(history[:len(history)-1])
+	statsdEvent(*w, "undo", 0)
+	notifyWebhooks(*w, WebhookEventUndo, 0)
+	return true
+}
+
+// SetTheme stores the theme the HTML pages use for this counter when a request doesn't select one.
+// An empty name clears the stored theme.
+func (w *WinLossCounter) SetTheme(name string) {
+	logger := logrus.WithFields(logrus.Fields{
+		"name":    w.Name,
+		"func":    "SetTheme",
+		"theme":   name,
+		"version": version.Version,
+	})
+	w.Theme = name
+	logger.Info("Setting default theme")
+	w.Save()
+}
+
+// Create persists a new counter, failing with ErrCounterExists if the name is already taken.
+func (w *WinLossCounter) Create() error {
+	logger := logrus.WithFields(logrus.Fields{
+		"name":    w.Name,
+		"func":    "Create",
+		"version": version.Version,
+	})
+	w.ValidateAndFix()
+	now := time.Now().UTC()
+	w.UpdatedAt = &now
+
+	err, stateJson := w.ToJson()
+	if err != nil {
+		logger.WithError(err).Error("Failed to JSON-ify Counter")
+		return err
+	}
+
+	// A ModifyIndex of 0 only writes the key if it doesn't exist yet.
+	kv := w.consulClient.KV()
+	ok, _, err := kv.CAS(&api.KVPair{Key: w.consulKey(), Value: []byte(stateJson), ModifyIndex: 0}, consulWriteOptions(w.ctx))
+	if err != nil {
+		logger.WithError(err).Error("Failed to write new counter to Consul")
+		return err
+	}
+	if !ok {
+		return ErrCounterExists
+	}
+
+	logger.Info("The counter has been created")
+	return nil
+}
+
+// Rename moves the counter and its history to newName in a single Consul transaction, so a
+// failure leaves either the old counter or the new one, never both or neither. It fails with
+// ErrCounterExists if newName is already taken and with ErrCounterChanged if the counter was
+// written since it was loaded.
+func (w *WinLossCounter) Rename(newName string) error {
+	logger := logrus.WithFields(logrus.Fields{
+		"name":     w.Name,
+		"new_name": newName,
+		"func":     "Rename",
+		"version":  version.Version,
+	})
+
+	old := *w
+	history, err := old.loadHistory()
+	if err != nil {
+		logger.WithError(err).Error("Failed to load history")
+		return err
+	}
+	if len(history) > maxHistoryEntries {
+		history = history[len(history)-maxHistoryEntries:]
+	}
+	historyJSON, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+
+	renamed := *w
+	renamed.Name = newName
+	renamed.ValidateAndFix()
+	now := time.Now().UTC()
+	renamed.UpdatedAt = &now
+	err, stateJson := renamed.ToJson()
+	if err != nil {
+		return err
+	}
+
+	// Deleting the old counter only succeeds if it is unchanged since it was loaded
+	deleteOld := &api.KVTxnOp{Verb: api.KVDelete, Key: old.consulKey()}
+	if old.modifyIndex != 0 {
+		deleteOld = &api.KVTxnOp{Verb: api.KVDeleteCAS, Key: old.consulKey(), Index: old.modifyIndex}
+	}
+	ops := api.KVTxnOps{
+		// An Index of 0 only writes the key if it doesn't exist yet
+		{Verb: api.KVCAS, Key: renamed.consulKey(), Value: []byte(stateJson), Index: 0},
+		{Verb: api.KVSet, Key: renamed.historyKey(), Value: historyJSON},
+		deleteOld,
+		{Verb: api.KVDelete, Key: old.historyKey()},
+	}
+
+	ok, resp, _, err := w.consulClient.KV().Txn(ops, consulQueryOptions(w.ctx))
+	if err != nil {
+		logger.WithError(err).Error("Failed to rename the counter in Consul")
+		return err
+	}
+	if !ok {
+		for _, txnErr := range resp.Errors {
+			logger.WithField("op", txnErr.OpIndex).Warn(txnErr.What)
+			if txnErr.OpIndex == 0 {
+				return ErrCounterExists
+			}
+		}
+		return ErrCounterChanged
+	}
+
+	renamed.modifyIndex = 0
+	if len(resp.Results) > 0 && resp.Results[0] != nil {
+		renamed.modifyIndex = resp.Results[0].ModifyIndex
+	}
+	*w = renamed
+	notifyWebhooks(old, WebhookEventDelete, 0)
+	logger.Info("The counter has been renamed")
+	return nil
 }
 
 // Destroy will delete the counter, by name, from the storage backend (Consul).
@@ -250,50 +485,79 @@ func (w *WinLossCounter) Destroy() {
 	kv := w.consulClient.KV()
 
 	logger.Debugf("Deleting the key '%s'", w.consulKey())
-	_, err := kv.Delete(w.consulKey(), nil)
+	_, err := kv.Delete(w.consulKey(), consulWriteOptions(w.ctx))
 	if err != nil {
 		logger.WithError(err).Error("Destroying the counter failed")
 		return
 	}
+	w.destroyHistory()
+	notifyWebhooks(*w, WebhookEventDelete, 0)
 
 	logger.Info("The counter has been destroyed")
 }
 
 // FromJson parses the given JSON string to load the counter values.
+// Documents stored with an older schema_version are migrated first.
 func (w *WinLossCounter) FromJson(v string) error {
+	_, err := w.decodeRecord([]byte(v))
+	return err
+}
+
+// decodeRecord loads the counter values from a stored document and returns the
+// schema_version the document was stored with.
+func (w *WinLossCounter) decodeRecord(v []byte) (int, error) {
 	logger := logrus.WithFields(logrus.Fields{
 		"name":    w.Name,
-		"func":    "FromJson",
+		"func":    "decodeRecord",
 		"version": version.Version,
 	})
 	logger.WithFields(logrus.Fields{
-		"json_input": v,
+		"json_input": string(v),
 	}).Debug("attempting to unmarshal json input")
-	var tmp WinLossCounter
-	err := json.Unmarshal([]byte(v), &tmp)
+	record, storedVersion, err := schema.Decode(v)
 	if err != nil {
-		logger.WithError(err).Error("Failed to unmarshall into a WinLossCounter")
-		return err
+		logger.WithError(err).Error("Failed to unmarshall into a CounterRecord")
+		return storedVersion, err
 	}
 
-	logger.Debug("JSON has been unmarshalled into a WinLossCounter")
-	w.Wins = tmp.Wins
-	w.Losses = tmp.Losses
-	w.Draws = tmp.Draws
+	logger.WithFields(logrus.Fields{
+		"schema_version": storedVersion,
+	}).Debug("JSON has been unmarshalled into a CounterRecord")
+	w.Wins = record.Wins
+	w.Losses = record.Losses
+	w.Draws = record.Draws
+	if record.PrettyName != "" {
+		w.PrettyName = record.PrettyName
+	}
+	w.Theme = record.Theme
+	w.UpdatedAt = record.UpdatedAt
 
 	w.ValidateAndFix()
 
-	return nil
+	return storedVersion, nil
 }
 
-// ToJson returns the JSON string representation of the current counter and it's values.
+// toRecord returns the persisted representation of the counter.
+func (w WinLossCounter) toRecord() schema.CounterRecord {
+	return schema.CounterRecord{
+		Name:       w.Name,
+		PrettyName: w.PrettyName,
+		Wins:       w.Wins,
+		Losses:     w.Losses,
+		Draws:      w.Draws,
+		Theme:      w.Theme,
+		UpdatedAt:  w.UpdatedAt,
+	}
+}
+
+// ToJson returns the JSON string that is persisted for the current counter and it's values.
 func (w WinLossCounter) ToJson() (error, string) {
 	logger := logrus.WithFields(logrus.Fields{
 		"name":    w.Name,
 		"func":    "ToJson",
 		"version": version.Version,
 	})
-	b, err := json.Marshal(w)
+	b, err := schema.Encode(w.toRecord())
 	if err != nil {
 		logger.WithError(err).Error("Failed to marshall this counter into JSON")
 		return err, ""
@@ -316,6 +580,24 @@ func (w *WinLossCounter) Load() {
 		return
 	}
 
+	found, err := w.load()
+	if err != nil {
+		logger.WithError(err).Error("Failed to Load")
+		return
+	}
+	if !found {
+		logger.Errorf("Key did not have a value: %s", w.consulKey())
+	}
+}
+
+// load is Load for callers that must tell a missing counter (false) from a failure (an error).
+func (w *WinLossCounter) load() (bool, error) {
+	logger := logrus.WithFields(logrus.Fields{
+		"name":    w.Name,
+		"func":    "load",
+		"version": version.Version,
+	})
+
 	logger.Debugf("consulClient is -> %+v", w.consulClient)
 
 	// === Consul
@@ -323,39 +605,106 @@ func (w *WinLossCounter) Load() {
 	kv := w.consulClient.KV()
 
 	logger.Debugf("(Before) kv.Get(%s, nil)", w.consulKey())
-	p, _, err := kv.Get(w.consulKey(), nil)
-
-	logger.Debug("(Before) err != nil check")
+	p, _, err := kv.Get(w.consulKey(), consulQueryOptions(w.ctx))
 	if err != nil {
-		logger.WithError(err).Errorf("Key Not Found: %s", w.consulKey())
-		return
+		return false, err
 	}
 	if p == nil {
-		logger.Errorf("Key did not have a value: %s", w.consulKey())
-		return
+		return false, nil
 	}
 
-	err = w.FromJson(string(p.Value))
+	storedVersion, err := w.decodeRecord(p.Value)
 	if err != nil {
-		logger.WithError(err).Error("Failed to Load")
-		return
+		return false, err
+	}
+	w.modifyIndex = p.ModifyIndex
+
+	if storedVersion < schema.CurrentVersion {
+		logger.Infof("Upgrading stored counter from schema_version %d to %d", storedVersion, schema.CurrentVersion)
+		w.saveIfUnchanged(p.ModifyIndex)
+	}
+	return true, nil
+}
+
+// ModifyIndex returns the storage backend's (Consul) modify index of the counter as of the last Load.
+// It changes with every write, so it identifies a version of the counter. It is zero if nothing was loaded.
+func (w WinLossCounter) ModifyIndex() uint64 {
+	return w.modifyIndex
+}
+
+// saveIfUnchanged persists the counter only if the stored document is still at modifyIndex,
+// so an upgrade on read never overwrites a concurrent write.
+func (w WinLossCounter) saveIfUnchanged(modifyIndex uint64) bool {
+	logger := logrus.WithFields(logrus.Fields{
+		"name":    w.Name,
+		"func":    "saveIfUnchanged",
+		"version": version.Version,
+	})
+
+	err, stateJson := w.ToJson()
+	if err != nil {
+		logger.WithError(err).Error("Failed to JSON-ify Counter")
+		return false
+	}
+
+	kv := w.consulClient.KV()
+	wp := &api.KVPair{Key: w.consulKey(), Value: []byte(stateJson), ModifyIndex: modifyIndex}
+	ok, _, err := kv.CAS(wp, consulWriteOptions(w.ctx))
+	if err != nil {
+		logger.WithError(err).Error("Failed to write new state to Consul")
+		return false
+	}
+	if !ok {
+		logger.Warn("Counter changed while it was being written; leaving it as is")
 	}
+	return ok
+}
+
+// Exists reports whether the counter, by name, is present in the storage backend (Consul).
+func (w WinLossCounter) Exists() (bool, error) {
+	logger := logrus.WithFields(logrus.Fields{
+		"name":    w.Name,
+		"func":    "Exists",
+		"version": version.Version,
+	})
+
+	kv := w.consulClient.KV()
+
+	logger.Debugf("kv.Get(%s, nil)", w.consulKey())
+	p, _, err := kv.Get(w.consulKey(), consulQueryOptions(w.ctx))
+	if err != nil {
+		logger.WithError(err).Error("Failed to look up key")
+		return false, err
+	}
+	return p != nil, nil
 }
 
 // Save persists the current counter in the storage backend (Consul).
 func (w *WinLossCounter) Save() {
+	if err := w.save(); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"name":    w.Name,
+			"func":    "Save",
+			"version": version.Version,
+		}).WithError(err).Error("Failed to write new state to Consul")
+	}
+}
+
+// save is Save for callers that need to know whether the write failed.
+func (w *WinLossCounter) save() error {
 	logger := logrus.WithFields(logrus.Fields{
 		"name":    w.Name,
-		"func":    "Save",
+		"func":    "save",
 		"version": version.Version,
 	})
 	w.ValidateAndFix()
+	now := time.Now().UTC()
+	w.UpdatedAt = &now
 
 	logger.Debug("Creating state JSON")
 	err, stateJson := w.ToJson()
 	if err != nil {
-		logger.WithError(err).Error("Failed to JSON-ify Counter")
-		return
+		return err
 	}
 
 	// Consul
@@ -364,10 +713,25 @@ func (w *WinLossCounter) Save() {
 
 	logger.Debugf("Creating KV Pair for %s with JSON Data: %s", w.consulKey(), stateJson)
 	wp := &api.KVPair{Key: w.consulKey(), Value: []byte(stateJson)}
-	_, err = kv.Put(wp, nil)
-	if err != nil {
-		logger.WithError(err).Error("Failed to write new state to Consul")
+	if _, err = kv.Put(wp, consulWriteOptions(w.ctx)); err != nil {
+		return err
+	}
+	statsdGauges(*w)
+	return nil
+}
+
+// Games returns the total number of recorded results (Wins, Losses, and Draws).
+func (w WinLossCounter) Games() int {
+	return w.Wins + w.Losses + w.Draws
+}
+
+// WinRate returns the fraction of all recorded results that were Wins, between 0 and 1.
+// A counter without any results has a win rate of zero.
+func (w WinLossCounter) WinRate() float64 {
+	if w.Games() == 0 {
+		return 0
 	}
+	return float64(w.Wins) / float64(w.Games())
 }
 
 func (w WinLossCounter) valueToNumericsCounter(value int, postfix string, color string) *numericsapp.CounterWidgetResponse {
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestUndoAndAdjust(t *testing.T) {
+	win := apiRequest{method: http.MethodPut, path: "/api/v1/counters/panel/win"}
+	loss := apiRequest{method: http.MethodPut, path: "/api/v1/counters/panel/loss"}
+	undo := apiRequest{method: http.MethodPost, path: "/api/v1/counters/panel/undo"}
+	adjust := func(body string) apiRequest {
+		return apiRequest{method: http.MethodPost, path: "/api/v1/counters/panel/adjust", body: body, contentType: "application/json"}
+	}
+
+	tests := []struct {
+		name     string
+		requests []apiRequest
+		status   int
+		want     [3]int
+	}{
+		{"undo the last change", []apiRequest{win, loss, undo}, 200, [3]int{1, 0, 0}},
+		{"undo twice", []apiRequest{win, loss, undo, undo}, 200, [3]int{0, 0, 0}},
+		{"nothing to undo", []apiRequest{undo}, 409, [3]int{0, 0, 0}},
+		{"adjust keeps omitted values", []apiRequest{win, adjust(`{"losses": 4, "draws": 2}`)}, 200, [3]int{1, 4, 2}},
+		{"adjust clamps negative values", []apiRequest{win, adjust(`{"wins": -3}`)}, 200, [3]int{0, 0, 0}},
+		{"undo an adjustment", []apiRequest{win, adjust(`{"wins": 9}`), undo}, 200, [3]int{1, 0, 0}},
+		{"an adjustment on its own can't be undone", []apiRequest{adjust(`{"wins": 9}`), undo}, 409, [3]int{9, 0, 0}},
+		{"adjust without a body", []apiRequest{adjust("")}, 400, [3]int{0, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := apiTestRouter(t, "")
+
+			var status int
+			for _, request := range tt.requests {
+				status = request.serve(r).Code
+			}
+			if status != tt.status {
+				t.Errorf("status of the last request = %d, want %d", status, tt.status)
+			}
+
+			w := apiRequest{method: http.MethodGet, path: "/api/v1/counters/panel"}.serve(r)
+			var counter WinLossCounter
+			if err := json.Unmarshal(w.Body.Bytes(), &counter); err != nil {
+				t.Fatal(err)
+			}
+			if got := [3]int{counter.Wins, counter.Losses, counter.Draws}; got != tt.want {
+				t.Errorf("counter = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}